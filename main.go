@@ -1,16 +1,32 @@
 package main
 
 import (
-	"fmt"
+	"log/slog"
 	"os"
 
 	"github.com/ALW1EZ/camtruder/pkg/cli"
 )
 
 func main() {
+	// Subcommands take their own arguments
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		if err := cli.Diff(os.Args[2:]); err != nil {
+			slog.Error("diff failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		if err := cli.Validate(os.Args[2:]); err != nil {
+			slog.Error("validate failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	opts := cli.ParseOptions()
 	if err := cli.Run(opts); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		slog.Error("scan failed", "error", err)
 		os.Exit(1)
 	}
 }
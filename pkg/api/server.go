@@ -0,0 +1,368 @@
+// Package api exposes scans over a small REST API so camtruder can be
+// driven by orchestration platforms.
+//
+// Routes:
+//
+//	POST /scan               start a scan, returns its id
+//	GET  /scan/{id}          status and the results found so far
+//	GET  /scan/{id}/results  final result set once the scan has finished
+//	GET  /scan/{id}/stream   results as Server-Sent Events
+//
+// Every request must carry "Authorization: Bearer <token>" when a token is
+// configured.
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/output"
+)
+
+// Scan states reported by the API
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// maxRequestSize limits the size of a POST /scan body
+const maxRequestSize = 1 << 20
+
+// ScanRequest is the body of POST /scan. Durations use Go syntax ("5s").
+// Options left empty fall back to the flags the server was started with.
+type ScanRequest struct {
+	Targets       []string `json:"targets"`             // IPs, CIDR ranges or start-end ranges
+	Usernames     []string `json:"usernames,omitempty"` // Built-in list when empty
+	Passwords     []string `json:"passwords,omitempty"` // Built-in list when empty
+	Port          int      `json:"port,omitempty"`
+	Workers       int      `json:"workers,omitempty"`
+	Timeout       string   `json:"timeout,omitempty"` // Connect and read timeout
+	TotalTimeout  string   `json:"total_timeout,omitempty"`
+	RateLimit     float64  `json:"rate_limit,omitempty"`
+	RTSPTransport string   `json:"rtsp_transport,omitempty"`
+	ForceBasic    bool     `json:"force_basic,omitempty"`
+	CheckVulns    bool     `json:"check_vulns,omitempty"`
+	FuzzPaths     bool     `json:"fuzz_paths,omitempty"`
+}
+
+// Runner runs a scan, handing every result to writer. It returns when the
+// scan has finished or ctx is cancelled.
+type Runner func(ctx context.Context, req ScanRequest, writer output.ResultWriter) error
+
+// Options configures a Server
+type Options struct {
+	Token  string // Required bearer token, empty disables authentication
+	Runner Runner
+}
+
+// Status is the body of GET /scan/{id}
+type Status struct {
+	ID         string          `json:"id"`
+	Status     string          `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Found      int             `json:"found"`
+	Results    []output.Result `json:"results"`
+}
+
+// scan is a scan started through the API. It is the result writer of the
+// scan, so results become visible as soon as they are found.
+type scan struct {
+	mu       sync.Mutex
+	id       string
+	status   string
+	err      string
+	started  time.Time
+	finished time.Time
+	results  []output.Result
+	changed  chan struct{} // Closed and replaced on every update
+}
+
+func (sc *scan) Write(r output.Result) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.results = append(sc.results, r)
+	sc.notify()
+	return nil
+}
+
+func (sc *scan) Close() error {
+	return nil
+}
+
+// finish records the outcome of the scan
+func (sc *scan) finish(err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.finished = time.Now()
+	sc.status = StatusCompleted
+	if err != nil {
+		sc.status = StatusFailed
+		sc.err = err.Error()
+	}
+	sc.notify()
+}
+
+// notify wakes up every stream waiting for an update, called with mu held
+func (sc *scan) notify() {
+	close(sc.changed)
+	sc.changed = make(chan struct{})
+}
+
+// snapshot returns the current status, called with mu held
+func (sc *scan) snapshot() Status {
+	status := Status{
+		ID:        sc.id,
+		Status:    sc.status,
+		Error:     sc.err,
+		StartedAt: sc.started,
+		Found:     len(sc.results),
+		Results:   append([]output.Result{}, sc.results...),
+	}
+	if !sc.finished.IsZero() {
+		finished := sc.finished
+		status.FinishedAt = &finished
+	}
+	return status
+}
+
+// Server serves the REST API
+type Server struct {
+	ctx    context.Context
+	token  string
+	runner Runner
+
+	mu    sync.Mutex
+	scans map[string]*scan
+}
+
+// NewServer creates a server whose scans stop when ctx is cancelled
+func NewServer(ctx context.Context, opts Options) *Server {
+	return &Server{
+		ctx:    ctx,
+		token:  opts.Token,
+		runner: opts.Runner,
+		scans:  make(map[string]*scan),
+	}
+}
+
+// ListenAndServe serves the API on addr until ctx is cancelled
+func ListenAndServe(ctx context.Context, addr string, opts Options) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           NewServer(ctx, opts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// ServeHTTP routes API requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="camtruder"`)
+		writeError(w, http.StatusUnauthorized, "invalid or missing API token")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "scan" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "use POST to start a scan")
+			return
+		}
+		s.handleStart(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	sc := s.lookup(parts[1])
+	if sc == nil {
+		writeError(w, http.StatusNotFound, "unknown scan")
+		return
+	}
+
+	switch {
+	case len(parts) == 2:
+		sc.mu.Lock()
+		status := sc.snapshot()
+		sc.mu.Unlock()
+		writeJSON(w, http.StatusOK, status)
+	case parts[2] == "results":
+		s.handleResults(w, sc)
+	case parts[2] == "stream":
+		s.handleStream(w, r, sc)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// authorized checks the bearer token in constant time
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// handleStart starts a scan in the background
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	var req ScanRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	if len(req.Targets) == 0 {
+		writeError(w, http.StatusBadRequest, "targets must not be empty")
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sc := &scan{
+		id:      id,
+		status:  StatusRunning,
+		started: time.Now(),
+		changed: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.scans[id] = sc
+	s.mu.Unlock()
+
+	go func() {
+		sc.finish(s.runner(s.ctx, req, sc))
+	}()
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": id, "status": StatusRunning})
+}
+
+// handleResults returns the result set of a finished scan
+func (s *Server) handleResults(w http.ResponseWriter, sc *scan) {
+	sc.mu.Lock()
+	status := sc.snapshot()
+	sc.mu.Unlock()
+
+	if status.Status == StatusRunning {
+		writeError(w, http.StatusConflict, "scan is still running, use /scan/{id} for partial results")
+		return
+	}
+	writeJSON(w, http.StatusOK, status.Results)
+}
+
+// handleStream sends every result as a "result" event followed by a
+// "done" event carrying the final status
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, sc *scan) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	sent := 0
+	for {
+		sc.mu.Lock()
+		pending := append([]output.Result{}, sc.results[sent:]...)
+		status := sc.status
+		errMsg := sc.err
+		changed := sc.changed
+		sc.mu.Unlock()
+
+		for _, result := range pending {
+			if err := writeEvent(w, "result", result); err != nil {
+				return
+			}
+		}
+		sent += len(pending)
+
+		if status != StatusRunning {
+			writeEvent(w, "done", map[string]string{"status": status, "error": errMsg})
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// lookup returns the scan with the given id, or nil
+func (s *Server) lookup(id string) *scan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scans[id]
+}
+
+// writeEvent writes one Server-Sent Event with a JSON payload
+func writeEvent(w http.ResponseWriter, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+// newID generates a random scan id
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,220 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/output"
+)
+
+// Default number of completed jobs between checkpoint writes
+const DefaultInterval = 1000
+
+// State is the serialized progress of a scan
+type State struct {
+	// ScanID identifies the target and credential set the cursor refers to
+	ScanID string `json:"scan_id"`
+	// Cursor is the number of jobs, in feed order, that have all completed
+	Cursor     int64           `json:"cursor"`
+	LastTarget string          `json:"last_target"`
+	Results    []output.Result `json:"results"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	// SprayAttempts counts the attempts per host of a --spray scan. Jobs
+	// in flight at save time are counted although they run again on
+	// resume, which errs on the side of fewer attempts.
+	SprayAttempts map[string]int `json:"spray_attempts,omitempty"`
+	// OpenTargets are the ip:port pairs the port check found open, in
+	// feed order. It is nil if the scan ran without a port check and
+	// empty if no port was open.
+	OpenTargets []string `json:"open_targets"`
+	// Protocols are the protocols --auto-detect found on open targets
+	// whose port does not tell, by ip:port
+	Protocols map[string]string `json:"protocols,omitempty"`
+}
+
+// ScanID derives a stable identifier for a list of targets and the number
+// of credential pairs tested against them
+func ScanID(targets []string, credCount int) string {
+	h := sha256.New()
+	for _, target := range targets {
+		h.Write([]byte(target))
+		h.Write([]byte{0})
+	}
+	fmt.Fprintf(h, "creds=%d", credCount)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Load reads a checkpoint file. It returns nil without error if the file
+// does not exist.
+func Load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %v", err)
+	}
+	return &state, nil
+}
+
+// Save writes a checkpoint atomically by writing a temporary file in the
+// same directory and renaming it over the target
+func Save(path string, state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %v", err)
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to sync checkpoint: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to replace checkpoint: %v", err)
+	}
+	return nil
+}
+
+// event is either a completed job or a new result
+type event struct {
+	seq    int64
+	target string
+	result *output.Result
+}
+
+// Checkpointer records scan progress in the background. Workers report
+// completed jobs with Done and results through the ResultWriter interface;
+// a single goroutine owns the state and writes it every interval jobs.
+type Checkpointer struct {
+	path     string
+	interval int
+	state    *State
+	events   chan event
+	done     chan struct{}
+	once     sync.Once
+	err      error
+	attempts func() map[string]int // Spray attempt counts saved with the state
+
+	// Jobs completed ahead of the cursor
+	pending map[int64]string
+}
+
+// New creates a Checkpointer that continues from state and starts its
+// background goroutine
+func New(path string, interval int, state *State) *Checkpointer {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	c := &Checkpointer{
+		path:     path,
+		interval: interval,
+		state:    state,
+		events:   make(chan event, 4096),
+		done:     make(chan struct{}),
+		pending:  make(map[int64]string),
+	}
+	go c.run()
+	return c
+}
+
+// Cursor returns the number of jobs already completed when the
+// Checkpointer was created
+func (c *Checkpointer) Cursor() int64 {
+	return c.state.Cursor
+}
+
+// TrackAttempts saves the per-host attempt counts returned by attempts
+// with every checkpoint. It must be called before the first job is done.
+func (c *Checkpointer) TrackAttempts(attempts func() map[string]int) {
+	c.attempts = attempts
+}
+
+// Done records that the job with the given feed sequence number finished
+func (c *Checkpointer) Done(seq int64, target string) {
+	c.events <- event{seq: seq, target: target}
+}
+
+// Write records a result so it survives a restart
+func (c *Checkpointer) Write(r output.Result) error {
+	c.events <- event{result: &r}
+	return nil
+}
+
+// Close drains outstanding events and writes the final checkpoint
+func (c *Checkpointer) Close() error {
+	c.once.Do(func() {
+		close(c.events)
+		<-c.done
+	})
+	return c.err
+}
+
+// run owns the state and persists it every interval completed jobs
+func (c *Checkpointer) run() {
+	defer close(c.done)
+
+	completed := 0
+	for ev := range c.events {
+		if ev.result != nil {
+			c.state.Results = append(c.state.Results, *ev.result)
+			continue
+		}
+
+		c.pending[ev.seq] = ev.target
+		// Advance the cursor over every contiguous completed job
+		for {
+			target, ok := c.pending[c.state.Cursor]
+			if !ok {
+				break
+			}
+			delete(c.pending, c.state.Cursor)
+			c.state.Cursor++
+			c.state.LastTarget = target
+		}
+
+		completed++
+		if completed%c.interval == 0 {
+			c.save()
+		}
+	}
+	c.save()
+}
+
+// save writes the current state, remembering the first error
+func (c *Checkpointer) save() {
+	c.state.UpdatedAt = time.Now()
+	if c.attempts != nil {
+		c.state.SprayAttempts = c.attempts()
+	}
+	if err := Save(c.path, c.state); err != nil && c.err == nil {
+		c.err = err
+	}
+}
@@ -2,37 +2,210 @@ package cli
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/ALW1EZ/camtruder/pkg/checkpoint"
 	"github.com/ALW1EZ/camtruder/pkg/config"
 	"github.com/ALW1EZ/camtruder/pkg/credentials"
+	"github.com/ALW1EZ/camtruder/pkg/creds"
+	"github.com/ALW1EZ/camtruder/pkg/dedup"
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	"github.com/ALW1EZ/camtruder/pkg/discovery"
+	"github.com/ALW1EZ/camtruder/pkg/fingerprint"
+	"github.com/ALW1EZ/camtruder/pkg/fuzz"
+	"github.com/ALW1EZ/camtruder/pkg/geoip"
+	"github.com/ALW1EZ/camtruder/pkg/logging"
+	"github.com/ALW1EZ/camtruder/pkg/media"
+	"github.com/ALW1EZ/camtruder/pkg/monitor"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/ALW1EZ/camtruder/pkg/partition"
+	"github.com/ALW1EZ/camtruder/pkg/portscan"
+	"github.com/ALW1EZ/camtruder/pkg/probe/detect"
+	httpprobe "github.com/ALW1EZ/camtruder/pkg/probe/http"
+	"github.com/ALW1EZ/camtruder/pkg/probe/pelco"
+	"github.com/ALW1EZ/camtruder/pkg/probe/snmp"
+	"github.com/ALW1EZ/camtruder/pkg/progress"
+	"github.com/ALW1EZ/camtruder/pkg/ripe"
+	"github.com/ALW1EZ/camtruder/pkg/rtsp"
 	"github.com/ALW1EZ/camtruder/pkg/scanner"
+	"github.com/ALW1EZ/camtruder/pkg/spray"
+	"github.com/ALW1EZ/camtruder/pkg/store"
+	targetspkg "github.com/ALW1EZ/camtruder/pkg/targets"
+	"github.com/ALW1EZ/camtruder/pkg/throttle"
+	"github.com/ALW1EZ/camtruder/pkg/tui"
 	"github.com/ALW1EZ/camtruder/pkg/utils"
+	"github.com/ALW1EZ/camtruder/pkg/webhook"
 	"github.com/projectdiscovery/gologger"
 	"github.com/projectdiscovery/gologger/levels"
-	"github.com/ALW1EZ/camtruder/pkg/ripe"
-	"github.com/ALW1EZ/camtruder/pkg/media"
+	gologwriter "github.com/projectdiscovery/gologger/writer"
 )
 
 // Options represents command line options
 type Options struct {
-	Target    string
-	UserInput string
-	PassInput string
-	Threads   int
-	Timeout   int
-	Output    string
-	Verbose   bool
-	Port      int
-	SearchOnly bool
-	SearchRaw  bool
-	MediaDir   string // Directory to store screenshots
+	Target             string        `yaml:"target"`
+	UserInput          string        `yaml:"users"`
+	PassInput          string        `yaml:"passwords"`
+	Threads            int           `yaml:"workers"`
+	Timeout            int           `yaml:"timeout"`
+	Output             string        `yaml:"output"`
+	Verbose            bool          `yaml:"verbose"`
+	Port               int           `yaml:"port"`
+	SearchOnly         bool          `yaml:"search"`
+	SearchRaw          bool          `yaml:"search-raw"`
+	MediaDir           string        `yaml:"snapshot-dir"`        // Directory to store screenshots
+	SnapshotTimeout    time.Duration `yaml:"snapshot-timeout"`    // Time allowed for each screenshot
+	OutputFormat       string        `yaml:"output-format"`       // Result encoding: text, json or csv
+	Dedup              bool          `yaml:"dedup"`               // Merge the results of each camera across its ports
+	TargetsFile        string        `yaml:"targets-file"`        // File with one target expression per line
+	Discover           bool          `yaml:"discover"`            // Find targets with ONVIF WS-Discovery
+	DiscoverIface      string        `yaml:"discover-iface"`      // Interface used for discovery probes
+	DiscoverTimeout    time.Duration `yaml:"discover-timeout"`    // How long discovery listens for responses
+	SSDPDiscover       bool          `yaml:"ssdp-discover"`       // Find targets with SSDP/UPnP
+	ConnectTimeout     time.Duration `yaml:"connect-timeout"`     // Per-connection dial timeout
+	ReadTimeout        time.Duration `yaml:"read-timeout"`        // Per-request read timeout
+	TotalTimeout       time.Duration `yaml:"total-timeout"`       // Timeout for the whole scan
+	RateLimit          float64       `yaml:"rate-limit"`          // Maximum probes per second
+	ForceBasic         bool          `yaml:"force-basic"`         // Disable HTTP Digest authentication
+	CheckVulns         bool          `yaml:"check-vulns"`         // Check fingerprinted devices for known vulnerabilities
+	CheckPTZ           bool          `yaml:"check-ptz"`           // Check hits for pan-tilt-zoom control
+	PTZMove            bool          `yaml:"ptz-move"`            // Confirm PTZ control with a test move
+	InspectTLS         bool          `yaml:"inspect-tls"`         // Read the certificate of every TLS port
+	ONVIFEnumerate     bool          `yaml:"onvif-enumerate"`     // List the ONVIF stream URIs of every profile of hits
+	FuzzPaths          bool          `yaml:"fuzz-paths"`          // Try the RTSP path wordlist when no default path works
+	PathsFile          string        `yaml:"paths-file"`          // Extra paths for the fuzzing wordlist
+	RTSPTransport      string        `yaml:"rtsp-transport"`      // RTP transport: tcp, udp or auto
+	CredsFile          string        `yaml:"creds-file"`          // File with username:password lines
+	CredsMode          string        `yaml:"creds-mode"`          // How CredsFile merges with user/password lists
+	CheckpointFile     string        `yaml:"checkpoint-file"`     // File used to save and resume scan progress
+	CheckpointInterval int           `yaml:"checkpoint-interval"` // Completed jobs between checkpoint writes
+	Proxy              string        `yaml:"proxy"`               // socks5:// or http:// proxy for all probes
+	FingerprintsFile   string        `yaml:"fingerprints-file"`   // Extra fingerprint signatures in YAML
+	IPv6MaxHosts       int           `yaml:"ipv6-max-hosts"`      // Addresses taken from one IPv6 range
+	ProxyTest          bool          `yaml:"proxy-test"`          // Verify the proxy before scanning
+	Serve              string        `yaml:"serve"`               // Address of the REST API, empty to scan from the command line
+	APIToken           string        `yaml:"api-token"`           // Bearer token required by the REST API
+	LogFormat          string        `yaml:"log-format"`          // Log encoding on stderr: text or json
+	Interface          string        `yaml:"interface"`           // Interface every probe connection is bound to
+	ListInterfaces     bool          `yaml:"-"`                   // Print the network interfaces and exit
+	TLS                bool          `yaml:"tls"`                 // Use https and rtsps on every port
+	TLSVerify          bool          `yaml:"tls-verify"`          // Verify camera certificates
+	TLSCAFile          string        `yaml:"tls-ca-file"`         // CA bundle for verification, implies TLSVerify
+	TLSClientCert      string        `yaml:"tls-client-cert"`     // Client certificate for mutual TLS
+	TLSClientKey       string        `yaml:"tls-client-key"`      // Key of TLSClientCert
+	NoProgress         bool          `yaml:"no-progress"`         // Disable the progress line on stderr
+	TUI                bool          `yaml:"tui"`                 // Show the interactive dashboard instead of the log
+	DB                 string        `yaml:"db"`                  // SQLite database results are also stored in
+	Query              string        `yaml:"-"`                   // WHERE clause; print matching stored results and exit
+	WebhookURL         string        `yaml:"webhook-url"`         // URL every credential hit is POSTed to
+	WebhookSecret      string        `yaml:"webhook-secret"`      // Key of the webhook HMAC-SHA256 signature
+	Live               bool          `yaml:"live"`                // Print every hit as a JSON line on stdout as soon as it is found
+	LiveURL            string        `yaml:"live-url"`            // URL every hit is POSTed to as a server-sent event
+	ConfigFile         string        `yaml:"-"`                   // YAML file with default options and profiles
+	Profile            string        `yaml:"-"`                   // Profile of ConfigFile applied on top of its defaults
+	DumpConfig         bool          `yaml:"-"`                   // Print the effective options as YAML and exit
+
+	// Spray mode
+	Spray              bool          `yaml:"spray"`                 // Pace credential attempts per host
+	SprayDelay         time.Duration `yaml:"spray-delay"`           // Minimum time between attempts against one host
+	MaxAttemptsPerHost int           `yaml:"max-attempts-per-host"` // Attempts allowed per host, 0 for no limit
+
+	// Port pre-check
+	Ports       string        `yaml:"ports"`         // Ports checked on every host before protocol tests
+	PortTimeout time.Duration `yaml:"port-timeout"`  // Time allowed for one connect probe
+	NoPortCheck bool          `yaml:"no-port-check"` // Test every target without checking its ports
+	AutoDetect  bool          `yaml:"auto-detect"`   // Probe open non-standard ports for the protocol they speak
+
+	// SNMP identification
+	SNMP                bool   `yaml:"snmp"`                  // Query the SNMP agent of every host
+	SNMPCommunitiesFile string `yaml:"snmp-communities-file"` // Extra community strings, one per line
+	SNMPPort            int    `yaml:"snmp-port"`             // Port of the SNMP agents
+	SNMPV3User          string `yaml:"snmp-v3-user"`          // SNMPv3 user name
+	SNMPV3AuthKey       string `yaml:"snmp-v3-auth-key"`      // SNMPv3 authentication passphrase
+
+	// Exclusions
+	ExcludeFile  string `yaml:"exclude-file"`  // File with addresses, ranges and CIDRs that are never probed
+	ExcludeRange string `yaml:"exclude-range"` // Comma separated addresses, ranges and CIDRs that are never probed
+
+	// Port scanner input
+	InputNmap    string `yaml:"input-nmap"`    // nmap -oX report whose open ports are tested without a port check
+	InputMasscan string `yaml:"input-masscan"` // masscan -oB file whose open ports are tested without a port check
+	InputFormat  string `yaml:"input-format"`  // Read stdin as nmap or masscan output instead of addresses
+
+	// Clip recording
+	RecordDuration time.Duration `yaml:"record-duration"` // Length of the clip recorded of every RTSP hit, 0 to disable
+	RecordDir      string        `yaml:"record-dir"`      // Directory to store clips
+	RecordWorkers  int           `yaml:"record-workers"`  // Clips recorded at once
+
+	// Monitoring
+	Monitor         bool          `yaml:"monitor"`       // Re-test the hits of MonitorInput on a schedule instead of scanning
+	MonitorInterval time.Duration `yaml:"interval"`      // Time between two checks of a camera
+	MonitorInput    string        `yaml:"monitor-input"` // JSON result file of the cameras to monitor
+
+	// Passive capture
+	PassiveCapture  string `yaml:"passive-capture"`  // Interface whose traffic is searched for credentials instead of scanning
+	PassiveFile     string `yaml:"passive-file"`     // pcap file searched for credentials instead of scanning
+	PassiveValidate bool   `yaml:"passive-validate"` // Test captured credentials against their camera
+
+	// Subnet partitioning
+	PerSubnetWorkers int `yaml:"per-subnet-workers"` // Workers of each subnet, 0 for one pool shared by all targets
+	PartitionPrefix  int `yaml:"partition-prefix"`   // IPv4 prefix length targets are split by with PerSubnetWorkers
+
+	// Pelco PTZ buses
+	Pelco          bool `yaml:"pelco"`            // Probe serial device servers for Pelco-D and Pelco-P cameras
+	PelcoPort      int  `yaml:"pelco-port"`       // TCP port of the serial device servers
+	PelcoStartAddr int  `yaml:"pelco-start-addr"` // First RS-485 address probed
+	PelcoEndAddr   int  `yaml:"pelco-end-addr"`   // Last RS-485 address probed
+
+	// Geolocation
+	GeoIPDB  string `yaml:"geoip-db"`  // Comma separated MaxMind City, Country or ASN databases
+	GeoIPAPI string `yaml:"geoip-api"` // Online source for addresses the databases do not know
+
+	// Custom HTTP headers
+	Headers []string `yaml:"header"` // "Name: Value" headers sent with every HTTP probe
+	Cookies []string `yaml:"cookie"` // "name=value" cookies sent with every HTTP probe
+
+	// Bandwidth throttling
+	BandwidthLimit   string `yaml:"bandwidth-limit"`    // Outbound rate across all connections, e.g. 10Mbit
+	PerHostBandwidth string `yaml:"per-host-bandwidth"` // Outbound rate to one host
+
+	dialer    dialer.ContextDialer   // Built from Proxy by Run
+	fuzzPaths []string               // Built from FuzzPaths and PathsFile by Run
+	users     []string               // Usernames given by an API request
+	passwords []string               // Passwords given by an API request
+	quiet     bool                   // Suppress banners, set for API scans
+	progress  *progress.Tracker      // Progress line of the running scan, nil if disabled
+	ui        *tui.UI                // Dashboard of the running scan with --tui, nil otherwise
+	spray     *spray.Scheduler       // Paces attempts per host with --spray, nil otherwise
+	localIP   net.IP                 // Source address of --interface, nil for the default route
+	tlsConfig *tls.Config            // Built from the TLS options by Run
+	noFFmpeg  bool                   // ffmpeg is missing, only MJPEG frames and raw H.264 clips are saved
+	ports     []int                  // Parsed from Ports by Run
+	snmp      *snmp.Options          // Built from the SNMP options by Run, nil if disabled
+	pelco     *pelco.Options         // Built from the Pelco options by Run, nil if disabled
+	live      output.ResultWriter    // Sinks of --live and --live-url, nil if neither is given
+	exclude   *targetspkg.Exclusions // Built from ExcludeFile and ExcludeRange by Run, nil if neither is given
+	credList  []creds.Credential     // Pairs reordered per vendor, nil if there are too many or with a checkpoint
+	geo       *geoip.Locator         // Built from the geolocation options by Run
+	headers   map[string]string      // Built from Headers and Cookies by Run, nil if neither is given
+
+	// protocols are the protocols --auto-detect found during the port
+	// check, by ip:port
+	protocols map[string]detect.Protocol
 }
 
 // ParseOptions parses command line flags and returns options
@@ -45,110 +218,449 @@ func ParseOptions() *Options {
 	}
 
 	flag.StringVar(&opts.Target, "t", "", "")
+	flag.StringVar(&opts.Target, "target", "", "")
 	flag.StringVar(&opts.UserInput, "u", "", "")
+	flag.StringVar(&opts.UserInput, "users", "", "")
 	flag.StringVar(&opts.PassInput, "p", "", "")
+	flag.StringVar(&opts.PassInput, "passwords", "", "")
 	flag.IntVar(&opts.Threads, "w", config.DefaultThreads, "")
+	flag.IntVar(&opts.Threads, "workers", config.DefaultThreads, "")
 	flag.IntVar(&opts.Timeout, "to", config.DefaultTimeout, "")
+	flag.IntVar(&opts.Timeout, "timeout", config.DefaultTimeout, "")
 	flag.StringVar(&opts.Output, "o", "", "")
+	flag.StringVar(&opts.Output, "output", "", "")
 	flag.BoolVar(&opts.Verbose, "v", false, "")
+	flag.BoolVar(&opts.Verbose, "verbose", false, "")
 	flag.BoolVar(&opts.SearchOnly, "s", false, "")
+	flag.BoolVar(&opts.SearchOnly, "search", false, "")
 	flag.BoolVar(&opts.SearchRaw, "ss", false, "")
+	flag.BoolVar(&opts.SearchRaw, "search-raw", false, "")
 	flag.IntVar(&opts.Port, "po", config.DefaultPort, "")
+	flag.IntVar(&opts.Port, "port", config.DefaultPort, "")
 	flag.StringVar(&opts.MediaDir, "m", "", "")
+	flag.StringVar(&opts.MediaDir, "snapshot-dir", "", "")
+	flag.DurationVar(&opts.SnapshotTimeout, "snapshot-timeout", config.DefaultSnapshotTimeout, "")
+	flag.StringVar(&opts.OutputFormat, "output-format", output.FormatText, "")
+	flag.BoolVar(&opts.Dedup, "dedup", false, "")
+	flag.StringVar(&opts.TargetsFile, "targets-file", "", "")
+	flag.BoolVar(&opts.Discover, "discover", false, "")
+	flag.StringVar(&opts.DiscoverIface, "discover-iface", "", "")
+	flag.DurationVar(&opts.DiscoverTimeout, "discover-timeout", config.DefaultDiscoverTimeout, "")
+	flag.BoolVar(&opts.SSDPDiscover, "ssdp-discover", false, "")
+	flag.DurationVar(&opts.ConnectTimeout, "connect-timeout", 0, "")
+	flag.DurationVar(&opts.ReadTimeout, "read-timeout", 0, "")
+	flag.DurationVar(&opts.TotalTimeout, "total-timeout", 0, "")
+	flag.Float64Var(&opts.RateLimit, "rate-limit", 0, "")
+	flag.BoolVar(&opts.ForceBasic, "force-basic", false, "")
+	flag.BoolVar(&opts.CheckVulns, "check-vulns", false, "")
+	flag.BoolVar(&opts.CheckPTZ, "check-ptz", false, "")
+	flag.BoolVar(&opts.PTZMove, "ptz-move", false, "")
+	flag.BoolVar(&opts.InspectTLS, "inspect-tls", false, "")
+	flag.BoolVar(&opts.ONVIFEnumerate, "onvif-enumerate", false, "")
+	flag.BoolVar(&opts.FuzzPaths, "fuzz-paths", false, "")
+	flag.StringVar(&opts.PathsFile, "paths-file", "", "")
+	flag.StringVar(&opts.RTSPTransport, "rtsp-transport", rtsp.TransportTCP, "")
+	flag.StringVar(&opts.CredsFile, "creds-file", "", "")
+	flag.StringVar(&opts.CredsMode, "creds-mode", creds.ModeAppend, "")
+	flag.StringVar(&opts.CheckpointFile, "checkpoint-file", "", "")
+	flag.IntVar(&opts.CheckpointInterval, "checkpoint-interval", checkpoint.DefaultInterval, "")
+	flag.StringVar(&opts.Proxy, "proxy", "", "")
+	flag.StringVar(&opts.FingerprintsFile, "fingerprints-file", "", "")
+	flag.IntVar(&opts.IPv6MaxHosts, "ipv6-max-hosts", targetspkg.DefaultIPv6MaxHosts, "")
+	flag.BoolVar(&opts.ProxyTest, "proxy-test", false, "")
+	flag.StringVar(&opts.Serve, "serve", "", "")
+	flag.StringVar(&opts.APIToken, "api-token", "", "")
+	flag.StringVar(&opts.LogFormat, "log-format", logging.FormatText, "")
+	flag.BoolVar(&opts.NoProgress, "no-progress", false, "")
+	flag.BoolVar(&opts.TUI, "tui", false, "")
+	flag.StringVar(&opts.DB, "db", "", "")
+	flag.StringVar(&opts.Query, "query", "", "")
+	flag.StringVar(&opts.WebhookURL, "webhook-url", "", "")
+	flag.StringVar(&opts.WebhookSecret, "webhook-secret", "", "")
+	flag.BoolVar(&opts.Live, "live", false, "")
+	flag.StringVar(&opts.LiveURL, "live-url", "", "")
+	flag.StringVar(&opts.Interface, "interface", "", "")
+	flag.BoolVar(&opts.ListInterfaces, "list-interfaces", false, "")
+	flag.BoolVar(&opts.TLS, "tls", false, "")
+	flag.BoolVar(&opts.TLSVerify, "tls-verify", false, "")
+	flag.StringVar(&opts.TLSCAFile, "tls-ca-file", "", "")
+	flag.StringVar(&opts.TLSClientCert, "tls-client-cert", "", "")
+	flag.StringVar(&opts.TLSClientKey, "tls-client-key", "", "")
+	flag.BoolVar(&opts.Spray, "spray", false, "")
+	flag.DurationVar(&opts.SprayDelay, "spray-delay", spray.DefaultDelay, "")
+	flag.IntVar(&opts.MaxAttemptsPerHost, "max-attempts-per-host", 0, "")
+	flag.StringVar(&opts.Ports, "ports", portscan.FormatPorts(portscan.DefaultPorts), "")
+	flag.DurationVar(&opts.PortTimeout, "port-timeout", portscan.DefaultTimeout, "")
+	flag.BoolVar(&opts.NoPortCheck, "no-port-check", false, "")
+	flag.BoolVar(&opts.AutoDetect, "auto-detect", false, "")
+	flag.BoolVar(&opts.SNMP, "snmp", false, "")
+	flag.StringVar(&opts.SNMPCommunitiesFile, "snmp-communities-file", "", "")
+	flag.IntVar(&opts.SNMPPort, "snmp-port", snmp.DefaultPort, "")
+	flag.StringVar(&opts.SNMPV3User, "snmp-v3-user", "", "")
+	flag.StringVar(&opts.SNMPV3AuthKey, "snmp-v3-auth-key", "", "")
+	flag.StringVar(&opts.ExcludeFile, "exclude-file", "", "")
+	flag.StringVar(&opts.ExcludeRange, "exclude-range", "", "")
+	flag.StringVar(&opts.InputNmap, "input-nmap", "", "")
+	flag.StringVar(&opts.InputMasscan, "input-masscan", "", "")
+	flag.StringVar(&opts.InputFormat, "input-format", "", "")
+	flag.DurationVar(&opts.RecordDuration, "record-duration", 0, "")
+	flag.StringVar(&opts.RecordDir, "record-dir", config.DefaultRecordDir, "")
+	flag.IntVar(&opts.RecordWorkers, "record-workers", config.DefaultRecordWorkers, "")
+	flag.BoolVar(&opts.Monitor, "monitor", false, "")
+	flag.DurationVar(&opts.MonitorInterval, "interval", monitor.DefaultInterval, "")
+	flag.StringVar(&opts.MonitorInput, "monitor-input", "", "")
+	flag.StringVar(&opts.PassiveCapture, "passive-capture", "", "")
+	flag.StringVar(&opts.PassiveFile, "passive-file", "", "")
+	flag.BoolVar(&opts.PassiveValidate, "passive-validate", false, "")
+	flag.IntVar(&opts.PerSubnetWorkers, "per-subnet-workers", 0, "")
+	flag.IntVar(&opts.PartitionPrefix, "partition-prefix", partition.DefaultPrefix, "")
+	flag.BoolVar(&opts.Pelco, "pelco", false, "")
+	flag.IntVar(&opts.PelcoPort, "pelco-port", pelco.DefaultPort, "")
+	flag.IntVar(&opts.PelcoStartAddr, "pelco-start-addr", pelco.DefaultStartAddr, "")
+	flag.IntVar(&opts.PelcoEndAddr, "pelco-end-addr", pelco.DefaultEndAddr, "")
+	flag.StringVar(&opts.GeoIPDB, "geoip-db", "", "")
+	flag.StringVar(&opts.GeoIPAPI, "geoip-api", "", "")
+	flag.Var((*stringList)(&opts.Headers), "header", "")
+	flag.Var((*stringList)(&opts.Cookies), "cookie", "")
+	flag.StringVar(&opts.BandwidthLimit, "bandwidth-limit", "", "")
+	flag.StringVar(&opts.PerHostBandwidth, "per-host-bandwidth", "", "")
+	flag.StringVar(&opts.ConfigFile, "config", "", "")
+	flag.StringVar(&opts.Profile, "profile", "", "")
+	flag.BoolVar(&opts.DumpConfig, "dump-config", false, "")
 	flag.Parse()
 
-	// Check for ffmpeg if screenshot directory is specified
-	if opts.MediaDir != "" && !media.CheckFFmpegAvailable() {
-		fmt.Printf("%sError: ffmpeg is required for taking screenshots but was not found in PATH%s\n",
-			config.ColorRed, config.ColorReset)
-		fmt.Printf("%sPlease install ffmpeg to use the screenshot feature (-m option)%s\n",
-			config.ColorYellow, config.ColorReset)
+	// Merge the config file before logging is set up, it may select the
+	// log format
+	configErr := applyConfig(opts)
+
+	// Configure logging before anything is logged
+	gologger.DefaultLogger.SetMaxLevel(levels.LevelDebug)
+	if err := logging.Setup(opts.LogFormat, opts.Verbose); err != nil {
+		slog.Error("invalid options", "error", err)
 		os.Exit(1)
 	}
+	if configErr != nil {
+		slog.Error("invalid config", "error", configErr)
+		os.Exit(1)
+	}
+
+	if opts.DumpConfig {
+		if err := dumpConfig(os.Stdout, opts); err != nil {
+			slog.Error("failed to dump config", "error", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Check for ffmpeg if screenshots or clips are requested; scanning still
+	// works without it, only the RTSP screenshots are skipped and clips are
+	// saved as raw H.264
+	if (opts.MediaDir != "" || opts.RecordDuration > 0) && !media.CheckFFmpegAvailable() {
+		if opts.MediaDir != "" {
+			gologger.Warning().Msgf("ffmpeg was not found in PATH, RTSP screenshots are disabled")
+			gologger.Warning().Msgf("Please install ffmpeg to use the screenshot feature (-m option)")
+		}
+		if opts.RecordDuration > 0 {
+			gologger.Warning().Msgf("ffmpeg was not found in PATH, clips are saved as raw H.264 (.h264) instead of .mp4")
+		}
+		opts.noFFmpeg = true
+	}
 
 	return opts
 }
 
+// RunMode is what Run does with the options
+type RunMode int
+
+// Run modes, selected by Mode
+const (
+	ModeScan           RunMode = iota // Scan the targets, the default
+	ModeListInterfaces                // List the interfaces usable with --interface
+	ModeQuery                         // Print stored results
+	ModeServe                         // Serve the REST API
+	ModeMonitor                       // Re-test earlier hits on a schedule
+	ModePassive                       // Read credentials from captured traffic
+)
+
+// Mode returns the run mode the options select. A query or the API take
+// precedence over monitoring, and monitoring over passive capture.
+func (opts *Options) Mode() RunMode {
+	switch {
+	case opts.ListInterfaces:
+		return ModeListInterfaces
+	case opts.Query != "":
+		return ModeQuery
+	case opts.Serve != "":
+		return ModeServe
+	case opts.Monitor:
+		return ModeMonitor
+	case opts.PassiveCapture != "" || opts.PassiveFile != "":
+		return ModePassive
+	default:
+		return ModeScan
+	}
+}
+
 // Run executes the scanner with the given options
 func Run(opts *Options) error {
-	// Configure gologger
-	gologger.DefaultLogger.SetMaxLevel(levels.LevelDebug)
+	// Stop gracefully on Ctrl-C or SIGTERM so progress can be saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Get credentials list first
-	var users, passwords []string
-	if opts.UserInput != "" {
-		users = credentials.ParseInput(opts.UserInput)
-		if users == nil {
-			return fmt.Errorf("invalid username input")
+	mode := opts.Mode()
+	switch mode {
+	case ModeListInterfaces:
+		return listInterfaces()
+	case ModeQuery:
+		// Print stored results instead of scanning
+		return runQuery(opts)
+	case ModeServe:
+		// Serve the REST API instead of scanning from the command line
+		if err := prepare(opts); err != nil {
+			return err
 		}
-	} else {
-		users = credentials.DefaultUsers
+		defer opts.geo.Close()
+		return serve(ctx, opts)
 	}
 
-	if opts.PassInput != "" {
-		passwords = credentials.ParseInput(opts.PassInput)
-		if passwords == nil {
-			return fmt.Errorf("invalid password input")
-		}
-	} else {
-		passwords = credentials.DefaultPasswords
+	// Bound the whole run if a total timeout is given
+	if opts.TotalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.TotalTimeout)
+		defer cancel()
+	}
+
+	if err := prepare(opts); err != nil {
+		return err
+	}
+	defer opts.geo.Close()
+
+	// Watch the cameras of an earlier scan instead of scanning
+	if mode == ModeMonitor {
+		return runMonitor(ctx, opts)
+	}
+
+	if opts.Live && opts.TUI {
+		return fmt.Errorf("--live and --tui cannot be combined, both use stdout")
+	}
+
+	credSource, credCount, err := credentialSource(opts)
+	if err != nil {
+		return err
 	}
 
 	// Create output file if specified
 	var outFile *os.File
 	if opts.Output != "" {
-		var err error
-		outFile, err = os.Create(opts.Output)
+		if opts.CheckpointFile != "" && fileExists(opts.CheckpointFile) {
+			// Resuming a scan keeps the results written by the earlier run
+			outFile, err = os.OpenFile(opts.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		} else {
+			outFile, err = os.Create(opts.Output)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to create output file: %v", err)
 		}
 		defer outFile.Close()
 	}
 
+	// Select the result writer; structured formats go to stdout when no
+	// output file is given so they can be piped into other tools
+	writer, err := newResultWriter(opts, outFile)
+	if err != nil {
+		return err
+	}
+
+	// Keep every result in the database as well
+	if opts.DB != "" {
+		db, err := store.Open(opts.DB)
+		if err != nil {
+			writer.Close()
+			return err
+		}
+		writer = output.Multi(writer, db)
+	}
+
+	// Push credential hits to the webhook in the background
+	if opts.WebhookURL != "" {
+		sender, err := webhook.New(webhook.Options{
+			URL:    opts.WebhookURL,
+			Secret: opts.WebhookSecret,
+		})
+		if err != nil {
+			writer.Close()
+			return fmt.Errorf("--webhook-url: %v", err)
+		}
+		writer = output.Multi(writer, sender)
+	}
+	defer writer.Close()
+
+	// Hand hits to the --live sinks as soon as they are found
+	if opts.Live || opts.LiveURL != "" {
+		var live []output.ResultWriter
+		if opts.Live {
+			stdout, _ := output.NewWriter(output.FormatJSON, os.Stdout)
+			live = append(live, stdout)
+		}
+		if opts.LiveURL != "" {
+			sender, err := webhook.New(webhook.Options{
+				URL:    opts.LiveURL,
+				Secret: opts.WebhookSecret,
+				SSE:    true,
+			})
+			if err != nil {
+				return fmt.Errorf("--live-url: %v", err)
+			}
+			live = append(live, sender)
+		}
+		opts.live = output.Multi(live...)
+		defer opts.live.Close()
+	}
+
+	// Read credentials off the wire instead of scanning
+	if mode == ModePassive {
+		return runPassive(ctx, opts, writer)
+	}
+
 	// Process targets
 	var targets []string
-	if opts.Target == "" {
+	targetOpts := targetspkg.Options{
+		IPv6MaxHosts: opts.IPv6MaxHosts,
+		Warnf: func(format string, args ...interface{}) {
+			gologger.Warning().Msgf(format, args...)
+		},
+	}
+	addIPs := func(ips []net.IP) {
+		for _, ip := range ips {
+			targets = append(targets, utils.FormatTarget(ip.String(), opts.Port))
+		}
+	}
+
+	if opts.TargetsFile != "" {
+		ips, err := targetspkg.ReadFile(opts.TargetsFile, targetOpts)
+		if err != nil {
+			return err
+		}
+		addIPs(ips)
+	}
+
+	if opts.Discover {
+		devices, err := discovery.Discover(opts.DiscoverIface, opts.DiscoverTimeout)
+		if err != nil {
+			return fmt.Errorf("ONVIF discovery failed: %v", err)
+		}
+		gologger.Info().Msgf("Discovered %d ONVIF device(s)", len(devices))
+		for _, device := range devices {
+			if opts.Verbose {
+				gologger.Info().Label("ONVIF").Msgf("%s:%d %s", device.IP, device.Port, strings.Join(device.XAddrs, " "))
+			}
+			targets = append(targets, utils.FormatTarget(device.IP, opts.Port))
+		}
+	}
+
+	if opts.SSDPDiscover {
+		devices, err := discovery.DiscoverSSDP(opts.DiscoverIface, opts.DiscoverTimeout)
+		if err != nil {
+			return fmt.Errorf("SSDP discovery failed: %v", err)
+		}
+		gologger.Info().Msgf("Discovered %d UPnP camera(s)", len(devices))
+		for _, device := range devices {
+			if opts.Verbose {
+				gologger.Info().Label("SSDP").Msgf("%s %s %s [%s]", device.IP, device.Manufacturer, device.ModelName, device.PresentationURL)
+			}
+			targets = append(targets, utils.FormatTarget(device.IP, opts.Port))
+			// Queue the web interface as well so its credentials get tested
+			if u, err := url.Parse(device.PresentationURL); err == nil && u.Hostname() != "" {
+				port := 80
+				if u.Port() != "" {
+					port, _ = strconv.Atoi(u.Port())
+				} else if u.Scheme == "https" {
+					port = 443
+				}
+				targets = append(targets, utils.FormatTarget(u.Hostname(), port))
+			}
+		}
+	}
+
+	// Ports found open by nmap or masscan are tested without a port check
+	var imported []string
+	for _, input := range []struct{ path, format string }{
+		{opts.InputNmap, targetspkg.FormatNmap},
+		{opts.InputMasscan, targetspkg.FormatMasscan},
+	} {
+		if input.path == "" {
+			continue
+		}
+		file, err := os.Open(input.path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s input: %v", input.format, err)
+		}
+		services, err := targetspkg.Import(file, input.format)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", input.path, err)
+		}
+		imported = append(imported, cameraServices(services, opts)...)
+	}
+
+	if opts.Target == "" && opts.TargetsFile == "" && !opts.Discover && !opts.SSDPDiscover &&
+		opts.InputNmap == "" && opts.InputMasscan == "" {
 		stat, _ := os.Stdin.Stat()
 		if (stat.Mode() & os.ModeCharDevice) != 0 {
 			flag.Usage()
 			os.Exit(1)
 		}
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			// Strip port if present in the input
-			input := scanner.Text()
-			if strings.Contains(input, ":") {
-				input = strings.Split(input, ":")[0]
+		if opts.InputFormat != "" {
+			services, err := targetspkg.Import(os.Stdin, opts.InputFormat)
+			if err != nil {
+				return fmt.Errorf("stdin: %v", err)
 			}
-			expanded := utils.ExpandCIDR(input)
-			for _, ip := range expanded {
-				targets = append(targets, utils.FormatIP(ip))
+			imported = append(imported, cameraServices(services, opts)...)
+		} else {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				// Strip port if present in the input. Bare IPv6 addresses
+				// fail to split and are kept as they are.
+				input := strings.TrimSpace(scanner.Text())
+				if host, _, err := net.SplitHostPort(input); err == nil {
+					input = host
+				}
+				if input == "" {
+					continue
+				}
+				ips, err := targetspkg.ExpandWithOptions(input, targetOpts)
+				if err != nil {
+					if opts.Verbose {
+						gologger.Warning().Msgf("Skipping invalid input %q: %v", input, err)
+					}
+					continue
+				}
+				addIPs(ips)
 			}
 		}
-	} else {
+	} else if opts.Target != "" {
 		// Check if target is a number (limit for found cameras)
 		if limit, err := strconv.Atoi(opts.Target); err == nil {
-			return runInternetScan(limit, users, passwords, opts, outFile)
+			if err := checkProxy(ctx, opts, ""); err != nil {
+				return err
+			}
+			return runInternetScan(ctx, limit, credSource, credCount, opts, writer)
 		} else if _, err := os.Stat(opts.Target); err == nil {
 			// Reading from file
-			lines := credentials.ParseInput(opts.Target)
-			for _, line := range lines {
-				expanded := utils.ExpandCIDR(line)
-				for _, ip := range expanded {
-					targets = append(targets, utils.FormatIP(ip))
-				}
+			ips, err := targetspkg.ReadFile(opts.Target, targetOpts)
+			if err != nil {
+				return err
 			}
+			addIPs(ips)
 		} else {
-			// First try to parse as IP/CIDR
-			expanded := utils.ExpandCIDR(opts.Target)
-			if len(expanded) > 0 {
+			// First try to parse as IP, CIDR or IP range expression
+			expanded, err := targetspkg.ExpandWithOptions(opts.Target, targetOpts)
+			if err == nil {
 				// Successfully parsed as IP/CIDR
 				if opts.SearchOnly || opts.Verbose {
-					fmt.Printf("[ %s ] [ %s ] [%d]\n", "DIRECT_IP", opts.Target, len(expanded))
-				}
-				for _, ip := range expanded {
-					targets = append(targets, utils.FormatIP(ip))
+					fmt.Fprintf(notice(opts), "[ %s ] [ %s ] [%d]\n", "DIRECT_IP", opts.Target, len(expanded))
 				}
+				addIPs(expanded)
 			} else {
 				// If not IP/CIDR, try location-based search
 				ranges, err := ripe.SearchByLocation(opts.Target)
@@ -176,11 +688,11 @@ func Run(opts *Options) error {
 								ips := utils.ExpandIPRange(start, end)
 								totalIPs += len(ips)
 								cidrRange := utils.RangeToCIDR(start, end)
-								fmt.Printf("[ %s ] [ %s ] [%d]\n", ipRange.Netname, cidrRange, len(ips))
+								fmt.Fprintf(notice(opts), "[ %s ] [ %s ] [%d]\n", ipRange.Netname, cidrRange, len(ips))
 							} else {
 								// Single IP
 								totalIPs++
-								fmt.Printf("[ %s ] [ %s ] [1]\n", ipRange.Netname, ipRange.Range)
+								fmt.Fprintf(notice(opts), "[ %s ] [ %s ] [1]\n", ipRange.Netname, ipRange.Range)
 							}
 						}
 					}
@@ -191,18 +703,18 @@ func Run(opts *Options) error {
 						if len(startEnd) == 2 {
 							ips := utils.ExpandIPRange(strings.TrimSpace(startEnd[0]), strings.TrimSpace(startEnd[1]))
 							for _, ip := range ips {
-								targets = append(targets, utils.FormatIP(ip))
+								targets = append(targets, utils.FormatTarget(ip, opts.Port))
 							}
 						} else {
-							targets = append(targets, utils.FormatIP(ipRange.Range))
+							targets = append(targets, utils.FormatTarget(ipRange.Range, opts.Port))
 						}
 					}
 				} else if opts.SearchOnly || opts.Verbose {
 					if err != nil {
-						fmt.Printf("%s Failed to search location: %v%s\n",
+						fmt.Fprintf(notice(opts), "%s Failed to search location: %v%s\n",
 							config.ColorRed, err, config.ColorReset)
 					} else {
-						fmt.Printf("%s No IP ranges found for location: %s%s\n",
+						fmt.Fprintf(notice(opts), "%s No IP ranges found for location: %s%s\n",
 							config.ColorYellow, opts.Target, config.ColorReset)
 					}
 				}
@@ -215,34 +727,572 @@ func Run(opts *Options) error {
 		}
 	}
 
-	if len(targets) == 0 {
+	if len(targets) == 0 && len(imported) == 0 {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	return runTargetScan(targets, users, passwords, opts, outFile)
+	if err := checkProxy(ctx, opts, append(targets, imported...)[0]); err != nil {
+		return err
+	}
+
+	return runTargetScan(ctx, targets, imported, credSource, credCount, opts, writer)
+}
+
+// listInterfaces prints the network interfaces usable with --interface
+func listInterfaces() error {
+	ifaces, err := dialer.Interfaces()
+	if err != nil {
+		return err
+	}
+	for _, iface := range ifaces {
+		state := "down"
+		if iface.Up {
+			state = "up"
+		}
+		addrs := make([]string, 0, len(iface.Addrs))
+		for _, ip := range iface.Addrs {
+			addrs = append(addrs, ip.String())
+		}
+		if len(addrs) == 0 {
+			addrs = append(addrs, "no address")
+		}
+		fmt.Printf("[ %s ] [ %s ] %s\n", iface.Name, state, strings.Join(addrs, ", "))
+	}
+	return nil
+}
+
+// runQuery prints the stored results matching opts.Query
+func runQuery(opts *Options) error {
+	if opts.DB == "" {
+		return fmt.Errorf("--query requires --db")
+	}
+	db, err := store.Open(opts.DB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(opts.Query)
+	if err != nil {
+		return err
+	}
+	if err := store.WriteTable(os.Stdout, rows); err != nil {
+		return err
+	}
+	gologger.Info().Msgf("%d result(s)", len(rows))
+	return nil
+}
+
+// prepare loads the files and builds the dialer the scan options refer to
+func prepare(opts *Options) error {
+	// Load user fingerprint signatures before any probe runs
+	if opts.FingerprintsFile != "" {
+		if err := fingerprint.LoadFile(opts.FingerprintsFile); err != nil {
+			return err
+		}
+	}
+
+	// A paths file only makes sense for fuzzing, so it enables it
+	if opts.FuzzPaths || opts.PathsFile != "" {
+		paths, err := fuzz.Paths(opts.PathsFile, config.DefaultPaths)
+		if err != nil {
+			return err
+		}
+		opts.fuzzPaths = paths
+	}
+
+	if opts.RecordDuration < 0 {
+		return fmt.Errorf("--record-duration must not be negative")
+	}
+	if opts.RecordWorkers < 1 {
+		return fmt.Errorf("--record-workers must be at least 1")
+	}
+
+	transport, err := rtsp.ParseTransport(opts.RTSPTransport)
+	if err != nil {
+		return err
+	}
+	opts.RTSPTransport = transport
+
+	opts.ports, err = portscan.ParsePorts(opts.Ports)
+	if err != nil {
+		return fmt.Errorf("invalid --ports: %v", err)
+	}
+
+	opts.exclude, err = targetspkg.LoadExclusions(opts.ExcludeFile, opts.ExcludeRange)
+	if err != nil {
+		return err
+	}
+
+	if opts.Dedup && opts.OutputFormat != output.FormatText && opts.OutputFormat != output.FormatJSON {
+		return fmt.Errorf("--dedup writes text or json, not %s", opts.OutputFormat)
+	}
+
+	opts.headers, err = httpprobe.ParseHeaders(opts.Headers, opts.Cookies)
+	if err != nil {
+		return err
+	}
+
+	if opts.Monitor {
+		if opts.MonitorInput == "" {
+			return fmt.Errorf("--monitor needs --monitor-input")
+		}
+		if opts.MonitorInterval <= 0 {
+			return fmt.Errorf("invalid --interval %s", opts.MonitorInterval)
+		}
+	}
+
+	if opts.PassiveCapture != "" && opts.PassiveFile != "" {
+		return fmt.Errorf("--passive-capture and --passive-file cannot be combined")
+	}
+
+	if opts.PerSubnetWorkers < 0 {
+		return fmt.Errorf("invalid --per-subnet-workers %d", opts.PerSubnetWorkers)
+	}
+	if err := partition.ValidatePrefix(opts.PartitionPrefix); err != nil {
+		return fmt.Errorf("--partition-prefix: %v", err)
+	}
+
+	if opts.Pelco {
+		if err := pelco.ValidateRange(opts.PelcoStartAddr, opts.PelcoEndAddr); err != nil {
+			return fmt.Errorf("--pelco-start-addr/--pelco-end-addr: %v", err)
+		}
+		if opts.PelcoPort < 1 || opts.PelcoPort > 65535 {
+			return fmt.Errorf("invalid --pelco-port %d", opts.PelcoPort)
+		}
+		opts.pelco = &pelco.Options{
+			Port:      opts.PelcoPort,
+			StartAddr: opts.PelcoStartAddr,
+			EndAddr:   opts.PelcoEndAddr,
+		}
+	}
+
+	if opts.PTZMove {
+		gologger.Warning().Msgf("--ptz-move pans every PTZ camera found and sends it to its home position")
+	}
+
+	// A communities file or v3 user only makes sense with SNMP, so they
+	// enable it
+	if opts.SNMP || opts.SNMPCommunitiesFile != "" || opts.SNMPV3User != "" {
+		communities, err := snmp.LoadCommunities(opts.SNMPCommunitiesFile)
+		if err != nil {
+			return err
+		}
+		opts.snmp = &snmp.Options{
+			Port:        opts.SNMPPort,
+			Timeout:     probeTimeouts(opts).Read,
+			Communities: communities,
+			V3User:      opts.SNMPV3User,
+			V3AuthKey:   opts.SNMPV3AuthKey,
+		}
+	}
+
+	// Bind probes to the chosen interface; discovery uses it as well
+	// unless it was given its own
+	if opts.Interface != "" {
+		opts.localIP, err = dialer.InterfaceIP(opts.Interface)
+		if err != nil {
+			return err
+		}
+		if opts.DiscoverIface == "" {
+			opts.DiscoverIface = opts.Interface
+		}
+		gologger.Info().Msgf("Binding connections to %s (%s)", opts.Interface, opts.localIP)
+		if opts.MediaDir != "" {
+			gologger.Warning().Msgf("Screenshots are taken by ffmpeg, which uses the default route and not %s", opts.Interface)
+		}
+	}
+
+	opts.tlsConfig, err = dialer.NewTLSConfig(dialer.TLSOptions{
+		Verify:     opts.TLSVerify,
+		CAFile:     opts.TLSCAFile,
+		ClientCert: opts.TLSClientCert,
+		ClientKey:  opts.TLSClientKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.snmp != nil {
+		opts.snmp.LocalIP = opts.localIP
+	}
+
+	// Route every probe connection through the proxy if one is given
+	opts.dialer, err = dialer.New(opts.Proxy, probeTimeouts(opts).Connect, opts.localIP)
+	if err != nil {
+		return err
+	}
+	if opts.Proxy != "" {
+		// RTP over UDP would bypass the proxy
+		if opts.RTSPTransport != rtsp.TransportTCP {
+			gologger.Warning().Msgf("RTP over UDP cannot use a proxy, using --rtsp-transport tcp")
+			opts.RTSPTransport = rtsp.TransportTCP
+		}
+		if opts.Discover || opts.SSDPDiscover {
+			gologger.Warning().Msgf("Multicast discovery cannot use a proxy and is sent from the local network")
+		}
+		if opts.MediaDir != "" {
+			gologger.Warning().Msgf("Screenshots are taken by ffmpeg directly and do not use the proxy")
+		}
+		if opts.snmp != nil {
+			gologger.Warning().Msgf("SNMP runs over UDP and is sent directly, not through the proxy")
+		}
+	}
+
+	// Throttle every probe connection once the dialer is final
+	limits, err := bandwidthLimits(opts)
+	if err != nil {
+		return err
+	}
+	throttled := throttle.New(limits)
+	if throttled != nil {
+		opts.dialer = throttled.Dialer(opts.dialer)
+		if opts.MediaDir != "" {
+			gologger.Warning().Msgf("Screenshots are taken by ffmpeg directly and do not count against the bandwidth limit")
+		}
+	}
+
+	// Raw clips are read through the probe dialer, ffmpeg connects itself
+	if opts.RecordDuration > 0 && !opts.noFFmpeg && (opts.Proxy != "" || opts.Interface != "" || throttled != nil) {
+		gologger.Warning().Msgf("Clips are recorded by ffmpeg directly and do not use the proxy, interface or bandwidth limit")
+	}
+
+	opts.geo, err = newLocator(opts)
+	return err
 }
 
-func runInternetScan(limit int, users, passwords []string, opts *Options, outFile *os.File) error {
+// newLocator opens the --geoip-db databases. Without a database hits are
+// located online through hackertarget unless --geoip-api says otherwise;
+// with one, the API is only asked when it is given explicitly, so scans
+// with a database stay offline.
+func newLocator(opts *Options) (*geoip.Locator, error) {
+	var paths []string
+	for _, path := range strings.Split(opts.GeoIPDB, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	api := opts.GeoIPAPI
+	if api == "" && len(paths) == 0 {
+		api = geoip.APIHackerTarget
+	}
+	locator, err := geoip.New(geoip.Options{
+		DBPaths: paths,
+		API:     api,
+		Dialer:  opts.dialer,
+		Timeout: probeTimeouts(opts).Connect + probeTimeouts(opts).Read,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("--geoip-db/--geoip-api: %v", err)
+	}
+	return locator, nil
+}
+
+// bandwidthLimits parses --bandwidth-limit and --per-host-bandwidth
+func bandwidthLimits(opts *Options) (throttle.Options, error) {
+	var limits throttle.Options
+	var err error
+	if opts.BandwidthLimit != "" {
+		if limits.Rate, err = throttle.ParseRate(opts.BandwidthLimit); err != nil {
+			return limits, fmt.Errorf("--bandwidth-limit: %v", err)
+		}
+	}
+	if opts.PerHostBandwidth != "" {
+		if limits.PerHostRate, err = throttle.ParseRate(opts.PerHostBandwidth); err != nil {
+			return limits, fmt.Errorf("--per-host-bandwidth: %v", err)
+		}
+	}
+	return limits, nil
+}
+
+// maxPrioritizedCreds bounds the pairs kept in memory to reorder them per
+// vendor; larger credential files are streamed in their own order
+const maxPrioritizedCreds = 100000
+
+// credentialSource builds the credentials to test from the options and
+// counts them
+func credentialSource(opts *Options) (creds.Source, int, error) {
+	// Get credentials list first
+	var users, passwords []string
+	if opts.users != nil {
+		users = opts.users
+	} else if opts.UserInput != "" {
+		users = credentials.ParseInput(opts.UserInput)
+		if users == nil {
+			return nil, 0, fmt.Errorf("invalid username input")
+		}
+	} else {
+		users = credentials.DefaultUsers
+	}
+
+	if opts.passwords != nil {
+		passwords = opts.passwords
+	} else if opts.PassInput != "" {
+		passwords = credentials.ParseInput(opts.PassInput)
+		if passwords == nil {
+			return nil, 0, fmt.Errorf("invalid password input")
+		}
+	} else {
+		passwords = credentials.DefaultPasswords
+	}
+
+	// Merge in the credentials file if given
+	credSource := creds.FromLists(users, passwords)
+	if opts.CredsFile != "" {
+		switch opts.CredsMode {
+		case creds.ModeAppend:
+			credSource = creds.Concat(credSource, creds.FromFile(opts.CredsFile))
+		case creds.ModeReplace:
+			credSource = creds.FromFile(opts.CredsFile)
+		default:
+			return nil, 0, fmt.Errorf("invalid credentials mode: %s (use %s or %s)", opts.CredsMode, creds.ModeAppend, creds.ModeReplace)
+		}
+	}
+	credCount, err := creds.Count(credSource)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Hosts of a known vendor get its default pairs first. A checkpoint
+	// resumes by job number, so checkpointed scans keep the plain order.
+	opts.credList = nil
+	if credCount <= maxPrioritizedCreds && opts.CheckpointFile == "" {
+		opts.credList = make([]creds.Credential, 0, credCount)
+		err = credSource(func(cred creds.Credential) bool {
+			opts.credList = append(opts.credList, cred)
+			return true
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return credSource, credCount, nil
+}
+
+// checkProxy verifies the proxy when --proxy-test is given
+func checkProxy(ctx context.Context, opts *Options, target string) error {
+	if !opts.ProxyTest {
+		return nil
+	}
+	if opts.Proxy == "" {
+		return fmt.Errorf("--proxy-test requires --proxy")
+	}
+
+	if err := dialer.Test(ctx, opts.Proxy, opts.dialer, target, probeTimeouts(opts).Connect, opts.localIP); err != nil {
+		return fmt.Errorf("proxy test failed: %v", err)
+	}
+	gologger.Info().Msgf("Proxy %s is working", opts.Proxy)
+	return nil
+}
+
+// newResultWriter creates the result writer selected by the output format
+func newResultWriter(opts *Options, outFile *os.File) (output.ResultWriter, error) {
+	if opts.Dedup && (outFile != nil || !opts.Live) {
+		// Cameras are written merged once the scan is over
+		var w io.Writer = os.Stdout
+		if outFile != nil {
+			w = outFile
+		}
+		return dedup.NewWriter(opts.OutputFormat, w)
+	}
+	if outFile != nil {
+		return output.NewWriter(opts.OutputFormat, outFile)
+	}
+	if opts.Live {
+		// Stdout already carries every hit as a JSON line
+		return output.Discard, nil
+	}
+	if opts.OutputFormat == "" || opts.OutputFormat == output.FormatText {
+		// Text results are already shown on the console
+		return output.Discard, nil
+	}
+	return output.NewWriter(opts.OutputFormat, os.Stdout)
+}
+
+// quietStdout reports whether the banner must be left out because stdout
+// carries structured results or logs are JSON
+func quietStdout(opts *Options) bool {
+	return opts.quiet || logging.JSON() || opts.Live || (opts.Output == "" && opts.OutputFormat != "" && opts.OutputFormat != output.FormatText)
+}
+
+// notice returns where informational lines go: stdout, or stderr while
+// stdout carries results. Search mode output stays on stdout.
+func notice(opts *Options) io.Writer {
+	if quietStdout(opts) && !opts.SearchOnly {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// probeTimeouts derives the per-stage timeouts, falling back to -to
+func probeTimeouts(opts *Options) rtsp.Timeouts {
+	timeouts := rtsp.Timeouts{
+		Connect: opts.ConnectTimeout,
+		Read:    opts.ReadTimeout,
+	}
+	if timeouts.Connect <= 0 {
+		timeouts.Connect = time.Duration(opts.Timeout) * time.Second
+	}
+	if timeouts.Read <= 0 {
+		timeouts.Read = time.Duration(opts.Timeout) * time.Second
+	}
+	return timeouts
+}
+
+// newScanner creates a scanner configured from the command line options
+func newScanner(opts *Options, writer output.ResultWriter, limit int32) *scanner.Scanner {
+	return scanner.NewScanner(scanner.Options{
+		Verbose:         opts.Verbose,
+		Writer:          writer,
+		Timeouts:        probeTimeouts(opts),
+		TargetLimit:     limit,
+		MediaDir:        opts.MediaDir,
+		SnapshotTimeout: opts.SnapshotTimeout,
+		NoFFmpeg:        opts.noFFmpeg,
+		RateLimit:       opts.RateLimit,
+		ForceBasic:      opts.ForceBasic,
+		Headers:         opts.headers,
+		CheckVulns:      opts.CheckVulns,
+		FuzzPaths:       opts.fuzzPaths,
+		RTSPTransport:   opts.RTSPTransport,
+		Dialer:          opts.dialer,
+		Progress:        opts.progress,
+		TLS:             opts.TLS,
+		TLSConfig:       opts.tlsConfig,
+		SNMP:            opts.snmp,
+		CheckPTZ:        opts.CheckPTZ,
+		PTZMove:         opts.PTZMove,
+		Live:            opts.live,
+		Exclude:         opts.exclude,
+		InspectTLS:      opts.InspectTLS,
+		ONVIFEnumerate:  opts.ONVIFEnumerate,
+		Pelco:           opts.pelco,
+		Credentials:     opts.credList,
+		RecordDir:       opts.RecordDir,
+		RecordDuration:  opts.RecordDuration,
+		RecordWorkers:   opts.RecordWorkers,
+		GeoIP:           opts.geo,
+		Protocols:       opts.protocols,
+		Spray:           opts.spray,
+	})
+}
+
+// startProgress starts the progress line on stderr and wraps writer so
+// results are counted and kept off the progress line. It does nothing with
+// --no-progress, for API scans, or when stderr carries JSON logs.
+func startProgress(opts *Options, writer output.ResultWriter, credCount int, cancel context.CancelFunc) output.ResultWriter {
+	if opts.quiet || logging.JSON() {
+		return writer
+	}
+	if opts.TUI {
+		if tui.Supported() {
+			return startTUI(opts, writer, credCount, cancel)
+		}
+		gologger.Warning().Msgf("The dashboard needs $TERM and a terminal on stdout, using plain output")
+	}
+	if opts.NoProgress {
+		return writer
+	}
+	opts.progress = progress.New(os.Stderr, progress.DefaultInterval)
+	gologger.DefaultLogger.SetWriter(opts.progress.Logs(gologwriter.NewCLI()))
+	opts.progress.Start()
+	return opts.progress.Results(writer)
+}
+
+// startTUI shows the --tui dashboard in place of the progress line and
+// the log. Quitting it cancels the scan.
+func startTUI(opts *Options, writer output.ResultWriter, credCount int, cancel context.CancelFunc) output.ResultWriter {
+	title := opts.Target
+	if title == "" {
+		title = "discovered targets"
+	}
+	opts.progress = progress.New(nil, progress.DefaultInterval)
+	opts.ui = tui.New(tui.Options{
+		Title:       title,
+		Tracker:     opts.progress,
+		ChecksPerIP: credCount,
+		Cancel:      cancel,
+	})
+	gologger.DefaultLogger.SetWriter(opts.ui.Logs())
+	opts.progress.Start()
+	opts.ui.Start()
+	return opts.ui.Results(opts.progress.Results(writer))
+}
+
+// startSpray creates the per-host attempt scheduler with --spray,
+// continuing from attempts made in an earlier run
+func startSpray(opts *Options, attempts map[string]int) {
+	if !opts.Spray {
+		return
+	}
+	opts.spray = spray.New(spray.Options{
+		Delay:       opts.SprayDelay,
+		MaxAttempts: opts.MaxAttemptsPerHost,
+		Attempts:    attempts,
+	})
+}
+
+// stopProgress prints the final progress line and restores the log writer
+func stopProgress(opts *Options) {
+	if opts.progress == nil {
+		return
+	}
+	opts.progress.Stop()
+	opts.progress = nil
+
+	// The dashboard stays open until the operator closes it; its results
+	// are listed afterwards so they stay in the scrollback
+	if opts.ui != nil {
+		opts.ui.Finish()
+		gologger.DefaultLogger.SetWriter(gologwriter.NewCLI())
+		hits := opts.ui.Hits()
+		opts.ui = nil
+		for _, hit := range hits {
+			if hit.Vulnerability != "" {
+				fmt.Printf("%s [%s] %s:%d%s\n", config.ColorRed, hit.Vulnerability, hit.IP, hit.Port, config.ColorReset)
+			} else {
+				fmt.Println(hit.URL)
+			}
+		}
+		gologger.Info().Msgf("%d result(s)", len(hits))
+		return
+	}
+	gologger.DefaultLogger.SetWriter(gologwriter.NewCLI())
+}
+
+func runInternetScan(ctx context.Context, limit int, credSource creds.Source, credCount int, opts *Options, writer output.ResultWriter) error {
 	if opts.Verbose {
-		fmt.Printf("%s Scanning internet until finding %d vulnerable cameras...%s\n",
+		fmt.Fprintf(notice(opts), "%s Scanning internet until finding %d vulnerable cameras...%s\n",
 			config.ColorBold, limit, config.ColorReset)
 	}
 
-	utils.DisplayInternetScanBanner(limit, len(users), len(passwords), opts.Threads, opts.Output)
+	if !quietStdout(opts) {
+		utils.DisplayInternetScanBanner(limit, credCount, opts.Threads, opts.Output)
+	}
+
+	if opts.CheckpointFile != "" {
+		gologger.Warning().Msgf("Checkpoints are not supported for internet scans, ignoring --checkpoint-file")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer = startProgress(opts, writer, credCount, cancel)
+	defer stopProgress(opts)
+	startSpray(opts, nil)
 
 	// Create scanner
-	s := scanner.NewScanner(opts.Verbose, outFile, time.Duration(opts.Timeout)*time.Second, int32(limit), opts.MediaDir)
+	s := newScanner(opts, writer, int32(limit))
 
-	for s.GetFoundCount() < int32(limit) {
+	for s.GetFoundCount() < int32(limit) && ctx.Err() == nil {
 		// Find IPs with open port
 		if opts.Verbose {
-			fmt.Printf("%s Searching for %d hosts with port %d open...%s\n",
+			fmt.Fprintf(notice(opts), "%s Searching for %d hosts with port %d open...%s\n",
 				config.ColorBold, int32(limit)-s.GetFoundCount(), opts.Port, config.ColorReset)
 		}
 		targets := s.FindOpenPorts(int32(limit) - s.GetFoundCount())
 		if opts.Verbose {
-			fmt.Printf("%s Found %d hosts with port %d open%s\n",
+			fmt.Fprintf(notice(opts), "%s Found %d hosts with port %d open%s\n",
 				config.ColorBold, len(targets), opts.Port, config.ColorReset)
 		}
 
@@ -250,7 +1300,7 @@ func runInternetScan(limit int, users, passwords []string, opts *Options, outFil
 			continue
 		}
 
-		if err := scanTargets(targets, users, passwords, s, opts); err != nil {
+		if err := scanTargets(ctx, targets, credSource, credCount, s, opts, nil); err != nil {
 			return err
 		}
 	}
@@ -258,58 +1308,464 @@ func runInternetScan(limit int, users, passwords []string, opts *Options, outFil
 	return nil
 }
 
-func runTargetScan(targets, users, passwords []string, opts *Options, outFile *os.File) error {
-	utils.DisplayTargetBanner(len(targets), len(users), len(passwords), opts.Threads, opts.Output)
+// runTargetScan tests targets, after checking which of their ports are
+// open, and open, the ports another scanner already found open
+func runTargetScan(ctx context.Context, targets, open []string, credSource creds.Source, credCount int, opts *Options, writer output.ResultWriter) error {
+	// Excluded hosts are dropped before the port check so they never see
+	// a single packet
+	targets = excludeTargets(targets, opts)
+	open = excludeTargets(open, opts)
+	if len(targets) == 0 && len(open) == 0 {
+		gologger.Info().Msgf("Every target is excluded, nothing to test")
+		return nil
+	}
+
+	if !quietStdout(opts) {
+		utils.DisplayTargetBanner(len(targets)+len(open), credCount, opts.Threads, opts.Output)
+	}
+
+	// Resume from the checkpoint file if it belongs to this scan. The scan
+	// is identified by the targets before the port check.
+	var state *checkpoint.State
+	resumed := false
+	if opts.CheckpointFile != "" {
+		scanID := checkpoint.ScanID(append(append([]string(nil), targets...), open...), credCount)
+		var err error
+		state, err = checkpoint.Load(opts.CheckpointFile)
+		if err != nil {
+			return err
+		}
+		if state != nil && state.ScanID != scanID {
+			gologger.Warning().Msgf("Checkpoint %s belongs to a different scan, starting over", opts.CheckpointFile)
+			state = nil
+		}
+		if state == nil {
+			state = &checkpoint.State{ScanID: scanID}
+		} else {
+			resumed = true
+		}
+	}
+
+	// Only hosts with an open port are handed to the protocol tests. A
+	// resumed scan keeps the targets of the first run so its cursor still
+	// applies.
+	switch {
+	case resumed && state.OpenTargets != nil:
+		targets = state.OpenTargets
+		if state.Protocols != nil {
+			opts.protocols = make(map[string]detect.Protocol, len(state.Protocols))
+			for target, protocol := range state.Protocols {
+				opts.protocols[target] = detect.Protocol(protocol)
+			}
+		}
+	case resumed || opts.NoPortCheck || len(targets) == 0:
+		targets = append(targets, open...)
+	default:
+		checked, protocols, err := checkPorts(ctx, targets, opts)
+		if err != nil {
+			// Nothing is saved yet, so a resumed scan checks the ports again
+			if ctx.Err() != nil {
+				logStop(ctx)
+				return nil
+			}
+			return err
+		}
+		targets = append(checked, open...)
+		if len(targets) == 0 {
+			gologger.Info().Msgf("No open ports found, nothing to test")
+			return nil
+		}
+		opts.protocols = protocols
+		if state != nil {
+			state.OpenTargets = targets
+			for target, protocol := range protocols {
+				if state.Protocols == nil {
+					state.Protocols = make(map[string]string, len(protocols))
+				}
+				state.Protocols[target] = string(protocol)
+			}
+		}
+	}
+
+	var cp *checkpoint.Checkpointer
+	var previous []output.Result
+	var attempts map[string]int
+	if state != nil {
+		if resumed {
+			gologger.Info().Msgf("Resuming from checkpoint: %d jobs done, last target %s, %d results so far",
+				state.Cursor, state.LastTarget, len(state.Results))
+			previous = state.Results
+			attempts = state.SprayAttempts
+		}
+		cp = checkpoint.New(opts.CheckpointFile, opts.CheckpointInterval, state)
+		writer = output.Multi(writer, cp)
+	}
+
+	// Spray attempt counts are saved with the checkpoint so a resumed scan
+	// keeps honouring --max-attempts-per-host
+	startSpray(opts, attempts)
+	if cp != nil && opts.spray != nil {
+		cp.TrackAttempts(opts.spray.Attempts)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer = startProgress(opts, writer, credCount, cancel)
+	defer stopProgress(opts)
 
 	// Create scanner
-	s := scanner.NewScanner(opts.Verbose, outFile, time.Duration(opts.Timeout)*time.Second, 0, opts.MediaDir)
+	s := newScanner(opts, writer, 0)
+	for _, result := range previous {
+		s.MarkFound(utils.FormatTarget(result.IP, result.Port))
+	}
 
-	return scanTargets(targets, users, passwords, s, opts)
+	err := scanTargets(ctx, targets, credSource, credCount, s, opts, cp)
+	if cp != nil {
+		if cpErr := cp.Close(); cpErr != nil {
+			gologger.Warning().Msgf("Failed to save checkpoint: %v", cpErr)
+		}
+	}
+	return err
 }
 
-func scanTargets(targets, users, passwords []string, s *scanner.Scanner, opts *Options) error {
-	// Create work channel and wait group
-	work := make(chan struct {
-		IP   string
-		Cred credentials.Credentials
-		Path string
+// excludeTargets drops the targets whose host is excluded
+func excludeTargets(targets []string, opts *Options) []string {
+	if opts.exclude == nil {
+		return targets
+	}
+	kept := targets[:0:0]
+	for _, target := range targets {
+		if !opts.exclude.ContainsHost(target) {
+			kept = append(kept, target)
+		}
+	}
+	if excluded := len(targets) - len(kept); excluded > 0 {
+		gologger.Info().Msgf("Excluded %d of %d targets", excluded, len(targets))
+	}
+	return kept
+}
+
+// cameraServices keeps the imported ip:port services on ports cameras
+// listen on: the known RTSP and web ports, --ports and -po
+func cameraServices(services []string, opts *Options) []string {
+	kept := services[:0]
+	for _, service := range services {
+		_, port := utils.SplitHostPort(service)
+		if cameraPort(port, opts) {
+			kept = append(kept, service)
+		}
+	}
+	if dropped := len(services) - len(kept); dropped > 0 && opts.Verbose {
+		gologger.Info().Msgf("Skipping %d imported services on non-camera ports", dropped)
+	}
+	return kept
+}
+
+// cameraPort reports whether port is one cameras typically listen on
+func cameraPort(port int, opts *Options) bool {
+	if port == opts.Port {
+		return true
+	}
+	if knownPort(port) || (opts.Pelco && port == opts.PelcoPort) {
+		return true
+	}
+	for _, p := range opts.ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// knownPort reports whether the protocol of port is known from its number
+func knownPort(port int) bool {
+	for _, ports := range [][]int{config.RTSPPorts, config.RTSPSPorts, config.HTTPPorts, config.HTTPSPorts} {
+		for _, p := range ports {
+			if p == port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkPorts probes the ports of targets and returns the open ip:port
+// pairs. Every target's own port is checked along with --ports; a -po port
+// other than the default replaces the default --ports set so piped scans
+// of one port stay on it. With --pelco, the serial device server port is
+// checked too. With --auto-detect, open ports whose number does not tell
+// their protocol are probed for it; the protocols found are returned by
+// target and the ports no protocol answered on are dropped.
+func checkPorts(ctx context.Context, targets []string, opts *Options) ([]string, map[string]detect.Protocol, error) {
+	ports := opts.ports
+	if opts.Port != config.DefaultPort && opts.Ports == portscan.FormatPorts(portscan.DefaultPorts) {
+		ports = nil
+	}
+	if opts.Pelco {
+		ports = append(append([]int(nil), ports...), opts.PelcoPort)
+	}
+
+	var classify func(ctx context.Context, target string) bool
+	var protocols map[string]detect.Protocol
+	var mu sync.Mutex
+	var dropped int
+	if opts.AutoDetect {
+		protocols = make(map[string]detect.Protocol)
+		detector := detect.New(detect.Options{
+			Timeout:   probeTimeouts(opts).Read,
+			Dialer:    opts.dialer,
+			TLS:       opts.TLS,
+			TLSConfig: opts.tlsConfig,
+		})
+		classify = func(ctx context.Context, target string) bool {
+			if _, port := utils.SplitHostPort(target); knownPort(port) || (opts.Pelco && port == opts.PelcoPort) {
+				return true
+			}
+			protocol, err := detector.Detect(ctx, target)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				dropped++
+				if opts.Verbose {
+					gologger.Debug().Label("DETECT").Msgf("%s: %v, skipping", target, err)
+				}
+				return false
+			}
+			protocols[target] = protocol
+			if opts.Verbose {
+				gologger.Debug().Label("DETECT").Msgf("%s speaks %s", target, strings.ToUpper(string(protocol)))
+			}
+			return true
+		}
+	}
+
+	start := time.Now()
+	open, err := portscan.Check(ctx, targets, portscan.Options{
+		Ports:   ports,
+		Timeout: opts.PortTimeout,
+		Workers: config.MaxParallelChecks,
+		Dialer:  opts.dialer,
+		OnOpen: func(target string) {
+			if opts.Verbose {
+				gologger.Debug().Label("PORT").Msgf("%s is open", target)
+			}
+		},
+		Classify: classify,
 	})
-	var wg sync.WaitGroup
+	if err != nil {
+		return nil, nil, err
+	}
+	gologger.Info().Msgf("Port check: %d of %d hosts have open ports (%d services) in %s",
+		portscan.Hosts(open), portscan.Hosts(targets), len(open), time.Since(start).Round(time.Millisecond))
+	if opts.AutoDetect && len(protocols)+dropped > 0 {
+		gologger.Info().Msgf("Auto-detect: identified %d non-standard ports, skipped %d without a known protocol",
+			len(protocols), dropped)
+	}
+	return open, protocols, nil
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
 
-	// Start worker threads
+func scanTargets(ctx context.Context, targets []string, credSource creds.Source, credCount int, s *scanner.Scanner, opts *Options, cp *checkpoint.Checkpointer) error {
+	// Semaphore bounding the number of concurrent checks
 	actualThreads := opts.Threads
+	if actualThreads < 1 {
+		actualThreads = 1
+	}
 	if actualThreads > config.MaxParallelChecks {
 		actualThreads = config.MaxParallelChecks
-		fmt.Printf("%s Limiting parallel checks to %d for better performance%s\n",
+		fmt.Fprintf(notice(opts), "%s Limiting parallel checks to %d for better performance%s\n",
 			config.ColorYellow, config.MaxParallelChecks, config.ColorReset)
 	}
+	sem := make(chan struct{}, actualThreads)
+	var wg sync.WaitGroup
 
-	for i := 0; i < actualThreads; i++ {
-		wg.Add(1)
-		go s.Worker(work, &wg)
+	// Jobs before the checkpoint cursor finished in an earlier run
+	var seq, cursor int64
+	if cp != nil {
+		cursor = cp.Cursor()
+	}
+	opts.progress.AddTotal(int64(len(targets)) * int64(credCount))
+	opts.progress.Skip(cursor)
+
+	if opts.PerSubnetWorkers > 0 {
+		err := scanSubnets(ctx, targets, credSource, s, opts, cp, sem, cursor)
+		s.Wait()
+		logStop(ctx)
+		return err
 	}
 
 	// Feed work
-	for _, user := range users {
-		for _, pass := range passwords {
-			for _, ip := range targets {
-				work <- struct {
-					IP   string
-					Cred credentials.Credentials
-					Path string
-				}{
-					IP: ip,
-					Cred: credentials.Credentials{
-						Username: user,
-						Password: pass,
-					},
-					Path: "/",
+	err := credSource(func(cred credentials.Credentials) bool {
+		for _, ip := range targets {
+			jobSeq := seq
+			seq++
+			if jobSeq < cursor {
+				continue
+			}
+			if s.LimitReached() {
+				return false
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return false
+			}
+
+			job := scanner.Job{
+				IP:   ip,
+				Cred: cred,
+				Path: "/",
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				runJob(ctx, job, jobSeq, s, opts, cp)
+			}()
+		}
+		return true
+	})
+	wg.Wait()
+
+	// Let background screenshots finish and flush their results
+	s.Wait()
+
+	logStop(ctx)
+	return err
+}
+
+// runJob tests one target with one pair and records that it finished
+func runJob(ctx context.Context, job scanner.Job, jobSeq int64, s *scanner.Scanner, opts *Options, cp *checkpoint.Checkpointer) {
+	// Logins are paced with --spray inside Scan, per request
+	s.Scan(ctx, job)
+	if ctx.Err() == nil {
+		opts.progress.Done()
+	}
+	// Interrupted jobs are not recorded so they run again on resume
+	if cp != nil && ctx.Err() == nil {
+		cp.Done(jobSeq, job.IP)
+	}
+}
+
+// subnetBacklog is how many pairs may queue up for a subnet, which is how
+// far a slow subnet may fall behind the others before the feed waits for it
+const subnetBacklog = 8
+
+// scanSubnets splits targets by subnet and feeds every subnet on its own,
+// through a pool of --per-subnet-workers workers. The credential source is
+// walked once and every pair is queued for each subnet, so a slow subnet
+// never takes more than its own share of the sem slots shared by all
+// subnets while the others run up to subnetBacklog pairs ahead. Jobs keep
+// the sequence numbers of the single feed, pair after pair across all
+// targets, so checkpoints carry over between both modes.
+func scanSubnets(ctx context.Context, targets []string, credSource creds.Source, s *scanner.Scanner, opts *Options, cp *checkpoint.Checkpointer, sem chan struct{}, cursor int64) error {
+	subnets := partition.Split(targets, opts.PartitionPrefix)
+	if opts.Verbose {
+		gologger.Debug().Label("SUBNET").Msgf("Scanning %d subnets with %d workers each", len(subnets), opts.PerSubnetWorkers)
+	}
+
+	scanners := make([]*partition.SubnetScanner, len(subnets))
+	feeds := make([]chan credentials.Credentials, len(subnets))
+	var wg sync.WaitGroup
+	for i, subnet := range subnets {
+		sub := partition.NewSubnetScanner(subnet, opts.PerSubnetWorkers)
+		scanners[i] = sub
+		feed := make(chan credentials.Credentials, subnetBacklog)
+		feeds[i] = feed
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var pair int64
+			stopped := false
+			// A stopped subnet keeps draining its feed so the feed never
+			// waits for it
+			for cred := range feed {
+				for j, ip := range sub.Subnet.Targets {
+					if stopped {
+						break
+					}
+					jobSeq := pair*int64(len(targets)) + int64(sub.Subnet.Positions[j])
+					if jobSeq < cursor {
+						continue
+					}
+					if s.LimitReached() {
+						stopped = true
+						break
+					}
+					job := scanner.Job{
+						IP:   ip,
+						Cred: cred,
+						Path: "/",
+					}
+					stopped = !sub.Go(ctx, sem, func() {
+						runJob(ctx, job, jobSeq, s, opts, cp)
+					})
 				}
+				pair++
 			}
+			sub.Wait()
+		}()
+	}
+
+	err := credSource(func(cred credentials.Credentials) bool {
+		if s.LimitReached() || ctx.Err() != nil {
+			return false
+		}
+		for _, feed := range feeds {
+			feed <- cred
 		}
+		return true
+	})
+	for _, feed := range feeds {
+		close(feed)
 	}
-	close(work)
 	wg.Wait()
+	logSubnets(scanners, s)
+	return err
+}
 
-	return nil
+// logSubnets prints the timing of every subnet, slowest first
+func logSubnets(scanners []*partition.SubnetScanner, s *scanner.Scanner) {
+	stats := make([]partition.Stats, len(scanners))
+	hits := make(map[string]int, len(scanners))
+	for i, sub := range scanners {
+		stats[i] = sub.Stats()
+		for _, target := range sub.Subnet.Targets {
+			if s.Found(target) {
+				hits[stats[i].Subnet]++
+			}
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Elapsed > stats[j].Elapsed
+	})
+
+	for _, stat := range stats {
+		if logging.JSON() {
+			slog.Info("subnet finished",
+				"subnet", stat.Subnet,
+				"targets", stat.Targets,
+				"checks", stat.Jobs,
+				"hits", hits[stat.Subnet],
+				"elapsed", stat.Elapsed.Round(time.Millisecond).String())
+			continue
+		}
+		gologger.Info().Msgf("Subnet %s: %d targets, %d checks, %d hits in %s",
+			stat.Subnet, stat.Targets, stat.Jobs, hits[stat.Subnet], stat.Elapsed.Round(time.Millisecond))
+	}
+}
+
+// logStop reports why the scan stopped early, if it did
+func logStop(ctx context.Context) {
+	if ctx.Err() == context.DeadlineExceeded {
+		gologger.Warning().Msgf("Total timeout reached, stopping scan")
+	} else if ctx.Err() != nil {
+		gologger.Warning().Msgf("Interrupted, stopping scan")
+	}
 }
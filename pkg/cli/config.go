@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the layout of a --config file. Every option can be set at
+// the top level using its long flag name; profiles hold named sets of
+// options applied on top of them.
+//
+//	workers: 100
+//	connect-timeout: 3s
+//	profiles:
+//	  hikvision-audit:
+//	    port: 80
+//	    check-vulns: true
+type configFile struct {
+	Options  `yaml:",inline"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// applyConfig merges opts.ConfigFile and the selected profile into opts.
+// Precedence is command line flags, then the profile, then the top level
+// of the file, then the flag defaults.
+func applyConfig(opts *Options) error {
+	if opts.ConfigFile == "" {
+		if opts.Profile != "" {
+			return fmt.Errorf("--profile requires --config")
+		}
+		return nil
+	}
+
+	// Remember the flags given on the command line to re-apply them
+	explicit := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	data, err := os.ReadFile(opts.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	cf := configFile{Options: *opts}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cf); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %v", opts.ConfigFile, err)
+	}
+
+	if opts.Profile != "" {
+		node, ok := cf.Profiles[opts.Profile]
+		if !ok {
+			return fmt.Errorf("profile %q not found in %s (available: %s)", opts.Profile, opts.ConfigFile, strings.Join(profileNames(cf.Profiles), ", "))
+		}
+		// Node.Decode ignores unknown keys, so the profile is decoded from
+		// its own YAML with the same checks as the top level
+		profile, err := yaml.Marshal(&node)
+		if err != nil {
+			return fmt.Errorf("failed to parse profile %q: %v", opts.Profile, err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(profile))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cf.Options); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse profile %q: %v", opts.Profile, err)
+		}
+	}
+
+	*opts = cf.Options
+	for name, value := range explicit {
+		// Repeated flags replace the list of the file as a whole
+		if list, ok := flag.Lookup(name).Value.(*stringList); ok {
+			*list = strings.Split(value, "\n")
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// profileNames lists the profiles of a config file
+func profileNames(profiles map[string]yaml.Node) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	return names
+}
+
+// dumpConfig writes the effective options as a config file. Every key is
+// annotated with its type and default, generated from the yaml struct tags
+// and the flag registered under the same name.
+func dumpConfig(w io.Writer, opts *Options) error {
+	effective := *opts
+	if effective.APIToken != "" {
+		effective.APIToken = "<redacted>"
+	}
+	if effective.WebhookSecret != "" {
+		effective.WebhookSecret = "<redacted>"
+	}
+	if effective.SNMPV3AuthKey != "" {
+		effective.SNMPV3AuthKey = "<redacted>"
+	}
+	// Headers and cookies often carry session tokens, only their names
+	// are kept
+	effective.Headers = redactValues(opts.Headers, ":")
+	effective.Cookies = redactValues(opts.Cookies, "=")
+	effective.Proxy = redactUserinfo(opts.Proxy)
+
+	var node yaml.Node
+	if err := node.Encode(&effective); err != nil {
+		return err
+	}
+
+	types := make(map[string]reflect.Type)
+	t := reflect.TypeOf(Options{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if tag := strings.Split(field.Tag.Get("yaml"), ",")[0]; tag != "" && tag != "-" {
+			types[tag] = field.Type
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		comment := configType(types[key.Value])
+		if f := flag.Lookup(key.Value); f != nil && f.DefValue != "" {
+			comment += ", default " + f.DefValue
+		}
+		key.HeadComment = comment
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// redactValues replaces the value after sep of every entry, so "Name:
+// value" becomes "Name:<redacted>"
+func redactValues(entries []string, sep string) []string {
+	if entries == nil {
+		return nil
+	}
+	redacted := make([]string, len(entries))
+	for i, entry := range entries {
+		name, _, _ := strings.Cut(entry, sep)
+		redacted[i] = name + sep + "<redacted>"
+	}
+	return redacted
+}
+
+// redactUserinfo replaces the credentials of a proxy URL, if it has any
+func redactUserinfo(rawURL string) string {
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return rawURL
+	}
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	at := strings.LastIndex(rest[:end], "@")
+	if at < 0 {
+		return rawURL
+	}
+	return scheme + "://<redacted>" + rest[at:]
+}
+
+// configType names the YAML type of an option
+func configType(t reflect.Type) string {
+	if t == nil {
+		return "unknown"
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return "duration"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice:
+		return "list"
+	default:
+		return "string"
+	}
+}
+
+// stringList is a flag that may be given more than once, every value is
+// appended to the list
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, "\n")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
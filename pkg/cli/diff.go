@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ALW1EZ/camtruder/pkg/diff"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+)
+
+// Diff runs "camtruder diff [--format text|json] old.json new.json",
+// comparing two JSON result files
+func Diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	format := fs.String("format", diff.FormatText, "")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: camtruder diff [--format text|json] old.json new.json\n")
+	}
+
+	// Flags may come before, between or after the two files
+	var files []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		files = append(files, args[0])
+		args = args[1:]
+	}
+	if len(files) != 2 {
+		fs.Usage()
+		return fmt.Errorf("diff needs exactly two result files")
+	}
+
+	oldResults, err := output.ReadJSONFile(files[0])
+	if err != nil {
+		return err
+	}
+	newResults, err := output.ReadJSONFile(files[1])
+	if err != nil {
+		return err
+	}
+	return diff.Write(os.Stdout, diff.Compare(oldResults, newResults), *format)
+}
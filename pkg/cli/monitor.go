@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/monitor"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+	"github.com/projectdiscovery/gologger"
+)
+
+// runMonitor re-tests the hits of --monitor-input every --interval until
+// it is interrupted and writes the changes to stdout, one JSON event per
+// line. On SIGTERM or Ctrl-C the checks in flight finish and their events
+// are written before it returns.
+func runMonitor(ctx context.Context, opts *Options) error {
+	results, err := output.ReadJSONFile(opts.MonitorInput)
+	if err != nil {
+		return err
+	}
+	mon := monitor.New(results, monitor.Options{
+		Timeouts:  probeTimeouts(opts),
+		Dialer:    opts.dialer,
+		TLSConfig: opts.tlsConfig,
+		Transport: opts.RTSPTransport,
+		Workers:   opts.Threads,
+		Interval:  opts.MonitorInterval,
+		Headers:   opts.headers,
+	})
+	if mon.Len() == 0 {
+		return fmt.Errorf("%s has no credential hits to monitor", opts.MonitorInput)
+	}
+	gologger.Info().Msgf("Monitoring %d cameras every %s", mon.Len(), opts.MonitorInterval)
+
+	enc := json.NewEncoder(os.Stdout)
+	ticker := time.NewTicker(opts.MonitorInterval)
+	defer ticker.Stop()
+	for round := 1; ; round++ {
+		events, stats := mon.Check(ctx)
+		for _, event := range events {
+			if err := enc.Encode(event); err != nil {
+				return fmt.Errorf("failed to write event: %v", err)
+			}
+			if opts.Verbose {
+				gologger.Debug().Label("MONITOR").Msgf("%s %s %s", utils.FormatTarget(event.IP, event.Port), event.Protocol, event.Event)
+			}
+		}
+		gologger.Info().Msgf("Check %d: %d checked, %d up, %d rejecting their credentials, %d unreachable, %d change(s)",
+			round, stats.Checked, stats.Up, stats.Rejected, stats.Down, len(events))
+
+		select {
+		case <-ctx.Done():
+			gologger.Info().Msgf("Stopped monitoring after %d checks", round)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
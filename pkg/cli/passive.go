@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/ALW1EZ/camtruder/pkg/config"
+	"github.com/ALW1EZ/camtruder/pkg/logging"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/ALW1EZ/camtruder/pkg/passive"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+	"github.com/ALW1EZ/camtruder/pkg/validate"
+	"github.com/projectdiscovery/gologger"
+)
+
+// runPassive reads credentials from the traffic of --passive-capture or
+// --passive-file instead of scanning and writes them as results. With
+// --passive-validate every pair is tested against its camera first, at
+// most --workers at once, and marked with whether it worked.
+func runPassive(ctx context.Context, opts *Options, writer output.ResultWriter) error {
+	ports := append([]int(nil), passive.DefaultPorts...)
+	if opts.Port != config.DefaultPort {
+		ports = append(ports, opts.Port)
+	}
+	source := opts.PassiveFile
+	if source == "" {
+		source = "interface " + opts.PassiveCapture
+	}
+	gologger.Info().Msgf("Reading camera credentials from %s (%s)", source, passive.Filter(ports))
+
+	var validator *validate.Validator
+	workers := opts.Threads
+	if workers < 1 {
+		workers = 1
+	}
+	if opts.PassiveValidate {
+		validator = validate.New(validate.Options{
+			Timeouts:  probeTimeouts(opts),
+			Dialer:    opts.dialer,
+			TLSConfig: opts.tlsConfig,
+			Transport: opts.RTSPTransport,
+			Headers:   opts.headers,
+		})
+	}
+
+	var mu sync.Mutex
+	var captured int
+	report := func(result output.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		captured++
+		logCaptured(result)
+		if opts.live != nil {
+			if err := opts.live.Write(result); err != nil {
+				gologger.Warning().Msgf("Failed to write live result: %v", err)
+			}
+		}
+		if err := writer.Write(result); err != nil {
+			gologger.Warning().Msgf("Failed to write result: %v", err)
+		}
+	}
+
+	// Validation runs beside the capture so it keeps reading packets
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	err := passive.Run(ctx, passive.Options{
+		Interface: opts.PassiveCapture,
+		File:      opts.PassiveFile,
+		Ports:     ports,
+		OnCredential: func(cred passive.Credential) {
+			result := capturedResult(cred)
+			if validator == nil {
+				report(result)
+				return
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				validated := validator.Validate(ctx, []output.Result{result})[0]
+				if validated.StillValid != nil {
+					report(validated)
+				}
+			}()
+		},
+	})
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	logStop(ctx)
+	gologger.Info().Msgf("%d credential pair(s) captured", captured)
+	return nil
+}
+
+// capturedResult converts a captured pair into a result for the camera it
+// was sent to
+func capturedResult(cred passive.Credential) output.Result {
+	target := utils.FormatTarget(cred.Server, cred.Port)
+	return output.Result{
+		IP:           cred.Server,
+		Port:         cred.Port,
+		Protocol:     cred.Protocol,
+		Username:     cred.Username,
+		Password:     cred.Password,
+		Path:         cred.Path,
+		URL:          fmt.Sprintf("%s://%s@%s%s", cred.Protocol, url.UserPassword(cred.Username, cred.Password), target, cred.Path),
+		Timestamp:    cred.Seen,
+		CapturedFrom: cred.Client,
+	}
+}
+
+// logCaptured prints a captured pair
+func logCaptured(result output.Result) {
+	status := "unverified"
+	if result.StillValid != nil {
+		status = "rejected"
+		if *result.StillValid {
+			status = "valid"
+		}
+	}
+	if logging.JSON() {
+		slog.Info("credentials captured",
+			"ip", result.IP,
+			"port", result.Port,
+			"protocol", result.Protocol,
+			"client", result.CapturedFrom,
+			"username", result.Username,
+			"password", result.Password,
+			"status", status)
+		return
+	}
+	gologger.Info().Msgf("╭─ %sCaptured credentials%s %s[%s]%s", config.ColorGreen, config.ColorReset, config.ColorYellow, status, config.ColorReset)
+	gologger.Info().Msgf("%s├ Host      :%s %s", config.ColorBold, config.ColorReset, utils.FormatTarget(result.IP, result.Port))
+	gologger.Info().Msgf("%s├ Client    :%s %s", config.ColorBold, config.ColorReset, result.CapturedFrom)
+	gologger.Info().Msgf("%s├ Auth      :%s %s:%s", config.ColorBold, config.ColorReset, result.Username, result.Password)
+	gologger.Info().Msgf("%s╰ URL       :%s %s", config.ColorBold, config.ColorReset, result.URL)
+	fmt.Fprintln(os.Stderr)
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/api"
+	"github.com/ALW1EZ/camtruder/pkg/config"
+	"github.com/ALW1EZ/camtruder/pkg/fuzz"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/ALW1EZ/camtruder/pkg/rtsp"
+	targetspkg "github.com/ALW1EZ/camtruder/pkg/targets"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+	"github.com/projectdiscovery/gologger"
+)
+
+// serve runs the REST API until ctx is cancelled. opts must have been
+// prepared; every request scans with a copy of it.
+func serve(ctx context.Context, opts *Options) error {
+	if opts.APIToken == "" {
+		gologger.Warning().Msgf("No --api-token given, the API accepts unauthenticated requests")
+	}
+	gologger.Info().Msgf("Serving REST API on %s", opts.Serve)
+
+	return api.ListenAndServe(ctx, opts.Serve, api.Options{
+		Token: opts.APIToken,
+		Runner: func(ctx context.Context, req api.ScanRequest, writer output.ResultWriter) error {
+			return runAPIScan(ctx, opts, req, writer)
+		},
+	})
+}
+
+// runAPIScan runs a scan requested through the API. Settings missing from
+// the request come from the flags the server was started with. Only
+// address expressions are accepted as targets and credentials are taken
+// literally, so clients cannot make the server read local files.
+func runAPIScan(ctx context.Context, base *Options, req api.ScanRequest, writer output.ResultWriter) error {
+	opts := *base
+	opts.quiet = true
+	opts.Output = ""
+	opts.CheckpointFile = ""
+	opts.CredsFile = ""
+	opts.users = req.Usernames
+	opts.passwords = req.Passwords
+
+	if req.Port > 0 {
+		opts.Port = req.Port
+	}
+	if req.Workers > 0 {
+		opts.Threads = req.Workers
+	}
+	if req.Timeout != "" {
+		timeout, err := time.ParseDuration(req.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %v", err)
+		}
+		opts.ConnectTimeout = timeout
+		opts.ReadTimeout = timeout
+	}
+	if req.TotalTimeout != "" {
+		timeout, err := time.ParseDuration(req.TotalTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid total timeout: %v", err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if req.RateLimit > 0 {
+		opts.RateLimit = req.RateLimit
+	}
+	if req.RTSPTransport != "" {
+		transport, err := rtsp.ParseTransport(req.RTSPTransport)
+		if err != nil {
+			return err
+		}
+		if opts.Proxy != "" && transport != rtsp.TransportTCP {
+			return fmt.Errorf("RTP over UDP cannot use the server's proxy")
+		}
+		opts.RTSPTransport = transport
+	}
+	opts.ForceBasic = opts.ForceBasic || req.ForceBasic
+	opts.CheckVulns = opts.CheckVulns || req.CheckVulns
+	if req.FuzzPaths && opts.fuzzPaths == nil {
+		paths, err := fuzz.Paths(opts.PathsFile, config.DefaultPaths)
+		if err != nil {
+			return err
+		}
+		opts.fuzzPaths = paths
+	}
+
+	credSource, credCount, err := credentialSource(&opts)
+	if err != nil {
+		return err
+	}
+
+	ips, err := targetspkg.ExpandWithOptions(strings.Join(req.Targets, ","), targetspkg.Options{
+		IPv6MaxHosts: opts.IPv6MaxHosts,
+		Warnf: func(format string, args ...interface{}) {
+			gologger.Warning().Msgf(format, args...)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	targets := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		targets = append(targets, utils.FormatTarget(ip.String(), opts.Port))
+	}
+
+	return runTargetScan(ctx, targets, nil, credSource, credCount, &opts, writer)
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/config"
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	httpprobe "github.com/ALW1EZ/camtruder/pkg/probe/http"
+	"github.com/ALW1EZ/camtruder/pkg/rtsp"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+	"github.com/ALW1EZ/camtruder/pkg/validate"
+	"github.com/projectdiscovery/gologger"
+)
+
+// Validate runs "camtruder validate --input results.json [--output file]",
+// re-testing the hits of a JSON result file and writing them back with
+// still_valid and last_checked set
+func Validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	input := fs.String("input", "", "")
+	outputPath := fs.String("output", "", "")
+	var workers int
+	fs.IntVar(&workers, "w", config.DefaultThreads, "")
+	fs.IntVar(&workers, "workers", config.DefaultThreads, "")
+	timeout := fs.Int("timeout", config.DefaultTimeout, "")
+	proxy := fs.String("proxy", "", "")
+	transport := fs.String("rtsp-transport", rtsp.TransportTCP, "")
+	var headerFlags, cookieFlags stringList
+	fs.Var(&headerFlags, "header", "")
+	fs.Var(&cookieFlags, "cookie", "")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: camtruder validate --input results.json [--output validated.json]\n"+
+			"                          [--workers n] [--timeout secs] [--proxy url] [--rtsp-transport tcp|udp|auto]\n"+
+			"                          [--header \"Name: Value\"]... [--cookie name=value]...\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("validate needs --input and no other arguments")
+	}
+
+	rtpTransport, err := rtsp.ParseTransport(*transport)
+	if err != nil {
+		return err
+	}
+	if *proxy != "" && rtpTransport != rtsp.TransportTCP {
+		return fmt.Errorf("RTP over UDP cannot use a proxy")
+	}
+	timeouts := rtsp.Timeouts{
+		Connect: time.Duration(*timeout) * time.Second,
+		Read:    time.Duration(*timeout) * time.Second,
+	}
+	netDialer, err := dialer.New(*proxy, timeouts.Connect, nil)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := dialer.NewTLSConfig(dialer.TLSOptions{})
+	if err != nil {
+		return err
+	}
+	headers, err := httpprobe.ParseHeaders(headerFlags, cookieFlags)
+	if err != nil {
+		return err
+	}
+
+	results, err := output.ReadJSONFile(*input)
+	if err != nil {
+		return err
+	}
+
+	// The input is read in full, so the output may replace it
+	var w io.Writer = os.Stdout
+	if *outputPath != "" {
+		file, err := os.Create(*outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	gologger.Info().Msgf("Validating %d results with %d workers", len(results), workers)
+	validator := validate.New(validate.Options{
+		Timeouts:  timeouts,
+		Dialer:    netDialer,
+		TLSConfig: tlsConfig,
+		Transport: rtpTransport,
+		Workers:   workers,
+		Headers:   headers,
+		OnChecked: func(result output.Result) {
+			label := "VALID"
+			if !*result.StillValid {
+				label = "STALE"
+			}
+			gologger.Info().Label(label).Msgf("%s %s %s:%s", utils.FormatTarget(result.IP, result.Port),
+				result.Protocol, result.Username, result.Password)
+		},
+	})
+	validated := validator.Validate(ctx, results)
+
+	writer, err := output.NewWriter(output.FormatJSON, w)
+	if err != nil {
+		return err
+	}
+	valid, checked := 0, 0
+	for _, result := range validated {
+		if err := writer.Write(result); err != nil {
+			return fmt.Errorf("failed to write result: %v", err)
+		}
+		if result.StillValid != nil {
+			checked++
+			if *result.StillValid {
+				valid++
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		gologger.Warning().Msgf("Interrupted, %d results were not checked and are written unmarked", len(validated)-checked)
+	}
+	gologger.Info().Msgf("%d of %d checked results are still valid", valid, checked)
+	return nil
+}
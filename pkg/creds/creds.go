@@ -0,0 +1,142 @@
+package creds
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ALW1EZ/camtruder/pkg/credentials"
+)
+
+// Merge modes for combining a credentials file with the built-in lists
+const (
+	ModeAppend  = "append"
+	ModeReplace = "replace"
+)
+
+// Credential represents a username/password pair
+type Credential = credentials.Credentials
+
+// Source iterates credential pairs in order, stopping early when fn
+// returns false. A Source can be iterated more than once.
+type Source func(fn func(Credential) bool) error
+
+// LoadFile reads a file of username:password lines into memory.
+// Use FromFile to iterate large files without loading them.
+func LoadFile(path string) ([]Credential, error) {
+	var list []Credential
+	err := Each(path, func(c Credential) bool {
+		list = append(list, c)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Each streams the username:password lines of a file to fn.
+// Empty lines and lines starting with # are ignored and duplicate pairs
+// are only delivered once. Passwords may contain colons.
+func Each(path string, fn func(Credential) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open credentials file: %v", err)
+	}
+	defer file.Close()
+
+	// Only a digest of each pair is kept so very large files stay cheap
+	seen := make(map[[16]byte]struct{})
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		username, password, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected username:password", path, lineNum)
+		}
+		username = strings.TrimSpace(username)
+		if username == "" {
+			return fmt.Errorf("%s:%d: empty username", path, lineNum)
+		}
+
+		sum := sha256.Sum256([]byte(username + "\x00" + password))
+		var key [16]byte
+		copy(key[:], sum[:16])
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		if !fn(Credential{Username: username, Password: password}) {
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read credentials file: %v", err)
+	}
+	return nil
+}
+
+// FromFile returns a Source that streams a credentials file on every pass
+func FromFile(path string) Source {
+	return func(fn func(Credential) bool) error {
+		return Each(path, fn)
+	}
+}
+
+// FromLists returns a Source pairing every username with every password
+func FromLists(users, passwords []string) Source {
+	return func(fn func(Credential) bool) error {
+		for _, user := range users {
+			for _, pass := range passwords {
+				if !fn(Credential{Username: user, Password: pass}) {
+					return nil
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// Concat returns a Source that iterates each source in turn
+func Concat(sources ...Source) Source {
+	return func(fn func(Credential) bool) error {
+		stopped := false
+		for _, source := range sources {
+			err := source(func(c Credential) bool {
+				if !fn(c) {
+					stopped = true
+					return false
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			if stopped {
+				return nil
+			}
+		}
+		return nil
+	}
+}
+
+// Count returns the number of pairs a Source yields
+func Count(source Source) (int, error) {
+	n := 0
+	err := source(func(Credential) bool {
+		n++
+		return true
+	})
+	return n, err
+}
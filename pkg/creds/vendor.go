@@ -0,0 +1,73 @@
+package creds
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// builtinVendorCreds is the embedded table of factory defaults by vendor
+//
+//go:embed vendor_creds.yaml
+var builtinVendorCreds []byte
+
+// vendorDefaults maps lower case vendor names to their default pairs
+var vendorDefaults = mustParseVendors(builtinVendorCreds)
+
+// mustParseVendors parses the built-in table, which is known to be valid
+func mustParseVendors(data []byte) map[string][]Credential {
+	var table map[string][]string
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		panic(fmt.Sprintf("invalid built-in vendor credentials: %v", err))
+	}
+	defaults := make(map[string][]Credential, len(table))
+	for vendor, pairs := range table {
+		for _, pair := range pairs {
+			username, password, ok := strings.Cut(pair, ":")
+			if !ok {
+				panic(fmt.Sprintf("invalid built-in vendor credential %q for %s", pair, vendor))
+			}
+			key := strings.ToLower(vendor)
+			defaults[key] = append(defaults[key], Credential{Username: username, Password: password})
+		}
+	}
+	return defaults
+}
+
+// VendorDefaults returns the factory default pairs of vendor, most likely
+// first, or nil for an unknown vendor
+func VendorDefaults(vendor string) []Credential {
+	return vendorDefaults[strings.ToLower(strings.TrimSpace(vendor))]
+}
+
+// PrioritizeForVendor returns a copy of creds with the factory defaults of
+// vendor moved to the front, in the order of the vendor table. The other
+// pairs keep their order and pairs missing from creds are not added, so
+// the result always holds the same pairs as creds.
+func PrioritizeForVendor(creds []Credential, vendor string) []Credential {
+	defaults := VendorDefaults(vendor)
+	if len(defaults) == 0 {
+		return append([]Credential(nil), creds...)
+	}
+
+	present := make(map[Credential]bool, len(creds))
+	for _, cred := range creds {
+		present[cred] = true
+	}
+	result := make([]Credential, 0, len(creds))
+	moved := make(map[Credential]bool, len(defaults))
+	for _, cred := range defaults {
+		if present[cred] && !moved[cred] {
+			moved[cred] = true
+			result = append(result, cred)
+		}
+	}
+	for _, cred := range creds {
+		if !moved[cred] {
+			result = append(result, cred)
+		}
+	}
+	return result
+}
@@ -0,0 +1,354 @@
+// Package dedup merges the results of one physical camera into a single
+// entry. A camera often answers on several ports, e.g. RTSP on 554 and
+// 8554 and its web interface on 80 and 8080, and every port and working
+// credential pair is a result of its own. Results are correlated by serial
+// number when the camera reported one, and by address and fingerprinted
+// vendor and model otherwise.
+package dedup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+)
+
+// Supported formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// PortResult is one service of a camera
+type PortResult struct {
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	// URLs are the authenticated URLs of every pair and path that worked
+	URLs        []string            `json:"urls,omitempty"`
+	Credentials []output.Credential `json:"credentials,omitempty"`
+	Fingerprint string              `json:"fingerprint,omitempty"`
+	Snapshot    string              `json:"snapshot,omitempty"`
+	// Vulnerabilities are the findings reported on the port
+	Vulnerabilities []string `json:"vulnerabilities,omitempty"`
+	// PelcoAddresses are the RS-485 addresses of a Pelco bus on the port
+	PelcoAddresses string `json:"pelco_addresses,omitempty"`
+}
+
+// CameraResult is everything the results of a scan say about one camera
+type CameraResult struct {
+	IP       string `json:"ip"` // Address of the first result
+	Vendor   string `json:"vendor,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+	MAC      string `json:"mac,omitempty"`
+	Country  string `json:"country,omitempty"`
+	City     string `json:"city,omitempty"`
+	ASN      string `json:"asn,omitempty"`
+	Org      string `json:"org,omitempty"`
+	PTZ      string `json:"ptz,omitempty"`
+	// Credentials are the pairs that worked on any of the ports
+	Credentials []output.Credential `json:"credentials"`
+	Ports       []PortResult        `json:"ports"`
+	Streams     []output.StreamInfo `json:"streams,omitempty"`
+	Timestamp   time.Time           `json:"timestamp"` // Time of the first result
+	first       int                 // Index of the first result, keeps the input order
+	ports       map[portKey]int     // Indexes of Ports
+	portFirst   map[portKey]int     // Index of the first result of every port
+}
+
+// portKey identifies a service of a camera
+type portKey struct {
+	ip       string
+	port     int
+	protocol string
+}
+
+// Merge groups results by camera, in the order each camera first appears.
+// Results with a serial number are merged by serial, across addresses as
+// well. A result without one joins the camera on its address whose vendor
+// and model do not contradict it; when several do, as behind a NAT
+// forwarding ports to several cameras, it is kept apart with the other
+// results that cannot be told apart either.
+func Merge(results []output.Result) []CameraResult {
+	var cameras []*CameraResult
+	bySerial := make(map[string]*CameraResult)
+	byIP := make(map[string][]*CameraResult)
+	add := func(index int, r output.Result) *CameraResult {
+		camera := &CameraResult{
+			IP:          r.IP,
+			Credentials: []output.Credential{},
+			Timestamp:   r.Timestamp,
+			first:       index,
+			ports:       make(map[portKey]int),
+			portFirst:   make(map[portKey]int),
+		}
+		cameras = append(cameras, camera)
+		byIP[r.IP] = append(byIP[r.IP], camera)
+		return camera
+	}
+
+	// Serial numbers first, so results without one find their camera
+	// whatever the order
+	for i, r := range results {
+		serial := normalize(r.Serial)
+		if serial == "" {
+			continue
+		}
+		camera, ok := bySerial[serial]
+		if !ok {
+			camera = add(i, r)
+			bySerial[serial] = camera
+		} else if !hasCamera(byIP[r.IP], camera) {
+			byIP[r.IP] = append(byIP[r.IP], camera)
+		}
+		camera.merge(i, r)
+	}
+	for i, r := range results {
+		if normalize(r.Serial) != "" {
+			continue
+		}
+		camera := match(byIP[r.IP], r)
+		if camera == nil {
+			camera = add(i, r)
+		}
+		camera.merge(i, r)
+	}
+
+	sort.SliceStable(cameras, func(i, j int) bool { return cameras[i].first < cameras[j].first })
+	merged := make([]CameraResult, len(cameras))
+	for i, camera := range cameras {
+		// Ports are listed in the order they were found as well
+		first := func(p PortResult) int {
+			return camera.portFirst[portKey{ip: p.IP, port: p.Port, protocol: p.Protocol}]
+		}
+		sort.SliceStable(camera.Ports, func(i, j int) bool { return first(camera.Ports[i]) < first(camera.Ports[j]) })
+		merged[i] = *camera
+	}
+	return merged
+}
+
+// match returns the camera of candidates a result without a serial number
+// belongs to, or nil if it needs a camera of its own
+func match(candidates []*CameraResult, r output.Result) *CameraResult {
+	var compatible []*CameraResult
+	for _, camera := range candidates {
+		if agree(camera.Vendor, r.Vendor) && agree(camera.Model, r.Model) {
+			compatible = append(compatible, camera)
+		}
+	}
+	if len(compatible) == 1 {
+		return compatible[0]
+	}
+	// Several cameras fit, join the one of the results that could not be
+	// attributed either
+	for _, camera := range compatible {
+		if camera.Serial == "" {
+			return camera
+		}
+	}
+	return nil
+}
+
+// agree reports whether two fingerprinted values may describe the same
+// device, which they do when either is unknown
+func agree(a, b string) bool {
+	return a == "" || b == "" || strings.EqualFold(a, b)
+}
+
+func normalize(serial string) string {
+	return strings.ToUpper(strings.TrimSpace(serial))
+}
+
+func hasCamera(cameras []*CameraResult, camera *CameraResult) bool {
+	for _, c := range cameras {
+		if c == camera {
+			return true
+		}
+	}
+	return false
+}
+
+// merge adds a result to the camera. Device details are taken from the
+// first result that knows them.
+func (c *CameraResult) merge(index int, r output.Result) {
+	if index < c.first {
+		c.first = index
+		c.IP = r.IP
+	}
+	if !r.Timestamp.IsZero() && (c.Timestamp.IsZero() || r.Timestamp.Before(c.Timestamp)) {
+		c.Timestamp = r.Timestamp
+	}
+	fill(&c.Vendor, r.Vendor)
+	fill(&c.Model, r.Model)
+	fill(&c.Serial, r.Serial)
+	fill(&c.Firmware, r.Firmware)
+	fill(&c.MAC, r.MAC)
+	fill(&c.Country, r.Country)
+	fill(&c.City, r.City)
+	fill(&c.ASN, r.ASN)
+	fill(&c.Org, r.Org)
+	fill(&c.PTZ, r.PTZ)
+	if len(c.Streams) == 0 {
+		c.Streams = r.Streams
+	}
+
+	key := portKey{ip: r.IP, port: r.Port, protocol: r.Protocol}
+	i, ok := c.ports[key]
+	if !ok {
+		i = len(c.Ports)
+		c.ports[key] = i
+		c.portFirst[key] = index
+		c.Ports = append(c.Ports, PortResult{IP: r.IP, Port: r.Port, Protocol: r.Protocol})
+	}
+	port := &c.Ports[i]
+	if index < c.portFirst[key] {
+		c.portFirst[key] = index
+	}
+	fill(&port.Fingerprint, r.Fingerprint)
+	fill(&port.Snapshot, r.Snapshot)
+	if r.Vulnerability != "" {
+		port.Vulnerabilities = appendUnique(port.Vulnerabilities, r.Vulnerability)
+		return
+	}
+	// Pelco buses have no credentials, only the bus is listed
+	if r.PelcoAddresses != "" {
+		fill(&port.PelcoAddresses, r.PelcoAddresses)
+		port.URLs = appendUnique(port.URLs, r.URL)
+		return
+	}
+	cred := output.Credential{Username: r.Username, Password: r.Password}
+	port.Credentials = appendCredential(port.Credentials, cred)
+	c.Credentials = appendCredential(c.Credentials, cred)
+	if r.URL != "" {
+		port.URLs = appendUnique(port.URLs, r.URL)
+	}
+}
+
+func fill(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func appendCredential(creds []output.Credential, cred output.Credential) []output.Credential {
+	for _, c := range creds {
+		if c == cred {
+			return creds
+		}
+	}
+	return append(creds, cred)
+}
+
+// Writer collects results and writes them merged per camera when it is
+// closed, since a camera's last port may be found at the end of a scan
+type Writer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	format  string
+	results []output.Result
+}
+
+// NewWriter returns a Writer writing cameras to w in format, FormatText or
+// FormatJSON
+func NewWriter(format string, w io.Writer) (*Writer, error) {
+	switch format {
+	case "", FormatText, FormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown dedup format: %s (use text or json)", format)
+	}
+	return &Writer{w: w, format: format}, nil
+}
+
+func (d *Writer) Write(r output.Result) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results = append(d.results, r)
+	return nil
+}
+
+// Close writes the merged cameras
+func (d *Writer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return Write(d.w, Merge(d.results), d.format)
+}
+
+// Write renders cameras in the given format: one JSON object per line, or
+// a block of lines per camera listing its pairs and ports
+func Write(w io.Writer, cameras []CameraResult, format string) error {
+	switch format {
+	case "", FormatText:
+		return writeText(w, cameras)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		for _, camera := range cameras {
+			if err := enc.Encode(camera); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown dedup format: %s (use text or json)", format)
+	}
+}
+
+// writeText prints the address, device and pairs of every camera,
+// followed by one indented line per URL or finding of its ports
+func writeText(w io.Writer, cameras []CameraResult) error {
+	for _, camera := range cameras {
+		var device []string
+		for _, detail := range []string{camera.Vendor, camera.Model} {
+			if detail != "" {
+				device = append(device, detail)
+			}
+		}
+		if camera.Serial != "" {
+			device = append(device, "serial "+camera.Serial)
+		}
+		line := camera.IP
+		if len(device) > 0 {
+			line += " " + strings.Join(device, " ")
+		}
+		var creds []string
+		for _, cred := range camera.Credentials {
+			creds = append(creds, cred.String())
+		}
+		if len(creds) > 0 {
+			line += " [" + strings.Join(creds, ", ") + "]"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		for _, port := range camera.Ports {
+			target := utils.FormatTarget(port.IP, port.Port)
+			for _, url := range port.URLs {
+				if _, err := fmt.Fprintf(w, "  %s %s %s\n", target, port.Protocol, url); err != nil {
+					return err
+				}
+			}
+			for _, vulnerability := range port.Vulnerabilities {
+				if _, err := fmt.Fprintf(w, "  %s %s [%s]\n", target, port.Protocol, vulnerability); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
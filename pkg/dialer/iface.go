@@ -0,0 +1,72 @@
+package dialer
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Interface is a network interface of the host
+type Interface struct {
+	Name  string
+	Up    bool
+	Addrs []net.IP
+}
+
+// Interfaces lists the network interfaces of the host with their addresses
+func Interfaces() ([]Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %v", err)
+	}
+
+	list := make([]Interface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		entry := Interface{Name: iface.Name, Up: iface.Flags&net.FlagUp != 0}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read addresses of %s: %v", iface.Name, err)
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				entry.Addrs = append(entry.Addrs, ipnet.IP)
+			}
+		}
+		list = append(list, entry)
+	}
+	return list, nil
+}
+
+// InterfaceIP returns the source address for connections bound to the
+// named interface: its first IPv4 address, or its first IPv6 address if it
+// has no IPv4 one. IPv6 link-local addresses are skipped since they need a
+// zone and cannot reach routed targets.
+func InterfaceIP(name string) (net.IP, error) {
+	ifaces, err := Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		names = append(names, iface.Name)
+		if iface.Name != name {
+			continue
+		}
+
+		var v6 net.IP
+		for _, ip := range iface.Addrs {
+			if ip.To4() != nil {
+				return ip, nil
+			}
+			if v6 == nil && !ip.IsLinkLocalUnicast() {
+				v6 = ip
+			}
+		}
+		if v6 != nil {
+			return v6, nil
+		}
+		return nil, fmt.Errorf("interface %s has no IP address", name)
+	}
+	return nil, fmt.Errorf("interface %s not found (available: %s)", name, strings.Join(names, ", "))
+}
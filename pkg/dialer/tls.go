@@ -0,0 +1,50 @@
+package dialer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSOptions configures the TLS client used by HTTPS and RTSPS probes
+type TLSOptions struct {
+	Verify     bool   // Verify server certificates instead of accepting any
+	CAFile     string // PEM bundle trusted for verification, implies Verify
+	ClientCert string // PEM client certificate for mutual TLS
+	ClientKey  string // PEM key of ClientCert
+}
+
+// NewTLSConfig builds the TLS client configuration for probes. Cameras
+// almost always present self-signed certificates, so verification is off
+// unless requested, and TLS 1.0 is still accepted for old firmware.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: !opts.Verify && opts.CAFile == "",
+		MinVersion:         tls.VersionTLS10,
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, fmt.Errorf("a TLS client certificate needs both --tls-client-cert and --tls-client-key")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,275 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ALW1EZ/camtruder/pkg/output"
+)
+
+// Supported report formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Key identifies a camera service across scans
+type Key struct {
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+func (k Key) String() string {
+	return net.JoinHostPort(k.IP, strconv.Itoa(k.Port)) + " " + k.Protocol
+}
+
+// Camera is everything the results of one scan say about a camera service
+type Camera struct {
+	Key
+	Credentials []output.Credential `json:"credentials,omitempty"`
+	Vendor      string              `json:"vendor,omitempty"`
+	Model       string              `json:"model,omitempty"`
+	Firmware    string              `json:"firmware,omitempty"`
+}
+
+// CredentialChange lists the credential pairs that stopped or started
+// working on a camera present in both scans
+type CredentialChange struct {
+	Key
+	Removed []output.Credential `json:"removed,omitempty"`
+	Added   []output.Credential `json:"added,omitempty"`
+}
+
+// DeviceChange records a model or firmware change of a camera present in
+// both scans. Fields that are unknown in either scan are not compared.
+type DeviceChange struct {
+	Key
+	OldModel    string `json:"old_model,omitempty"`
+	NewModel    string `json:"new_model,omitempty"`
+	OldFirmware string `json:"old_firmware,omitempty"`
+	NewFirmware string `json:"new_firmware,omitempty"`
+}
+
+// Report is the difference between two scans
+type Report struct {
+	Offline            []Camera           `json:"offline"`
+	New                []Camera           `json:"new"`
+	CredentialsChanged []CredentialChange `json:"credentials_changed"`
+	DeviceChanged      []DeviceChange     `json:"device_changed"`
+}
+
+// Empty reports whether the scans found the same cameras
+func (r *Report) Empty() bool {
+	return len(r.Offline) == 0 && len(r.New) == 0 && len(r.CredentialsChanged) == 0 && len(r.DeviceChanged) == 0
+}
+
+// Compare reports the differences between the results of an old and a
+// new scan. A camera may have several results, one per working credential
+// pair or stream path; they are merged under its key and the credential
+// sets are compared as a whole.
+func Compare(oldResults, newResults []output.Result) *Report {
+	oldCameras := group(oldResults)
+	newCameras := group(newResults)
+
+	report := &Report{
+		Offline:            []Camera{},
+		New:                []Camera{},
+		CredentialsChanged: []CredentialChange{},
+		DeviceChanged:      []DeviceChange{},
+	}
+	for _, key := range sortedKeys(oldCameras, newCameras) {
+		before, inOld := oldCameras[key]
+		after, inNew := newCameras[key]
+		switch {
+		case !inNew:
+			report.Offline = append(report.Offline, *before)
+		case !inOld:
+			report.New = append(report.New, *after)
+		default:
+			removed := subtract(before.Credentials, after.Credentials)
+			added := subtract(after.Credentials, before.Credentials)
+			if len(removed) > 0 || len(added) > 0 {
+				report.CredentialsChanged = append(report.CredentialsChanged, CredentialChange{Key: key, Removed: removed, Added: added})
+			}
+
+			change := DeviceChange{Key: key}
+			if before.Model != "" && after.Model != "" && !strings.EqualFold(before.Model, after.Model) {
+				change.OldModel, change.NewModel = before.Model, after.Model
+			}
+			if before.Firmware != "" && after.Firmware != "" && before.Firmware != after.Firmware {
+				change.OldFirmware, change.NewFirmware = before.Firmware, after.Firmware
+			}
+			if change.NewModel != "" || change.NewFirmware != "" {
+				report.DeviceChanged = append(report.DeviceChanged, change)
+			}
+		}
+	}
+	return report
+}
+
+// group merges results into one camera per key. Vulnerability findings
+// contribute device details but no credentials.
+func group(results []output.Result) map[Key]*Camera {
+	cameras := make(map[Key]*Camera)
+	for _, r := range results {
+		key := Key{IP: r.IP, Port: r.Port, Protocol: r.Protocol}
+		camera, ok := cameras[key]
+		if !ok {
+			camera = &Camera{Key: key}
+			cameras[key] = camera
+		}
+		if r.Vulnerability == "" {
+			cred := output.Credential{Username: r.Username, Password: r.Password}
+			if !containsCredential(camera.Credentials, cred) {
+				camera.Credentials = append(camera.Credentials, cred)
+			}
+		}
+		if camera.Vendor == "" {
+			camera.Vendor = r.Vendor
+		}
+		if camera.Model == "" {
+			camera.Model = r.Model
+		}
+		if camera.Firmware == "" {
+			camera.Firmware = r.Firmware
+		}
+	}
+	for _, camera := range cameras {
+		sort.Slice(camera.Credentials, func(i, j int) bool {
+			return camera.Credentials[i].String() < camera.Credentials[j].String()
+		})
+	}
+	return cameras
+}
+
+// sortedKeys returns the keys of both scans ordered by address, port and
+// protocol
+func sortedKeys(a, b map[Key]*Camera) []Key {
+	seen := make(map[Key]bool, len(a)+len(b))
+	var keys []Key
+	for _, m := range []map[Key]*Camera{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c := compareIP(keys[i].IP, keys[j].IP); c != 0 {
+			return c < 0
+		}
+		if keys[i].Port != keys[j].Port {
+			return keys[i].Port < keys[j].Port
+		}
+		return keys[i].Protocol < keys[j].Protocol
+	})
+	return keys
+}
+
+// compareIP orders addresses numerically, falling back to text for
+// values that are not IP addresses
+func compareIP(a, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return strings.Compare(a, b)
+	}
+	return bytes.Compare(ipA.To16(), ipB.To16())
+}
+
+// subtract returns the credentials of a that are not in b
+func subtract(a, b []output.Credential) []output.Credential {
+	var out []output.Credential
+	for _, cred := range a {
+		if !containsCredential(b, cred) {
+			out = append(out, cred)
+		}
+	}
+	return out
+}
+
+func containsCredential(creds []output.Credential, cred output.Credential) bool {
+	for _, c := range creds {
+		if c == cred {
+			return true
+		}
+	}
+	return false
+}
+
+// Write renders the report in the given format
+func Write(w io.Writer, report *Report, format string) error {
+	switch format {
+	case "", FormatText:
+		return writeText(w, report)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	default:
+		return fmt.Errorf("unknown diff format: %s (use text or json)", format)
+	}
+}
+
+// writeText prints one line per change, prefixed with - for cameras gone
+// offline, + for new ones and ~ for changed ones
+func writeText(w io.Writer, report *Report) error {
+	for _, camera := range report.Offline {
+		fmt.Fprintf(w, "[-] %s went offline%s\n", camera.Key, describe(camera))
+	}
+	for _, camera := range report.New {
+		fmt.Fprintf(w, "[+] %s newly discovered%s\n", camera.Key, describe(camera))
+	}
+	for _, change := range report.CredentialsChanged {
+		var parts []string
+		for _, cred := range change.Removed {
+			parts = append(parts, "-"+cred.String())
+		}
+		for _, cred := range change.Added {
+			parts = append(parts, "+"+cred.String())
+		}
+		fmt.Fprintf(w, "[~] %s credentials %s\n", change.Key, strings.Join(parts, " "))
+	}
+	for _, change := range report.DeviceChanged {
+		var parts []string
+		if change.NewModel != "" {
+			parts = append(parts, fmt.Sprintf("model %s -> %s", change.OldModel, change.NewModel))
+		}
+		if change.NewFirmware != "" {
+			parts = append(parts, fmt.Sprintf("firmware %s -> %s", change.OldFirmware, change.NewFirmware))
+		}
+		fmt.Fprintf(w, "[~] %s %s\n", change.Key, strings.Join(parts, ", "))
+	}
+	_, err := fmt.Fprintf(w, "%d offline, %d new, %d credentials changed, %d device changed\n",
+		len(report.Offline), len(report.New), len(report.CredentialsChanged), len(report.DeviceChanged))
+	return err
+}
+
+// describe summarizes a camera's credentials and device for text output
+func describe(camera Camera) string {
+	var parts []string
+	if len(camera.Credentials) > 0 {
+		creds := make([]string, len(camera.Credentials))
+		for i, cred := range camera.Credentials {
+			creds[i] = cred.String()
+		}
+		parts = append(parts, "["+strings.Join(creds, ", ")+"]")
+	}
+	if device := strings.TrimSpace(camera.Vendor + " " + camera.Model); device != "" {
+		parts = append(parts, device)
+	}
+	if camera.Firmware != "" {
+		parts = append(parts, camera.Firmware)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(parts, " ")
+}
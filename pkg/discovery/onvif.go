@@ -0,0 +1,202 @@
+package discovery
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WS-Discovery multicast groups used by ONVIF devices
+const (
+	wsDiscoveryAddr = "239.255.255.250:3702"
+	wsDiscoveryPort = 3702
+)
+
+var wsDiscoveryGroupV6 = net.ParseIP("ff02::c")
+
+// probeTemplate is a WS-Discovery Probe for ONVIF video transmitters
+const probeTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope" xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<e:Header>
+<w:MessageID>uuid:%s</w:MessageID>
+<w:To e:mustUnderstand="true">urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To>
+<w:Action e:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action>
+</e:Header>
+<e:Body>
+<d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe>
+</e:Body>
+</e:Envelope>`
+
+// OnvifDevice represents a device that answered a WS-Discovery probe
+type OnvifDevice struct {
+	IP     string
+	Port   int
+	XAddrs []string // Advertised device service URLs
+	Scopes []string
+}
+
+// probeMatchEnvelope is the subset of a ProbeMatches response we need
+type probeMatchEnvelope struct {
+	Body struct {
+		ProbeMatches struct {
+			ProbeMatch []struct {
+				XAddrs string `xml:"XAddrs"`
+				Scopes string `xml:"Scopes"`
+			} `xml:"ProbeMatch"`
+		} `xml:"ProbeMatches"`
+	} `xml:"Body"`
+}
+
+// Discover multicasts a WS-Discovery Probe on IPv4 and IPv6 and collects
+// ProbeMatch responses until the timeout expires. If iface is non-empty the
+// probe is sent from that interface.
+func Discover(iface string, timeout time.Duration) ([]OnvifDevice, error) {
+	localAddr, err := interfaceAddr(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	conn4, err := net.ListenUDP("udp4", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open discovery socket: %v", err)
+	}
+	defer conn4.Close()
+
+	groupAddr, err := net.ResolveUDPAddr("udp4", wsDiscoveryAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	messageID, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	probe := []byte(fmt.Sprintf(probeTemplate, messageID))
+	if _, err := conn4.WriteToUDP(probe, groupAddr); err != nil {
+		return nil, fmt.Errorf("failed to send probe: %v", err)
+	}
+
+	conns := []*net.UDPConn{conn4}
+
+	// IPv6 is best effort; many hosts have no IPv6 multicast route
+	if conn6, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6unspecified}); err == nil {
+		defer conn6.Close()
+		sent := false
+		for _, zone := range multicastZones(iface) {
+			addr := &net.UDPAddr{IP: wsDiscoveryGroupV6, Port: wsDiscoveryPort, Zone: zone}
+			if _, err := conn6.WriteToUDP(probe, addr); err == nil {
+				sent = true
+			}
+		}
+		if sent {
+			conns = append(conns, conn6)
+		}
+	}
+
+	var (
+		devices []OnvifDevice
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+	)
+	seen := make(map[string]bool)
+	deadline := time.Now().Add(timeout)
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *net.UDPConn) {
+			defer wg.Done()
+			conn.SetReadDeadline(deadline)
+			buf := make([]byte, 65535)
+			for {
+				n, from, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				mutex.Lock()
+				for _, device := range parseProbeMatches(buf[:n], from) {
+					if !seen[device.IP] {
+						seen[device.IP] = true
+						devices = append(devices, device)
+					}
+				}
+				mutex.Unlock()
+			}
+		}(conn)
+	}
+	wg.Wait()
+
+	return devices, nil
+}
+
+// parseProbeMatches extracts devices from a ProbeMatches message
+func parseProbeMatches(data []byte, from *net.UDPAddr) []OnvifDevice {
+	var envelope probeMatchEnvelope
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return nil
+	}
+
+	var devices []OnvifDevice
+	for _, match := range envelope.Body.ProbeMatches.ProbeMatch {
+		device := OnvifDevice{
+			IP:     from.IP.String(),
+			Port:   80,
+			XAddrs: strings.Fields(match.XAddrs),
+			Scopes: strings.Fields(match.Scopes),
+		}
+
+		// Prefer the address advertised in the service URL
+		for _, xaddr := range device.XAddrs {
+			u, err := url.Parse(xaddr)
+			if err != nil || u.Hostname() == "" {
+				continue
+			}
+			device.IP = u.Hostname()
+			if port, err := strconv.Atoi(u.Port()); err == nil {
+				device.Port = port
+			} else if u.Scheme == "https" {
+				device.Port = 443
+			}
+			break
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// interfaceAddr returns the first IPv4 address of the named interface
+func interfaceAddr(name string) (*net.UDPAddr, error) {
+	if name == "" {
+		return &net.UDPAddr{}, nil
+	}
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s not found: %v", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read addresses of %s: %v", name, err)
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return &net.UDPAddr{IP: ipnet.IP}, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", name)
+}
+
+// newUUID generates a random version 4 UUID
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,239 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSDP multicast groups for IPv4 and IPv6 (link-local and site-local)
+var (
+	ssdpGroupV4  = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+	ssdpGroupsV6 = []net.IP{net.ParseIP("ff02::c"), net.ParseIP("ff05::c")}
+)
+
+// mSearchTemplate is a standard SSDP discovery request
+const mSearchTemplate = "M-SEARCH * HTTP/1.1\r\n" +
+	"HOST: %s\r\n" +
+	"MAN: \"ssdp:discover\"\r\n" +
+	"MX: 2\r\n" +
+	"ST: ssdp:all\r\n" +
+	"\r\n"
+
+// cameraKeywords mark a UPnP device description as a camera
+var cameraKeywords = []string{"camera", "ipcam", "mediaserver", "nvr", "dvr", "webcam", "video"}
+
+// SSDPDevice represents a camera-like UPnP device found with SSDP
+type SSDPDevice struct {
+	IP              string
+	Location        string // URL of the device description XML
+	DeviceType      string
+	FriendlyName    string
+	Manufacturer    string
+	ModelName       string
+	PresentationURL string
+}
+
+// deviceDescription is the subset of a UPnP description document we need
+type deviceDescription struct {
+	URLBase string `xml:"URLBase"`
+	Device  struct {
+		DeviceType      string `xml:"deviceType"`
+		FriendlyName    string `xml:"friendlyName"`
+		Manufacturer    string `xml:"manufacturer"`
+		ModelName       string `xml:"modelName"`
+		ModelNumber     string `xml:"modelNumber"`
+		PresentationURL string `xml:"presentationURL"`
+	} `xml:"device"`
+}
+
+// DiscoverSSDP multicasts an M-SEARCH request on IPv4 and IPv6, collects the
+// responses until the timeout expires and returns the devices whose
+// description identifies them as cameras. If iface is non-empty the
+// requests are sent from that interface.
+func DiscoverSSDP(iface string, timeout time.Duration) ([]SSDPDevice, error) {
+	localAddr, err := interfaceAddr(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	conn4, err := net.ListenUDP("udp4", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSDP socket: %v", err)
+	}
+	defer conn4.Close()
+	if _, err := conn4.WriteToUDP([]byte(fmt.Sprintf(mSearchTemplate, ssdpGroupV4.String())), ssdpGroupV4); err != nil {
+		return nil, fmt.Errorf("failed to send M-SEARCH: %v", err)
+	}
+
+	conns := []*net.UDPConn{conn4}
+
+	// IPv6 is best effort; many hosts have no IPv6 multicast route
+	if conn6, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6unspecified}); err == nil {
+		defer conn6.Close()
+		sent := false
+		for _, zone := range multicastZones(iface) {
+			for _, group := range ssdpGroupsV6 {
+				addr := &net.UDPAddr{IP: group, Port: 1900, Zone: zone}
+				host := fmt.Sprintf("[%s]:1900", group)
+				if _, err := conn6.WriteToUDP([]byte(fmt.Sprintf(mSearchTemplate, host)), addr); err == nil {
+					sent = true
+				}
+			}
+		}
+		if sent {
+			conns = append(conns, conn6)
+		}
+	}
+
+	locations := collectLocations(conns, timeout)
+
+	// Fetch all device descriptions in parallel
+	client := &http.Client{Timeout: timeout}
+	var (
+		devices []SSDPDevice
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for location, ip := range locations {
+		wg.Add(1)
+		go func(location, ip string) {
+			defer wg.Done()
+			device, err := fetchDescription(client, location, ip)
+			if err != nil || !isCamera(device) {
+				return
+			}
+			mutex.Lock()
+			devices = append(devices, device)
+			mutex.Unlock()
+		}(location, ip)
+	}
+	wg.Wait()
+
+	return devices, nil
+}
+
+// collectLocations reads SSDP responses from all sockets until the timeout
+// and returns the unique LOCATION URLs mapped to the responding IP
+func collectLocations(conns []*net.UDPConn, timeout time.Duration) map[string]string {
+	locations := make(map[string]string)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(timeout)
+
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *net.UDPConn) {
+			defer wg.Done()
+			conn.SetReadDeadline(deadline)
+			buf := make([]byte, 65535)
+			for {
+				n, from, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+				if err != nil {
+					continue
+				}
+				resp.Body.Close()
+				location := resp.Header.Get("Location")
+				if location == "" {
+					continue
+				}
+				mutex.Lock()
+				if _, exists := locations[location]; !exists {
+					locations[location] = from.IP.String()
+				}
+				mutex.Unlock()
+			}
+		}(conn)
+	}
+	wg.Wait()
+
+	return locations
+}
+
+// fetchDescription downloads and parses a UPnP device description
+func fetchDescription(client *http.Client, location, ip string) (SSDPDevice, error) {
+	resp, err := client.Get(location)
+	if err != nil {
+		return SSDPDevice{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return SSDPDevice{}, err
+	}
+
+	var desc deviceDescription
+	if err := xml.Unmarshal(body, &desc); err != nil {
+		return SSDPDevice{}, fmt.Errorf("invalid device description: %v", err)
+	}
+
+	device := SSDPDevice{
+		IP:           ip,
+		Location:     location,
+		DeviceType:   desc.Device.DeviceType,
+		FriendlyName: desc.Device.FriendlyName,
+		Manufacturer: desc.Device.Manufacturer,
+		ModelName:    strings.TrimSpace(desc.Device.ModelName + " " + desc.Device.ModelNumber),
+	}
+
+	// Presentation URLs may be relative to URLBase or the description URL
+	if desc.Device.PresentationURL != "" {
+		base := location
+		if desc.URLBase != "" {
+			base = desc.URLBase
+		}
+		if baseURL, err := url.Parse(base); err == nil {
+			if ref, err := url.Parse(strings.TrimSpace(desc.Device.PresentationURL)); err == nil {
+				device.PresentationURL = baseURL.ResolveReference(ref).String()
+			}
+		}
+	}
+
+	return device, nil
+}
+
+// isCamera reports whether a device description looks like a camera
+func isCamera(device SSDPDevice) bool {
+	text := strings.ToLower(strings.Join([]string{
+		device.DeviceType, device.FriendlyName, device.Manufacturer, device.ModelName,
+	}, " "))
+	for _, keyword := range cameraKeywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// multicastZones returns the interface names IPv6 link-local multicast
+// should be sent on
+func multicastZones(iface string) []string {
+	if iface != "" {
+		return []string{iface}
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var zones []string
+	for _, i := range ifaces {
+		if i.Flags&net.FlagUp != 0 && i.Flags&net.FlagMulticast != 0 && i.Flags&net.FlagLoopback == 0 {
+			zones = append(zones, i.Name)
+		}
+	}
+	return zones
+}
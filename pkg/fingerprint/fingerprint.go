@@ -0,0 +1,180 @@
+package fingerprint
+
+import (
+	_ "embed"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultSignatures is the built-in fingerprint table
+//
+//go:embed fingerprints.yaml
+var defaultSignatures []byte
+
+// titlePattern extracts the HTML page title
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// Signature is a single vendor entry of a fingerprint table
+type Signature struct {
+	Vendor  string            `yaml:"vendor"`
+	Headers map[string]string `yaml:"headers"`
+	Title   string            `yaml:"title"`
+	Body    string            `yaml:"body"`
+	Model   string            `yaml:"model"`
+}
+
+// compiled is a Signature with its patterns compiled
+type compiled struct {
+	vendor  string
+	headers map[string]*regexp.Regexp
+	title   *regexp.Regexp
+	body    *regexp.Regexp
+	model   *regexp.Regexp
+}
+
+var (
+	mu         sync.RWMutex
+	signatures = mustParse(defaultSignatures)
+)
+
+// Fingerprint identifies the vendor and model of a camera from an HTTP
+// response that has already been received. It never makes requests.
+func Fingerprint(resp *http.Response, body []byte) (Vendor, Model string) {
+	if resp == nil {
+		return "", ""
+	}
+
+	mu.RLock()
+	table := signatures
+	mu.RUnlock()
+
+	title := ""
+	if m := titlePattern.FindSubmatch(body); m != nil {
+		title = strings.TrimSpace(html.UnescapeString(string(m[1])))
+	}
+
+	for _, sig := range table {
+		if !sig.matches(resp.Header, title, body) {
+			continue
+		}
+		return sig.vendor, sig.findModel(resp.Header, body)
+	}
+	return "", ""
+}
+
+// LoadFile adds the signatures of a YAML file in front of the current
+// table so user entries take precedence over the built-in ones
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read fingerprints file: %v", err)
+	}
+	extra, err := parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	mu.Lock()
+	signatures = append(extra, signatures...)
+	mu.Unlock()
+	return nil
+}
+
+// matches reports whether any pattern of the signature matches
+func (c compiled) matches(header http.Header, title string, body []byte) bool {
+	for name, pattern := range c.headers {
+		for _, value := range header.Values(name) {
+			if pattern.MatchString(value) {
+				return true
+			}
+		}
+	}
+	if c.title != nil && title != "" && c.title.MatchString(title) {
+		return true
+	}
+	if c.body != nil && c.body.Match(body) {
+		return true
+	}
+	return false
+}
+
+// findModel returns the first non-empty capture group of the model pattern
+func (c compiled) findModel(header http.Header, body []byte) string {
+	if c.model == nil {
+		return ""
+	}
+
+	var sources []string
+	for _, values := range header {
+		sources = append(sources, values...)
+	}
+	sources = append(sources, string(body))
+
+	for _, source := range sources {
+		m := c.model.FindStringSubmatch(source)
+		for _, group := range m[min(1, len(m)):] {
+			if group = strings.TrimSpace(group); group != "" {
+				return group
+			}
+		}
+	}
+	return ""
+}
+
+// parse decodes and compiles a fingerprint table
+func parse(data []byte) ([]compiled, error) {
+	var sigs []Signature
+	if err := yaml.Unmarshal(data, &sigs); err != nil {
+		return nil, fmt.Errorf("invalid fingerprint table: %v", err)
+	}
+
+	table := make([]compiled, 0, len(sigs))
+	for i, sig := range sigs {
+		if sig.Vendor == "" {
+			return nil, fmt.Errorf("entry %d has no vendor", i+1)
+		}
+		c := compiled{vendor: sig.Vendor, headers: make(map[string]*regexp.Regexp)}
+
+		var err error
+		for name, pattern := range sig.Headers {
+			if c.headers[name], err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("%s: header %s: %v", sig.Vendor, name, err)
+			}
+		}
+		if c.title, err = compileOptional(sig.Title); err != nil {
+			return nil, fmt.Errorf("%s: title: %v", sig.Vendor, err)
+		}
+		if c.body, err = compileOptional(sig.Body); err != nil {
+			return nil, fmt.Errorf("%s: body: %v", sig.Vendor, err)
+		}
+		if c.model, err = compileOptional(sig.Model); err != nil {
+			return nil, fmt.Errorf("%s: model: %v", sig.Vendor, err)
+		}
+		table = append(table, c)
+	}
+	return table, nil
+}
+
+// compileOptional compiles a pattern, returning nil for an empty one
+func compileOptional(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// mustParse parses the built-in table when the package is initialized
+func mustParse(data []byte) []compiled {
+	table, err := parse(data)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in fingerprints: %v", err))
+	}
+	return table
+}
@@ -0,0 +1,80 @@
+// Package fuzz provides the wordlist of RTSP paths tried when a camera
+// accepts credentials but serves none of the default paths, and the paths
+// MJPEG-over-HTTP cameras serve their streams on.
+package fuzz
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// builtinPaths is the embedded wordlist of common RTSP paths
+//
+//go:embed paths.txt
+var builtinPaths string
+
+// builtinMJPEGPaths is the embedded list of common MJPEG stream paths
+//
+//go:embed mjpeg.txt
+var builtinMJPEGPaths string
+
+// MJPEGPaths returns the built-in MJPEG-over-HTTP stream paths
+func MJPEGPaths() []string {
+	var paths []string
+	for _, line := range strings.Split(builtinMJPEGPaths, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			paths = append(paths, line)
+		}
+	}
+	return paths
+}
+
+// Paths returns the built-in wordlist followed by the paths in extraFile,
+// if given, without duplicates or entries from skip
+func Paths(extraFile string, skip []string) ([]string, error) {
+	seen := make(map[string]bool, len(skip))
+	for _, path := range skip {
+		seen[path] = true
+	}
+
+	var paths []string
+	add := func(r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if !strings.HasPrefix(line, "/") {
+				line = "/" + line
+			}
+			if !seen[line] {
+				seen[line] = true
+				paths = append(paths, line)
+			}
+		}
+		return scanner.Err()
+	}
+
+	if err := add(strings.NewReader(builtinPaths)); err != nil {
+		return nil, err
+	}
+
+	if extraFile != "" {
+		file, err := os.Open(extraFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open paths file: %v", err)
+		}
+		defer file.Close()
+		if err := add(file); err != nil {
+			return nil, fmt.Errorf("failed to read paths file: %v", err)
+		}
+	}
+
+	return paths, nil
+}
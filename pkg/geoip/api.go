@@ -0,0 +1,131 @@
+package geoip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+)
+
+// Names of the online APIs
+const (
+	APIHackerTarget = "hackertarget" // Default when no database is given
+	APIIPInfo       = "ipinfo"
+	APIIPAPI        = "ip-api"
+	APINone         = "none" // No online lookups
+)
+
+// maxResponseSize bounds the API responses read
+const maxResponseSize = 64 * 1024
+
+// api queries one online source for the location of ip
+type api func(ctx context.Context, client *http.Client, ip string) (Location, error)
+
+// apis are the online sources by name
+var apis = map[string]api{
+	APIHackerTarget: queryHackerTarget,
+	APIIPInfo:       queryIPInfo,
+	APIIPAPI:        queryIPAPI,
+}
+
+// APINames returns the accepted API names, sorted
+func APINames() []string {
+	names := []string{APINone}
+	for name := range apis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getJSON fetches url and decodes its JSON body into v
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// splitAS splits an "AS15169 Google LLC" network name into its number and
+// organization
+func splitAS(network string) (asn, org string) {
+	network = strings.TrimSpace(network)
+	if !strings.HasPrefix(network, "AS") {
+		return "", network
+	}
+	asn, org, _ = strings.Cut(network, " ")
+	return asn, strings.TrimSpace(org)
+}
+
+func queryHackerTarget(ctx context.Context, client *http.Client, ip string) (Location, error) {
+	var resp struct {
+		Country string `json:"country"`
+		State   string `json:"state"`
+		City    string `json:"city"`
+	}
+	url := fmt.Sprintf("https://api.hackertarget.com/geoip/?q=%s&output=json", neturl.QueryEscape(ip))
+	if err := getJSON(ctx, client, url, &resp); err != nil {
+		return Location{}, err
+	}
+	return Location{Country: resp.Country, Region: resp.State, City: resp.City}, nil
+}
+
+func queryIPInfo(ctx context.Context, client *http.Client, ip string) (Location, error) {
+	var resp struct {
+		Country string `json:"country"`
+		Region  string `json:"region"`
+		City    string `json:"city"`
+		Org     string `json:"org"`
+	}
+	url := fmt.Sprintf("https://ipinfo.io/%s/json", neturl.PathEscape(ip))
+	if err := getJSON(ctx, client, url, &resp); err != nil {
+		return Location{}, err
+	}
+	location := Location{Country: resp.Country, Region: resp.Region, City: resp.City}
+	location.ASN, location.Org = splitAS(resp.Org)
+	return location, nil
+}
+
+func queryIPAPI(ctx context.Context, client *http.Client, ip string) (Location, error) {
+	var resp struct {
+		Status     string `json:"status"`
+		Message    string `json:"message"`
+		Country    string `json:"country"`
+		RegionName string `json:"regionName"`
+		City       string `json:"city"`
+		AS         string `json:"as"`
+		Org        string `json:"org"`
+	}
+	// The free tier is only served over plain HTTP
+	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=status,message,country,regionName,city,as,org", neturl.PathEscape(ip))
+	if err := getJSON(ctx, client, url, &resp); err != nil {
+		return Location{}, err
+	}
+	if resp.Status != "success" {
+		return Location{}, fmt.Errorf("ip-api: %s", resp.Message)
+	}
+	location := Location{Country: resp.Country, Region: resp.RegionName, City: resp.City}
+	location.ASN, location.Org = splitAS(resp.AS)
+	if resp.Org != "" {
+		location.Org = resp.Org
+	}
+	return location, nil
+}
@@ -0,0 +1,207 @@
+// Package geoip looks up where camera addresses are. Lookups are answered
+// from MaxMind databases when they are given, which works offline, and
+// from an online API otherwise. API queries are paced to one per second
+// to stay within free tiers, and every answer is cached so hosts seen on
+// several ports or subnets are looked up once.
+package geoip
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	"golang.org/x/time/rate"
+)
+
+// CacheSize is the number of addresses whose location is kept
+const CacheSize = 10000
+
+// apiInterval is the minimum time between two API queries
+const apiInterval = time.Second
+
+// Location is where an address is and the network it belongs to
+type Location struct {
+	Country string
+	Region  string // State or province, only shown on the console
+	City    string
+	ASN     string // Autonomous system number, e.g. "AS3320"
+	Org     string // Organization of the autonomous system
+}
+
+// String formats the location as Country/Region/City, followed by the
+// network if it is known
+func (l Location) String() string {
+	var parts []string
+	for _, part := range []string{l.Country, l.Region, l.City} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	location := strings.Join(parts, "/")
+	if location == "" {
+		location = "Unknown Location"
+	}
+	if network := strings.TrimSpace(l.ASN + " " + l.Org); network != "" {
+		location += " (" + network + ")"
+	}
+	return location
+}
+
+// empty reports whether nothing is known about the address
+func (l Location) empty() bool {
+	return l == Location{}
+}
+
+// Options configures a Locator
+type Options struct {
+	// DBPaths are MaxMind GeoLite2 or GeoIP2 City, Country or ASN
+	// databases, merged in the order given
+	DBPaths []string
+	// API is queried for addresses the databases do not know, one of the
+	// API* names, "" or APINone to stay offline
+	API     string
+	Dialer  dialer.ContextDialer // Reaches the API, nil to dial directly
+	Timeout time.Duration        // Time allowed for one API query
+}
+
+// Locator looks up and caches the locations of addresses. It is safe for
+// concurrent use.
+type Locator struct {
+	dbs     []*database
+	api     api
+	client  *http.Client
+	limiter *rate.Limiter
+
+	mu      sync.Mutex
+	cache   map[string]*list.Element
+	recent  *list.List // Cached entries, most recently used first
+	maxSize int
+}
+
+// cacheEntry is an element of the recent list
+type cacheEntry struct {
+	ip       string
+	location Location
+}
+
+// New opens the databases and prepares the API client of opts
+func New(opts Options) (*Locator, error) {
+	l := &Locator{
+		limiter: rate.NewLimiter(rate.Every(apiInterval), 1),
+		cache:   make(map[string]*list.Element),
+		recent:  list.New(),
+		maxSize: CacheSize,
+	}
+
+	if opts.API != "" && opts.API != APINone {
+		source, ok := apis[opts.API]
+		if !ok {
+			return nil, fmt.Errorf("unknown geolocation API %q, use %s", opts.API, strings.Join(APINames(), ", "))
+		}
+		l.api = source
+		transport := &http.Transport{}
+		if opts.Dialer != nil {
+			transport.DialContext = opts.Dialer.DialContext
+		}
+		l.client = &http.Client{Timeout: opts.Timeout, Transport: transport}
+	}
+
+	for _, path := range opts.DBPaths {
+		db, err := openDatabase(path)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.dbs = append(l.dbs, db)
+	}
+	return l, nil
+}
+
+// Lookup returns the location of ip, which may carry a port. Private and
+// reserved addresses, and addresses no source knows, give an empty
+// Location.
+func (l *Locator) Lookup(ctx context.Context, ip string) Location {
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return Location{}
+	}
+	key := addr.String()
+
+	if location, ok := l.cached(key); ok {
+		return location
+	}
+
+	var location Location
+	for _, db := range l.dbs {
+		db.lookup(addr, &location)
+	}
+	if location.empty() && l.api != nil {
+		var err error
+		location, err = l.query(ctx, key)
+		if err != nil {
+			// Not cached so the address is queried again on its next hit
+			return Location{}
+		}
+	}
+	l.store(key, location)
+	return location
+}
+
+// query asks the API for the location of ip, waiting for its turn
+func (l *Locator) query(ctx context.Context, ip string) (Location, error) {
+	if err := l.limiter.Wait(ctx); err != nil {
+		return Location{}, err
+	}
+	return l.api(ctx, l.client, ip)
+}
+
+// cached returns the cached location of ip and marks it as recently used
+func (l *Locator) cached(ip string) (Location, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	element, ok := l.cache[ip]
+	if !ok {
+		return Location{}, false
+	}
+	l.recent.MoveToFront(element)
+	return element.Value.(*cacheEntry).location, true
+}
+
+// store caches the location of ip, evicting the least recently used entry
+// when the cache is full
+func (l *Locator) store(ip string, location Location) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, ok := l.cache[ip]; ok {
+		element.Value.(*cacheEntry).location = location
+		l.recent.MoveToFront(element)
+		return
+	}
+	l.cache[ip] = l.recent.PushFront(&cacheEntry{ip: ip, location: location})
+	if l.recent.Len() > l.maxSize {
+		oldest := l.recent.Back()
+		l.recent.Remove(oldest)
+		delete(l.cache, oldest.Value.(*cacheEntry).ip)
+	}
+}
+
+// Close closes the databases
+func (l *Locator) Close() error {
+	var firstErr error
+	for _, db := range l.dbs {
+		if err := db.reader.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	l.dbs = nil
+	return firstErr
+}
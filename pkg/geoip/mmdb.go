@@ -0,0 +1,82 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Kinds of MaxMind databases
+const (
+	kindCity = iota
+	kindCountry
+	kindASN
+)
+
+// database is an open MaxMind database and the kind of records it holds
+type database struct {
+	reader *geoip2.Reader
+	kind   int
+}
+
+// openDatabase opens a City, Country or ASN database. The reader rejects
+// lookups of record types the database does not hold, which tells the
+// kinds apart without reading the metadata.
+func openDatabase(path string) (*database, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %v", path, err)
+	}
+	db := &database{reader: reader}
+	for _, kind := range []int{kindCity, kindCountry, kindASN} {
+		db.kind = kind
+		var invalid geoip2.InvalidMethodError
+		if err := db.lookup(net.IPv4zero, &Location{}); !errors.As(err, &invalid) {
+			return db, nil
+		}
+	}
+	reader.Close()
+	return nil, fmt.Errorf("%s is not a City, Country or ASN GeoIP database", path)
+}
+
+// lookup fills the fields of location the database knows and that are
+// still empty
+func (db *database) lookup(ip net.IP, location *Location) error {
+	switch db.kind {
+	case kindCity:
+		record, err := db.reader.City(ip)
+		if err != nil {
+			return err
+		}
+		fill(&location.Country, record.Country.Names["en"])
+		if len(record.Subdivisions) > 0 {
+			fill(&location.Region, record.Subdivisions[0].Names["en"])
+		}
+		fill(&location.City, record.City.Names["en"])
+	case kindCountry:
+		record, err := db.reader.Country(ip)
+		if err != nil {
+			return err
+		}
+		fill(&location.Country, record.Country.Names["en"])
+	case kindASN:
+		record, err := db.reader.ASN(ip)
+		if err != nil {
+			return err
+		}
+		if record.AutonomousSystemNumber != 0 {
+			fill(&location.ASN, fmt.Sprintf("AS%d", record.AutonomousSystemNumber))
+		}
+		fill(&location.Org, record.AutonomousSystemOrganization)
+	}
+	return nil
+}
+
+// fill sets field to value unless an earlier database already set it
+func fill(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
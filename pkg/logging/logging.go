@@ -0,0 +1,180 @@
+// Package logging configures the process-wide log/slog logger.
+//
+// In text mode log records are rendered through gologger so they look
+// like the rest of the console output. In JSON mode every record, and
+// every gologger line, is written to stderr as one JSON object with ts,
+// level and msg keys, ready for log aggregators.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/gologger/formatter"
+	"github.com/projectdiscovery/gologger/levels"
+)
+
+// Log formats accepted by Setup
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// LevelTrace is used for per-probe events. They are only emitted in
+// verbose JSON mode, the text console already shows them through gologger.
+const LevelTrace = slog.LevelDebug - 4
+
+// jsonMode is set once Setup selected FormatJSON
+var jsonMode atomic.Bool
+
+// ansiColor matches the color escapes embedded in console messages
+var ansiColor = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// Setup installs the default slog logger for the given format. verbose
+// enables debug records, and trace records in JSON mode.
+func Setup(format string, verbose bool) error {
+	switch format {
+	case "", FormatText:
+		level := slog.LevelInfo
+		if verbose {
+			level = slog.LevelDebug
+		}
+		slog.SetDefault(slog.New(&consoleHandler{level: level}))
+	case FormatJSON:
+		level := slog.LevelInfo
+		if verbose {
+			level = LevelTrace
+		}
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: replaceAttr,
+		})))
+		// Route gologger through slog so no plain text reaches the log
+		gologger.DefaultLogger.SetFormatter(eventFormatter{})
+		gologger.DefaultLogger.SetWriter(slogWriter{})
+		jsonMode.Store(true)
+	default:
+		return fmt.Errorf("unknown log format: %s (use %s or %s)", format, FormatText, FormatJSON)
+	}
+	return nil
+}
+
+// JSON reports whether logs are written as JSON
+func JSON() bool {
+	return jsonMode.Load()
+}
+
+// Trace logs a per-probe event
+func Trace(msg string, args ...any) {
+	slog.Log(context.Background(), LevelTrace, msg, args...)
+}
+
+// replaceAttr renames the time key to ts and writes levels in lower case
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		a.Key = "ts"
+	case slog.LevelKey:
+		if level, ok := a.Value.Any().(slog.Level); ok && level <= LevelTrace {
+			a.Value = slog.StringValue("trace")
+		} else {
+			a.Value = slog.StringValue(strings.ToLower(a.Value.String()))
+		}
+	}
+	return a
+}
+
+// consoleHandler renders records as "msg key=value ..." through gologger
+type consoleHandler struct {
+	level slog.Level
+	attrs []slog.Attr
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	writeAttr := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+
+	switch {
+	case r.Level >= slog.LevelError:
+		gologger.Error().Msg(b.String())
+	case r.Level >= slog.LevelWarn:
+		gologger.Warning().Msg(b.String())
+	case r.Level >= slog.LevelInfo:
+		gologger.Info().Msg(b.String())
+	default:
+		gologger.Debug().Msg(b.String())
+	}
+	return nil
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &consoleHandler{level: h.level, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *consoleHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// gologgerEvent carries a gologger message from the formatter to the writer
+type gologgerEvent struct {
+	Msg   string `json:"msg"`
+	Label string `json:"label,omitempty"`
+}
+
+// eventFormatter keeps the message and label of gologger events
+type eventFormatter struct{}
+
+func (eventFormatter) Format(event *formatter.LogEvent) ([]byte, error) {
+	return json.Marshal(gologgerEvent{
+		Msg:   strings.TrimSpace(ansiColor.ReplaceAllString(event.Message, "")),
+		Label: event.Metadata["label"],
+	})
+}
+
+// slogWriter hands gologger events to the default slog logger
+type slogWriter struct{}
+
+func (slogWriter) Write(data []byte, level levels.Level) {
+	var event gologgerEvent
+	if err := json.Unmarshal(data, &event); err != nil || event.Msg == "" {
+		return
+	}
+
+	slogLevel := slog.LevelInfo
+	switch level {
+	case levels.LevelFatal, levels.LevelError:
+		slogLevel = slog.LevelError
+	case levels.LevelWarning:
+		slogLevel = slog.LevelWarn
+	case levels.LevelDebug, levels.LevelVerbose:
+		slogLevel = slog.LevelDebug
+	}
+
+	var args []any
+	if event.Label != "" {
+		args = append(args, "label", event.Label)
+	}
+	slog.Log(context.Background(), slogLevel, event.Msg, args...)
+}
@@ -0,0 +1,97 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/rtsp"
+)
+
+// Extensions of recorded clips
+const (
+	ClipMP4  = ".mp4"  // Recorded by ffmpeg
+	ClipH264 = ".h264" // Raw Annex B video recorded without ffmpeg
+)
+
+// recordGrace is the time allowed on top of the clip duration to connect
+// to the stream and finish the file
+const recordGrace = 15 * time.Second
+
+// clipName builds the <ip>_<port>_<timestamp> file name of a clip
+func clipName(rtspURL, ext string, now time.Time) string {
+	host, port, _ := streamHost(rtspURL)
+	name := fmt.Sprintf("%s_%s_%s%s",
+		sanitizeComponent(host), sanitizeComponent(port), now.Format("20060102_150405"), ext)
+	return strings.TrimLeft(name, ".")
+}
+
+// RecordClip records duration of an RTSP stream with ffmpeg and saves it
+// to the specified directory as an .mp4 file. The video is copied without
+// re-encoding and audio is dropped, as camera audio codecs such as G.711
+// do not fit in MP4. It returns the path of the clip.
+func RecordClip(ctx context.Context, rtspURL, outputDir string, duration time.Duration) (string, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	filename := filepath.Join(outputDir, clipName(rtspURL, ClipMP4, time.Now()))
+
+	ctx, cancel := context.WithTimeout(ctx, duration+recordGrace)
+	defer cancel()
+
+	// -t: stop after the clip duration
+	// -map 0:v:0 -c:v copy -an: keep the first video stream as it is
+	// -movflags +faststart: put the index first so the clip plays at once
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-y",
+		"-rtsp_transport", "tcp",
+		"-i", rtspURL,
+		"-t", strconv.FormatFloat(duration.Seconds(), 'f', 3, 64),
+		"-map", "0:v:0",
+		"-c:v", "copy",
+		"-an",
+		"-movflags", "+faststart",
+		"-loglevel", "error",
+		filename)
+	cmd.WaitDelay = time.Second
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(filename)
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("recording timed out after %v", duration+recordGrace)
+		}
+		return "", fmt.Errorf("failed to record clip: %v (%s)", err, strings.TrimSpace(string(output)))
+	}
+	return filename, nil
+}
+
+// RecordRaw records duration of the H.264 video of an RTSP stream without
+// ffmpeg and saves it to the specified directory as a raw .h264 file. It
+// returns the path of the clip; streams of other codecs are not recorded.
+func RecordRaw(ctx context.Context, rtspURL, outputDir string, duration time.Duration, cfg rtsp.Config) (string, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	filename := filepath.Join(outputDir, clipName(rtspURL, ClipH264, time.Now()))
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to create clip: %v", err)
+	}
+
+	err = rtsp.RecordH264(ctx, rtspURL, file, duration, cfg)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return "", fmt.Errorf("failed to record clip: %v", err)
+	}
+	return filename, nil
+}
@@ -1,11 +1,15 @@
 package media
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -15,49 +19,94 @@ func CheckFFmpegAvailable() bool {
 	return err == nil
 }
 
-// formatRTSPComponents extracts and formats components from RTSP URL
-func formatRTSPComponents(rtspURL string) string {
-	u, err := url.Parse(rtspURL)
-	if err != nil {
-		return "invalid_url" // fallback for invalid URLs
+// sanitizeComponent replaces every character that is not safe in a file
+// name so hosts can never escape the output directory
+func sanitizeComponent(s string) string {
+	if s == "" {
+		return "unknown"
 	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// defaultPorts are the ports implied by URL schemes without an explicit port
+var defaultPorts = map[string]string{
+	"rtsp":  "554",
+	"rtsps": "322",
+	"http":  "80",
+	"https": "443",
+}
 
-	// Extract username and password
-	username := ""
-	password := ""
-	if u.User != nil {
-		username = u.User.Username()
-		password, _ = u.User.Password()
+// streamHost returns the host and port of a stream URL, with the port
+// implied by its scheme if it has none, and its path and query
+func streamHost(rtspURL string) (host, port, stream string) {
+	host = "unknown"
+	port = "554" // default RTSP port
+	stream = rtspURL
+	if u, err := url.Parse(rtspURL); err == nil {
+		host = u.Hostname()
+		if u.Port() != "" {
+			port = u.Port()
+		} else if defaultPort, ok := defaultPorts[strings.ToLower(u.Scheme)]; ok {
+			port = defaultPort
+		}
+		stream = u.RequestURI()
 	}
+	return host, port, stream
+}
+
+// snapshotName builds the <ip>_<port>_<stream>_<timestamp>.jpg file name
+// for a stream. <stream> is a short hash of the path and query, so the
+// channels and substreams of one device do not overwrite each other.
+func snapshotName(rtspURL string, now time.Time) string {
+	host, port, stream := streamHost(rtspURL)
+	sum := sha1.Sum([]byte(stream))
 
-	// Extract host and port
-	host := u.Hostname()
-	port := u.Port()
-	if port == "" {
-		port = "554" // default RTSP port
+	// Leading dots would create hidden files or relative path parts
+	name := fmt.Sprintf("%s_%s_%s_%s.jpg",
+		sanitizeComponent(host), sanitizeComponent(port), hex.EncodeToString(sum[:4]), now.Format("20060102_150405"))
+	return strings.TrimLeft(name, ".")
+}
+
+// SaveFrame writes a JPEG frame read from an HTTP stream to the specified
+// directory under the same name TakeScreenshot uses. It returns the path
+// of the image.
+func SaveFrame(outputDir, streamURL string, frame []byte) (string, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %v", err)
 	}
 
-	// Format as username@password:ip:port
-	return fmt.Sprintf("%s@%s:%s:%s", username, password, host, port)
+	filename := filepath.Join(outputDir, snapshotName(streamURL, time.Now()))
+	if err := os.WriteFile(filename, frame, 0644); err != nil {
+		return "", fmt.Errorf("failed to save frame: %v", err)
+	}
+	return filename, nil
 }
 
-// TakeScreenshot captures a screenshot from an RTSP stream using ffmpeg and saves it to the specified directory
-func TakeScreenshot(rtspURL string, outputDir string, timeout time.Duration) error {
+// TakeScreenshot captures a screenshot from an RTSP stream using ffmpeg and
+// saves it to the specified directory. It returns the path of the image.
+func TakeScreenshot(ctx context.Context, rtspURL string, outputDir string, timeout time.Duration) (string, error) {
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %v", err)
+		return "", fmt.Errorf("failed to create output directory: %v", err)
 	}
 
-	// Create filename with timestamp and RTSP components
-	timestamp := time.Now().Format("20060102_150405")
-	rtspComponents := formatRTSPComponents(rtspURL)
-	filename := filepath.Join(outputDir, fmt.Sprintf("%s_%s.jpg", rtspComponents, timestamp))
+	filename := filepath.Join(outputDir, snapshotName(rtspURL, time.Now()))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
 	// Prepare ffmpeg command
 	// -y: overwrite output file
 	// -rtsp_transport tcp: use TCP for RTSP (more reliable)
 	// -frames:v 1: capture only one frame
-	cmd := exec.Command("ffmpeg",
+	cmd := exec.CommandContext(ctx, "ffmpeg",
 		"-y",
 		"-rtsp_transport", "tcp",
 		"-i", rtspURL,
@@ -65,13 +114,16 @@ func TakeScreenshot(rtspURL string, outputDir string, timeout time.Duration) err
 		"-loglevel", "error", // only show errors
 		filename)
 
-	// Set timeout
-	cmd.WaitDelay = timeout
+	// Give ffmpeg a moment to exit after being killed
+	cmd.WaitDelay = time.Second
 
 	// Run command and capture any error output
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to capture screenshot: %v (%s)", err, string(output))
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("screenshot timed out after %v", timeout)
+		}
+		return "", fmt.Errorf("failed to capture screenshot: %v (%s)", err, strings.TrimSpace(string(output)))
 	}
 
-	return nil
-} 
\ No newline at end of file
+	return filename, nil
+}
@@ -0,0 +1,264 @@
+// Package monitor watches confirmed cameras over time. Every check tests
+// each camera with the credentials that worked, like the validate
+// subcommand, and reports the changes since the previous check as events.
+// Cameras that stay unreachable are checked less and less often.
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/ALW1EZ/camtruder/pkg/probe/pelco"
+	"github.com/ALW1EZ/camtruder/pkg/rtsp"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+	"github.com/ALW1EZ/camtruder/pkg/validate"
+)
+
+// Event types
+const (
+	EventAppeared     = "appeared"      // Works again with its credentials
+	EventDisappeared  = "disappeared"   // No longer accepts connections
+	EventCredsChanged = "creds-changed" // Reachable, but its credentials are rejected
+)
+
+// DefaultInterval is the time between two checks of a camera
+const DefaultInterval = 5 * time.Minute
+
+// maxBackoff is the largest multiple of the interval an unreachable
+// camera waits between two checks
+const maxBackoff = 32
+
+// Event is a change of a camera between two checks
+type Event struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	IP       string    `json:"ip"`
+	Port     int       `json:"port"`
+	Protocol string    `json:"protocol"`
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	URL      string    `json:"url"`
+	Vendor   string    `json:"vendor,omitempty"`
+}
+
+// Options configures a Monitor
+type Options struct {
+	Timeouts  rtsp.Timeouts
+	Dialer    dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLSConfig *tls.Config          // TLS client settings, nil for the defaults
+	Transport string               // RTP transport, rtsp.TransportTCP by default
+	Workers   int                  // Cameras checked at once
+	Interval  time.Duration        // Time between two checks of a reachable camera
+	Headers   map[string]string    // Extra headers sent with every HTTP request
+}
+
+// Stats counts the cameras in each state after a check
+type Stats struct {
+	Checked  int // Cameras checked, the others are backing off
+	Up       int
+	Rejected int
+	Down     int
+}
+
+// state is what the last check of a camera found
+type state int
+
+const (
+	stateUnknown  state = iota // Not checked yet
+	stateUp                    // Its credentials work
+	stateRejected              // Reachable, credentials rejected
+	stateDown                  // Unreachable
+)
+
+// camera is one monitored result
+type camera struct {
+	result   output.Result
+	state    state
+	failures int       // Consecutive checks that found it unreachable
+	next     time.Time // When it is due for its next check
+}
+
+// Monitor keeps the state of every camera between checks
+type Monitor struct {
+	opts      Options
+	validator *validate.Validator
+	dialer    dialer.ContextDialer
+	cameras   []*camera
+}
+
+// New creates a monitor of the credential hits among results. Findings
+// and protocols the validator cannot test are left out.
+func New(results []output.Result, opts Options) *Monitor {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	netDialer := opts.Dialer
+	if netDialer == nil {
+		netDialer = &net.Dialer{Timeout: opts.Timeouts.Connect}
+	}
+	m := &Monitor{
+		opts: opts,
+		validator: validate.New(validate.Options{
+			Timeouts:  opts.Timeouts,
+			Dialer:    opts.Dialer,
+			TLSConfig: opts.TLSConfig,
+			Transport: opts.Transport,
+			Headers:   opts.Headers,
+		}),
+		dialer: netDialer,
+	}
+	for _, result := range results {
+		if result.Vulnerability != "" || !testable(result.Protocol) {
+			continue
+		}
+		m.cameras = append(m.cameras, &camera{result: result})
+	}
+	return m
+}
+
+// testable reports whether the validator can test hits of protocol
+func testable(protocol string) bool {
+	switch strings.ToLower(protocol) {
+	case "rtsp", "rtsps", "http", "https", pelco.ProtocolD, pelco.ProtocolP:
+		return true
+	}
+	return false
+}
+
+// Len returns the number of monitored cameras
+func (m *Monitor) Len() int {
+	return len(m.cameras)
+}
+
+// Check tests every camera that is due, Workers at a time, and returns the
+// changes it found in input order. The first check only sets the baseline
+// of working cameras; cameras that fail it are reported. Once ctx is
+// canceled no further cameras are started, but the checks in flight run
+// to the end and their changes are returned.
+func (m *Monitor) Check(ctx context.Context) ([]Event, Stats) {
+	// In-flight checks keep their own deadlines when ctx is canceled
+	checkCtx := context.WithoutCancel(ctx)
+
+	type change struct {
+		index int
+		event Event
+	}
+	var mu sync.Mutex
+	var changes []change
+	var stats Stats
+
+	sem := make(chan struct{}, m.opts.Workers)
+	var wg sync.WaitGroup
+	now := time.Now()
+	for i, cam := range m.cameras {
+		// Checks are due in whole intervals, so a camera due a little
+		// after this tick is checked now rather than an interval late
+		if cam.next.Sub(now) > m.opts.Interval/2 {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, cam *camera) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			current := m.check(checkCtx, cam.result)
+			mu.Lock()
+			defer mu.Unlock()
+			stats.Checked++
+			if event, ok := m.update(cam, current, now); ok {
+				changes = append(changes, change{i, event})
+			}
+		}(i, cam)
+	}
+	wg.Wait()
+
+	for _, cam := range m.cameras {
+		switch cam.state {
+		case stateUp:
+			stats.Up++
+		case stateRejected:
+			stats.Rejected++
+		case stateDown:
+			stats.Down++
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].index < changes[j].index })
+	events := make([]Event, len(changes))
+	for i, c := range changes {
+		events[i] = c.event
+	}
+	return events, stats
+}
+
+// check tests one camera. A camera whose credentials fail is told apart
+// from one that is gone by a plain TCP connection to its port.
+func (m *Monitor) check(ctx context.Context, result output.Result) state {
+	validated := m.validator.Validate(ctx, []output.Result{result})[0]
+	if validated.StillValid != nil && *validated.StillValid {
+		return stateUp
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.opts.Timeouts.Connect)
+	defer cancel()
+	conn, err := m.dialer.DialContext(ctx, "tcp", utils.FormatTarget(result.IP, result.Port))
+	if err != nil {
+		return stateDown
+	}
+	conn.Close()
+	return stateRejected
+}
+
+// update records the state a check started at started found and
+// schedules the next one. It returns the event of the change, if there is
+// one to report.
+func (m *Monitor) update(cam *camera, current state, started time.Time) (Event, bool) {
+	if current == stateDown {
+		cam.failures++
+	} else {
+		cam.failures = 0
+	}
+	// Unreachable cameras back off exponentially, up to maxBackoff
+	// intervals
+	backoff := 1
+	for i := 1; i < cam.failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	cam.next = started.Add(time.Duration(backoff) * m.opts.Interval)
+
+	previous := cam.state
+	cam.state = current
+	if current == previous || (previous == stateUnknown && current == stateUp) {
+		return Event{}, false
+	}
+	event := Event{
+		Time:     time.Now().UTC(),
+		IP:       cam.result.IP,
+		Port:     cam.result.Port,
+		Protocol: cam.result.Protocol,
+		Username: cam.result.Username,
+		Password: cam.result.Password,
+		URL:      cam.result.URL,
+		Vendor:   cam.result.Vendor,
+	}
+	switch current {
+	case stateUp:
+		event.Event = EventAppeared
+	case stateRejected:
+		event.Event = EventCredsChanged
+	case stateDown:
+		event.Event = EventDisappeared
+	}
+	return event, true
+}
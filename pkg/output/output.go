@@ -0,0 +1,286 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	// FormatShodan writes every result as a Shodan host banner
+	FormatShodan = "shodan"
+)
+
+// Result represents a single discovered camera
+type Result struct {
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Path     string `json:"path"`
+	URL      string `json:"url"`
+	Vendor   string `json:"vendor,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Fingerprint summarizes stream features such as codec and frame rate
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Snapshot    string `json:"snapshot,omitempty"`
+	// Fuzzed is set when the stream path was found by --fuzz-paths
+	Fuzzed bool `json:"fuzzed,omitempty"`
+	// Vulnerability names a known vulnerability (e.g. a CVE) when the
+	// result is a vulnerability finding rather than a credential hit
+	Vulnerability string    `json:"vulnerability,omitempty"`
+	Serial        string    `json:"serial,omitempty"`
+	Firmware      string    `json:"firmware,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+	// SNMP is the version and community string (or v3 user) the device's
+	// SNMP agent answered to, e.g. "v2c public"
+	SNMP     string `json:"snmp,omitempty"`
+	SysDescr string `json:"sys_descr,omitempty"`
+	// PTZ is the protocol the camera can be steered through, "onvif" or
+	// "isapi", when --check-ptz found pan-tilt-zoom control
+	PTZ        string `json:"ptz,omitempty"`
+	PTZPresets int    `json:"ptz_presets,omitempty"`
+	// PTZMoved is set when the --ptz-move test move was accepted
+	PTZMoved bool `json:"ptz_moved,omitempty"`
+	// TLS* describe the certificate of the service when --inspect-tls
+	// read it; TLSNotAfter is in RFC 3339 format
+	TLSSubject    string   `json:"tls_subject,omitempty"`
+	TLSIssuer     string   `json:"tls_issuer,omitempty"`
+	TLSSANs       []string `json:"tls_sans,omitempty"`
+	TLSSerial     string   `json:"tls_serial,omitempty"`
+	TLSNotAfter   string   `json:"tls_not_after,omitempty"`
+	TLSSelfSigned bool     `json:"tls_self_signed,omitempty"`
+	// MAC is the device's MAC address, when its certificate names it
+	MAC string `json:"mac,omitempty"`
+	// Country, City, ASN and Org locate the camera and its network
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+	ASN     string `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+	// Streams are the stream URIs of every media profile, when
+	// --onvif-enumerate listed them
+	Streams []StreamInfo `json:"streams,omitempty"`
+	// PelcoAddresses are the RS-485 addresses, e.g. "1-4,7", that answered
+	// a Pelco-D or Pelco-P probe; Protocol names which of the two
+	PelcoAddresses string `json:"pelco_addresses,omitempty"`
+	// CapturedFrom is the client whose request carried the credentials,
+	// when they were read from captured traffic instead of tested
+	CapturedFrom string `json:"captured_from,omitempty"`
+	// StillValid and LastChecked are set by the validate subcommand:
+	// whether the hit still worked when it was tested again, and when
+	StillValid  *bool      `json:"still_valid,omitempty"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	// Response is the raw probe response, only kept by the --db store
+	Response string `json:"-"`
+}
+
+// StreamInfo is one stream URI a camera reported over ONVIF
+type StreamInfo struct {
+	Profile   string  `json:"profile"` // Token of the media profile
+	Name      string  `json:"name,omitempty"`
+	Type      string  `json:"type"` // "unicast" or "multicast"
+	URI       string  `json:"uri"`
+	Encoding  string  `json:"encoding,omitempty"`
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	FrameRate float64 `json:"framerate,omitempty"`
+}
+
+// Credential is a working username and password pair, as reports that
+// group results by camera list them
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (c Credential) String() string {
+	return c.Username + ":" + c.Password
+}
+
+// ResultWriter encodes scan results as soon as they are found
+type ResultWriter interface {
+	Write(r Result) error
+	Close() error
+}
+
+// NewWriter returns a ResultWriter for the given format writing to w
+func NewWriter(format string, w io.Writer) (ResultWriter, error) {
+	switch format {
+	case "", FormatText:
+		return &textWriter{w: w}, nil
+	case FormatJSON:
+		return &jsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatShodan:
+		return &shodanWriter{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// textWriter writes one stream URL per line. Vulnerability findings are
+// prefixed with the vulnerability name so they are not mistaken for hits.
+type textWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (t *textWriter) Write(r Result) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r.Vulnerability != "" {
+		_, err := fmt.Fprintf(t.w, "[%s] %s\n", r.Vulnerability, r.URL)
+		return err
+	}
+	_, err := fmt.Fprintln(t.w, r.URL)
+	return err
+}
+
+func (t *textWriter) Close() error {
+	return nil
+}
+
+// jsonWriter writes one JSON object per line
+type jsonWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (j *jsonWriter) Write(r Result) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.enc.Encode(r)
+}
+
+func (j *jsonWriter) Close() error {
+	return nil
+}
+
+// csvHeader lists the CSV columns in the order they are written
+var csvHeader = []string{"ip", "port", "protocol", "username", "password", "path", "url", "vendor", "model", "fingerprint", "snapshot", "fuzzed", "vulnerability", "serial", "firmware", "timestamp", "snmp", "sys_descr", "ptz", "ptz_presets", "ptz_moved", "tls_subject", "tls_issuer", "tls_sans", "tls_serial", "tls_not_after", "tls_self_signed", "mac", "country", "city", "asn", "org", "streams", "pelco_addresses", "captured_from"}
+
+// csvWriter writes a header row followed by one row per result
+type csvWriter struct {
+	mu          sync.Mutex
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (c *csvWriter) Write(r Result) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.wroteHeader {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+
+	record := []string{
+		r.IP,
+		strconv.Itoa(r.Port),
+		r.Protocol,
+		r.Username,
+		r.Password,
+		r.Path,
+		r.URL,
+		r.Vendor,
+		r.Model,
+		r.Fingerprint,
+		r.Snapshot,
+		strconv.FormatBool(r.Fuzzed),
+		r.Vulnerability,
+		r.Serial,
+		r.Firmware,
+		r.Timestamp.Format(time.RFC3339),
+		r.SNMP,
+		r.SysDescr,
+		r.PTZ,
+		strconv.Itoa(r.PTZPresets),
+		strconv.FormatBool(r.PTZMoved),
+		r.TLSSubject,
+		r.TLSIssuer,
+		strings.Join(r.TLSSANs, ";"),
+		r.TLSSerial,
+		r.TLSNotAfter,
+		strconv.FormatBool(r.TLSSelfSigned),
+		r.MAC,
+		r.Country,
+		r.City,
+		r.ASN,
+		r.Org,
+		streamURIs(r.Streams),
+		r.PelcoAddresses,
+		r.CapturedFrom,
+	}
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+
+	// Flush every row so results are visible immediately
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// streamURIs joins the URIs of streams for a CSV cell
+func streamURIs(streams []StreamInfo) string {
+	uris := make([]string, len(streams))
+	for i, stream := range streams {
+		uris[i] = stream.URI
+	}
+	return strings.Join(uris, ";")
+}
+
+func (c *csvWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Multi returns a ResultWriter that writes every result to all writers
+func Multi(writers ...ResultWriter) ResultWriter {
+	return multiWriter(writers)
+}
+
+type multiWriter []ResultWriter
+
+func (m multiWriter) Write(r Result) error {
+	var firstErr error
+	for _, w := range m {
+		if err := w.Write(r); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m multiWriter) Close() error {
+	var firstErr error
+	for _, w := range m {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Discard is a ResultWriter that drops every result
+var Discard ResultWriter = discardWriter{}
+
+type discardWriter struct{}
+
+func (discardWriter) Write(r Result) error { return nil }
+func (discardWriter) Close() error         { return nil }
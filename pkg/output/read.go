@@ -0,0 +1,71 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReadJSON decodes results written by the JSON writer, one object per
+// line. A single JSON array of results is accepted as well.
+func ReadJSON(r io.Reader) ([]Result, error) {
+	br := bufio.NewReader(r)
+	if first, err := peekNonSpace(br); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	} else if first == '[' {
+		var results []Result
+		if err := json.NewDecoder(br).Decode(&results); err != nil {
+			return nil, fmt.Errorf("invalid JSON results: %v", err)
+		}
+		return results, nil
+	}
+
+	var results []Result
+	dec := json.NewDecoder(br)
+	for {
+		var result Result
+		err := dec.Decode(&result)
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON result %d: %v", len(results)+1, err)
+		}
+		results = append(results, result)
+	}
+}
+
+// ReadJSONFile reads a JSON result file
+func ReadJSONFile(path string) ([]Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open results: %v", err)
+	}
+	defer f.Close()
+
+	results, err := ReadJSON(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return results, nil
+}
+
+// peekNonSpace returns the first non-whitespace byte without consuming it
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return b[0], nil
+		}
+		br.ReadByte()
+	}
+}
@@ -0,0 +1,122 @@
+package output
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+)
+
+// shodanTimestamp is the layout of Shodan banner timestamps, in UTC
+// without a zone suffix
+const shodanTimestamp = "2006-01-02T15:04:05.000000"
+
+// shodanModules maps result protocols to the Shodan crawler module that
+// collects the same service
+var shodanModules = map[string]string{
+	"rtsp":  "rtsp-tcp",
+	"rtsps": "rtsp-tcp",
+	"http":  "http",
+	"https": "https",
+	"ptz":   "http",
+	"onvif": "http",
+}
+
+// shodanBanner is one service in the schema of Shodan's banner exports,
+// so tools that ingest Shodan data read camtruder results as they are.
+// The full result, with credentials and snapshot path, is kept under
+// camtruder.
+type shodanBanner struct {
+	IP         uint32                `json:"ip,omitempty"` // IPv4 addresses only
+	IPStr      string                `json:"ip_str"`
+	Port       int                   `json:"port"`
+	Transport  string                `json:"transport"`
+	Timestamp  string                `json:"timestamp"`
+	Hostnames  []string              `json:"hostnames"`
+	Domains    []string              `json:"domains"`
+	Org        string                `json:"org,omitempty"`
+	ISP        string                `json:"isp,omitempty"`
+	ASN        string                `json:"asn,omitempty"`
+	Location   shodanLocation        `json:"location"`
+	Product    string                `json:"product,omitempty"`
+	Version    string                `json:"version,omitempty"`
+	DeviceType string                `json:"devicetype"`
+	Data       string                `json:"data"`
+	Vulns      map[string]shodanVuln `json:"vulns,omitempty"`
+	Shodan     shodanMeta            `json:"_shodan"`
+	Camtruder  Result                `json:"camtruder"`
+}
+
+type shodanLocation struct {
+	CountryName string `json:"country_name,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+type shodanVuln struct {
+	Verified bool `json:"verified"`
+}
+
+type shodanMeta struct {
+	Module  string `json:"module"`
+	Crawler string `json:"crawler"`
+}
+
+// shodanWriter writes one Shodan banner per line, like Shodan's own
+// downloads
+type shodanWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (s *shodanWriter) Write(r Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(newShodanBanner(r))
+}
+
+func (s *shodanWriter) Close() error {
+	return nil
+}
+
+// newShodanBanner converts a result. The banner data is the raw probe
+// response when the scanner kept it, and the SNMP system description or
+// fingerprint otherwise.
+func newShodanBanner(r Result) shodanBanner {
+	banner := shodanBanner{
+		IPStr:      r.IP,
+		Port:       r.Port,
+		Transport:  "tcp",
+		Timestamp:  r.Timestamp.UTC().Format(shodanTimestamp),
+		Hostnames:  []string{},
+		Domains:    []string{},
+		Org:        r.Org,
+		ISP:        r.Org,
+		ASN:        r.ASN,
+		Location:   shodanLocation{CountryName: r.Country, City: r.City},
+		Product:    r.Vendor,
+		Version:    r.Firmware,
+		DeviceType: "webcam",
+		Data:       r.Response,
+		Shodan:     shodanMeta{Module: r.Protocol, Crawler: "camtruder"},
+		Camtruder:  r,
+	}
+	if ip := net.ParseIP(r.IP); ip == nil {
+		banner.Hostnames = []string{r.IP}
+	} else if ip4 := ip.To4(); ip4 != nil {
+		banner.IP = binary.BigEndian.Uint32(ip4)
+	}
+	if banner.Data == "" {
+		banner.Data = r.SysDescr
+	}
+	if banner.Data == "" {
+		banner.Data = r.Fingerprint
+	}
+	if module, ok := shodanModules[r.Protocol]; ok {
+		banner.Shodan.Module = module
+	}
+	if strings.HasPrefix(r.Vulnerability, "CVE-") {
+		banner.Vulns = map[string]shodanVuln{r.Vulnerability: {Verified: true}}
+	}
+	return banner
+}
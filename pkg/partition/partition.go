@@ -0,0 +1,153 @@
+// Package partition splits targets into subnets that are scanned side by
+// side, each with its own bounded pool of workers. A subnet whose hosts
+// all time out then only ties up its own workers, and the others keep
+// their pace.
+package partition
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+)
+
+// DefaultPrefix is the length of the IPv4 subnets targets are grouped in
+const DefaultPrefix = 24
+
+// IPv6Prefix is the length of the IPv6 subnets targets are grouped in,
+// the size of one site or LAN
+const IPv6Prefix = 64
+
+// Subnet is a group of targets scanned by one SubnetScanner
+type Subnet struct {
+	Name    string   // CIDR of the subnet, or the host name of targets given by name
+	Targets []string // ip:port targets, in the order given to Split
+	// Positions are the indexes of Targets in the list given to Split,
+	// so jobs keep their place in the feed order of a checkpoint
+	Positions []int
+}
+
+// ValidatePrefix checks an IPv4 prefix length targets are split by
+func ValidatePrefix(prefix int) error {
+	if prefix < 1 || prefix > 32 {
+		return fmt.Errorf("invalid prefix length %d, use 1 to 32", prefix)
+	}
+	return nil
+}
+
+// Split groups ip:port targets by their IPv4 /prefix or IPv6 /64 subnet.
+// Subnets are returned in the order their first target appears; targets
+// given by host name get a group of their own per name.
+func Split(targets []string, prefix int) []Subnet {
+	var subnets []Subnet
+	index := make(map[string]int)
+	for position, target := range targets {
+		name := subnetOf(target, prefix)
+		i, ok := index[name]
+		if !ok {
+			i = len(subnets)
+			index[name] = i
+			subnets = append(subnets, Subnet{Name: name})
+		}
+		subnets[i].Targets = append(subnets[i].Targets, target)
+		subnets[i].Positions = append(subnets[i].Positions, position)
+	}
+	return subnets
+}
+
+// subnetOf returns the CIDR of the subnet target belongs to
+func subnetOf(target string, prefix int) string {
+	host, _ := utils.SplitHostPort(target)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		network := net.IPNet{IP: ip4.Mask(net.CIDRMask(prefix, 32)), Mask: net.CIDRMask(prefix, 32)}
+		return network.String()
+	}
+	network := net.IPNet{IP: ip.Mask(net.CIDRMask(IPv6Prefix, 128)), Mask: net.CIDRMask(IPv6Prefix, 128)}
+	return network.String()
+}
+
+// Stats is the timing of one subnet's scan
+type Stats struct {
+	Subnet  string
+	Targets int
+	Jobs    int64         // Jobs run on the subnet's workers
+	Elapsed time.Duration // From the start of the scan until the last job finished
+}
+
+// SubnetScanner runs the jobs of one subnet on at most Workers goroutines
+type SubnetScanner struct {
+	Subnet Subnet
+
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	jobs    int64
+	start   time.Time
+	elapsed time.Duration
+}
+
+// NewSubnetScanner creates a scanner for subnet with the given number of
+// workers and starts its clock
+func NewSubnetScanner(subnet Subnet, workers int) *SubnetScanner {
+	if workers < 1 {
+		workers = 1
+	}
+	return &SubnetScanner{
+		Subnet: subnet,
+		sem:    make(chan struct{}, workers),
+		start:  time.Now(),
+	}
+}
+
+// Go waits for a free worker of the subnet, then for one of the shared
+// slots all subnets take their checks from, and runs fn on it. The caller
+// is the only goroutine of the subnet that waits for a shared slot. It
+// returns false without running fn if ctx ends first.
+func (s *SubnetScanner) Go(ctx context.Context, shared chan struct{}, fn func()) bool {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case shared <- struct{}{}:
+	case <-ctx.Done():
+		<-s.sem
+		return false
+	}
+	atomic.AddInt64(&s.jobs, 1)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			<-shared
+			<-s.sem
+		}()
+		fn()
+	}()
+	return true
+}
+
+// Wait waits for the running jobs and stops the subnet's clock
+func (s *SubnetScanner) Wait() {
+	s.wg.Wait()
+	s.elapsed = time.Since(s.start)
+}
+
+// Stats returns the timing of the subnet. Elapsed is set once Wait has
+// returned.
+func (s *SubnetScanner) Stats() Stats {
+	return Stats{
+		Subnet:  s.Subnet.Name,
+		Targets: len(s.Subnet.Targets),
+		Jobs:    atomic.LoadInt64(&s.jobs),
+		Elapsed: s.elapsed,
+	}
+}
@@ -0,0 +1,31 @@
+//go:build pcap
+
+package passive
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// snapLen is the number of bytes captured of every packet, all of them
+const snapLen = 65535
+
+// readTimeout bounds how long a live capture waits for packets before it
+// checks whether it was stopped
+const readTimeout = 500 * time.Millisecond
+
+// openLive captures iface in promiscuous mode through libpcap, keeping
+// only the packets matching filter
+func openLive(iface, filter string) (capture, error) {
+	handle, err := pcap.OpenLive(iface, snapLen, true, readTimeout)
+	if err != nil {
+		return capture{}, err
+	}
+	if err := handle.SetBPFFilter(filter); err != nil {
+		handle.Close()
+		return capture{}, fmt.Errorf("invalid capture filter: %v", err)
+	}
+	return capture{data: handle, linkType: handle.LinkType(), close: handle.Close}, nil
+}
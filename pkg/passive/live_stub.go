@@ -0,0 +1,10 @@
+//go:build !pcap
+
+package passive
+
+import "errors"
+
+// openLive fails in builds without libpcap; capture files are still read
+func openLive(iface, filter string) (capture, error) {
+	return capture{}, errors.New("built without pcap support, rebuild with -tags pcap to capture live traffic")
+}
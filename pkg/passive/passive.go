@@ -0,0 +1,349 @@
+// Package passive extracts camera credentials from captured traffic. On a
+// span port or the camera VLAN, RTSP and HTTP clients send Basic
+// credentials in the clear with every request; the TCP streams towards the
+// camera ports are reassembled and their Authorization headers decoded.
+// Nothing is sent on the network.
+//
+// Capture files are read without libpcap. Live capture needs it and is
+// only built with the pcap build tag (go build -tags pcap).
+package passive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// DefaultPorts are the camera ports captured when Options.Ports is empty
+var DefaultPorts = []int{554, 80}
+
+// streamTimeout is how long a stream may stay idle, in capture time,
+// before it is flushed and forgotten
+const streamTimeout = 2 * time.Minute
+
+// maxHeaderSize bounds the request headers buffered per stream, so a
+// stream of something other than RTSP or HTTP is dropped
+const maxHeaderSize = 16 * 1024
+
+// Credential is one pair seen in a client's request to a camera
+type Credential struct {
+	Client   string    // Address of the client that sent the pair
+	Server   string    // Address of the camera it was sent to
+	Port     int       // Camera port
+	Protocol string    // "rtsp" or "http"
+	Method   string    // Request method, e.g. DESCRIBE or GET
+	Path     string    // Request path, with its query
+	Username string    // Decoded from the Basic Authorization header
+	Password string    // Decoded from the Basic Authorization header
+	Seen     time.Time // Capture time of the request
+}
+
+// Options configures a capture. Exactly one of Interface and File is set.
+type Options struct {
+	Interface string // Network interface captured live, in promiscuous mode
+	File      string // pcap or pcapng file read instead of an interface
+	Ports     []int  // TCP ports of the cameras, DefaultPorts if empty
+
+	// OnCredential is called once for every new pair per camera port, from
+	// the capture goroutine
+	OnCredential func(Credential)
+}
+
+// pcapngMagic starts the section header block of a pcapng file
+const pcapngMagic = 0x0A0D0D0A
+
+// capture is an open packet source, a live interface or a file
+type capture struct {
+	data     gopacket.PacketDataSource
+	linkType layers.LinkType
+	close    func()
+}
+
+// Run captures until the file ends or ctx is canceled. A canceled live
+// capture is not an error.
+func Run(ctx context.Context, opts Options) error {
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = DefaultPorts
+	}
+
+	var handle capture
+	var err error
+	switch {
+	case opts.Interface != "" && opts.File != "":
+		return fmt.Errorf("capture either an interface or a file, not both")
+	case opts.Interface != "":
+		handle, err = openLive(opts.Interface, Filter(ports))
+		if err != nil {
+			return fmt.Errorf("failed to capture on %s: %v", opts.Interface, err)
+		}
+	case opts.File != "":
+		handle, err = openFile(opts.File)
+		if err != nil {
+			return fmt.Errorf("failed to open capture %s: %v", opts.File, err)
+		}
+	default:
+		return fmt.Errorf("no interface or capture file given")
+	}
+	defer handle.close()
+
+	factory := &streamFactory{
+		ports:        make(map[int]bool, len(ports)),
+		seen:         make(map[string]bool),
+		onCredential: opts.OnCredential,
+	}
+	for _, port := range ports {
+		factory.ports[port] = true
+	}
+	assembler := tcpassembly.NewAssembler(tcpassembly.NewStreamPool(factory))
+	defer assembler.FlushAll()
+
+	source := gopacket.NewPacketSource(handle.data, handle.linkType)
+	source.NoCopy = true
+	packets := source.Packets()
+
+	// Idle streams are flushed by capture time, which also works for
+	// files recorded long ago
+	var lastFlush time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case packet, ok := <-packets:
+			if !ok {
+				return nil
+			}
+			// Capture files are read without a BPF filter
+			network := packet.NetworkLayer()
+			tcp, isTCP := packet.TransportLayer().(*layers.TCP)
+			if network == nil || !isTCP || !(factory.ports[int(tcp.SrcPort)] || factory.ports[int(tcp.DstPort)]) {
+				continue
+			}
+			seen := packet.Metadata().Timestamp
+			assembler.AssembleWithTimestamp(network.NetworkFlow(), tcp, seen)
+			if seen.Sub(lastFlush) > streamTimeout/2 {
+				assembler.FlushOlderThan(seen.Add(-streamTimeout))
+				lastFlush = seen
+			}
+		}
+	}
+}
+
+// openFile opens a pcap or pcapng file, told apart by its first bytes
+func openFile(path string) (capture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return capture{}, err
+	}
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(4)
+	if err != nil {
+		f.Close()
+		return capture{}, fmt.Errorf("not a pcap or pcapng file: %v", err)
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngMagic {
+		ng, err := pcapgo.NewNgReader(r, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			f.Close()
+			return capture{}, err
+		}
+		return capture{data: ng, linkType: ng.LinkType(), close: func() { f.Close() }}, nil
+	}
+	pcapFile, err := pcapgo.NewReader(r)
+	if err != nil {
+		f.Close()
+		return capture{}, err
+	}
+	return capture{data: pcapFile, linkType: pcapFile.LinkType(), close: func() { f.Close() }}, nil
+}
+
+// Filter returns the BPF expression capturing TCP traffic of ports
+func Filter(ports []int) string {
+	terms := make([]string, len(ports))
+	for i, port := range ports {
+		terms[i] = "port " + strconv.Itoa(port)
+	}
+	return "tcp and (" + strings.Join(terms, " or ") + ")"
+}
+
+// streamFactory creates a stream per TCP direction and remembers the
+// pairs already reported
+type streamFactory struct {
+	ports        map[int]bool
+	onCredential func(Credential)
+	seen         map[string]bool // Reported pairs by camera address, port and pair
+}
+
+func (f *streamFactory) New(netFlow, tcpFlow gopacket.Flow) tcpassembly.Stream {
+	port, _ := strconv.Atoi(tcpFlow.Dst().String())
+	return &stream{
+		factory: f,
+		client:  netFlow.Src().String(),
+		server:  netFlow.Dst().String(),
+		port:    port,
+		// Replies from the camera carry no credentials and are skipped
+		request: f.ports[port],
+	}
+}
+
+// report calls onCredential unless the pair was already reported for the
+// camera port
+func (f *streamFactory) report(cred Credential) {
+	key := fmt.Sprintf("%s|%d|%s|%s", cred.Server, cred.Port, cred.Username, cred.Password)
+	if f.seen[key] {
+		return
+	}
+	f.seen[key] = true
+	if f.onCredential != nil {
+		f.onCredential(cred)
+	}
+}
+
+// stream parses the requests of one client-to-camera direction
+type stream struct {
+	factory        *streamFactory
+	client, server string
+	port           int
+	request        bool
+
+	buf  []byte
+	skip int // Bytes of a request body or interleaved frame still to skip
+}
+
+func (s *stream) Reassembled(reassemblies []tcpassembly.Reassembly) {
+	if !s.request {
+		return
+	}
+	for _, r := range reassemblies {
+		// After lost segments the stream resynchronizes on the next
+		// complete header block
+		if r.Skip != 0 {
+			s.buf = s.buf[:0]
+			s.skip = 0
+		}
+		s.buf = append(s.buf, r.Bytes...)
+		s.parse(r.Seen)
+	}
+}
+
+func (s *stream) ReassemblyComplete() {
+	s.buf = nil
+}
+
+// parse reports the credentials of every complete request in the buffer
+// and keeps the rest for the next segment
+func (s *stream) parse(seen time.Time) {
+	for {
+		if s.skip > 0 {
+			n := s.skip
+			if n > len(s.buf) {
+				n = len(s.buf)
+			}
+			s.buf = s.buf[n:]
+			s.skip -= n
+			if s.skip > 0 {
+				return
+			}
+		}
+		if len(s.buf) == 0 {
+			return
+		}
+
+		// RTSP clients interleave RTCP reports as $, channel, length
+		if s.buf[0] == '$' {
+			if len(s.buf) < 4 {
+				return
+			}
+			s.skip = 4 + int(binary.BigEndian.Uint16(s.buf[2:4]))
+			continue
+		}
+
+		end := bytes.Index(s.buf, []byte("\r\n\r\n"))
+		if end < 0 {
+			if len(s.buf) > maxHeaderSize {
+				s.buf = s.buf[:0]
+			}
+			return
+		}
+		header := string(s.buf[:end])
+		s.buf = s.buf[end+4:]
+
+		cred, bodyLen, ok := parseRequest(header)
+		s.skip = bodyLen
+		if ok {
+			cred.Client = s.client
+			cred.Server = s.server
+			cred.Port = s.port
+			cred.Seen = seen
+			s.factory.report(cred)
+		}
+	}
+}
+
+// parseRequest reads the request line and headers of an RTSP or HTTP
+// request. It returns the length of the body that follows and whether
+// the request carried Basic credentials.
+func parseRequest(header string) (cred Credential, bodyLen int, ok bool) {
+	lines := strings.Split(header, "\r\n")
+	// Leftovers of a lost segment may precede the request line
+	for len(lines) > 0 && len(strings.Fields(lines[0])) != 3 {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return Credential{}, 0, false
+	}
+	fields := strings.Fields(lines[0])
+	method, uri, version := fields[0], fields[1], fields[2]
+	switch {
+	case strings.HasPrefix(version, "RTSP/"):
+		cred.Protocol = "rtsp"
+	case strings.HasPrefix(version, "HTTP/"):
+		cred.Protocol = "http"
+	default:
+		return Credential{}, 0, false
+	}
+	cred.Method = method
+	cred.Path = uri
+	if u, err := url.Parse(uri); err == nil && u.IsAbs() {
+		cred.Path = u.RequestURI()
+	}
+
+	for _, line := range lines[1:] {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "content-length":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				bodyLen = n
+			}
+		case "authorization":
+			scheme, encoded, _ := strings.Cut(value, " ")
+			if !strings.EqualFold(scheme, "Basic") {
+				// Digest responses do not give the password away
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+			if err != nil {
+				continue
+			}
+			cred.Username, cred.Password, ok = strings.Cut(string(decoded), ":")
+		}
+	}
+	return cred, bodyLen, ok
+}
@@ -0,0 +1,171 @@
+// Package portscan checks with TCP connect probes which ports of the scan
+// targets are open, so protocol tests only run against reachable services.
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+)
+
+// DefaultTimeout is the time allowed for one connect probe
+const DefaultTimeout = 500 * time.Millisecond
+
+// DefaultWorkers bounds the number of probes in flight
+const DefaultWorkers = 1000
+
+// DefaultPorts are the camera ports checked on every host: RTSP and web
+// interfaces. Only ports the RTSP or HTTP tests speak belong here, since
+// every open port is handed to them.
+var DefaultPorts = []int{554, 80, 8080, 8554}
+
+// Options configures a port check
+type Options struct {
+	Ports   []int         // Ports checked on every host besides the target's own port
+	Timeout time.Duration // Time allowed for one connect probe
+	Workers int           // Probes in flight, DefaultWorkers if not set
+	Dialer  dialer.ContextDialer
+	OnOpen  func(target string) // Called for every open port, may be nil
+
+	// Classify is called for every open port after OnOpen and drops the
+	// port when it returns false, may be nil. It runs in the goroutine of
+	// the probe, so Workers also bounds the classifications in flight.
+	Classify func(ctx context.Context, target string) bool
+}
+
+// ParsePorts parses a comma separated port list such as "554,80,8080"
+func ParsePorts(s string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", field)
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// FormatPorts formats ports as the comma separated list ParsePorts reads
+func FormatPorts(ports []int) string {
+	fields := make([]string, len(ports))
+	for i, port := range ports {
+		fields[i] = strconv.Itoa(port)
+	}
+	return strings.Join(fields, ",")
+}
+
+// Check probes the port of every ip:port target and opts.Ports on its
+// host, one goroutine per port and host, and returns the open ip:port
+// pairs. Hosts keep the order of targets and their ports the order they
+// were listed in, with the target's own port first. An interrupted check
+// returns the ports found so far with the context error.
+func Check(ctx context.Context, targets []string, opts Options) ([]string, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	netDialer := opts.Dialer
+	if netDialer == nil {
+		netDialer = &net.Dialer{Timeout: timeout}
+	}
+
+	// Collect the ports of each host so every pair is probed once
+	var hosts []string
+	hostPorts := make(map[string][]int)
+	for _, target := range targets {
+		host, port := utils.SplitHostPort(target)
+		if _, ok := hostPorts[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		hostPorts[host] = appendPort(hostPorts[host], port)
+	}
+	for _, host := range hosts {
+		for _, port := range opts.Ports {
+			hostPorts[host] = appendPort(hostPorts[host], port)
+		}
+	}
+
+	// Probe results are stored by position to keep the output ordered
+	type probe struct {
+		target string
+		open   bool
+	}
+	var probes []*probe
+	for _, host := range hosts {
+		for _, port := range hostPorts[host] {
+			probes = append(probes, &probe{target: utils.FormatTarget(host, port)})
+		}
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, p := range probes {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(p *probe) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if utils.ScanPort(ctx, netDialer, p.target, timeout) {
+				if opts.OnOpen != nil {
+					opts.OnOpen(p.target)
+				}
+				p.open = opts.Classify == nil || opts.Classify(ctx, p.target)
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	var open []string
+	for _, p := range probes {
+		if p.open {
+			open = append(open, p.target)
+		}
+	}
+	return open, ctx.Err()
+}
+
+// Hosts returns the number of distinct hosts among ip:port targets
+func Hosts(targets []string) int {
+	hosts := make(map[string]bool)
+	for _, target := range targets {
+		host, _ := utils.SplitHostPort(target)
+		hosts[host] = true
+	}
+	return len(hosts)
+}
+
+// appendPort adds port to ports unless it is already listed
+func appendPort(ports []int, port int) []int {
+	for _, p := range ports {
+		if p == port {
+			return ports
+		}
+	}
+	return append(ports, port)
+}
@@ -0,0 +1,224 @@
+// Package axis validates credentials against the VAPIX HTTP API of Axis
+// cameras and enumerates the RTSP stream of every video channel.
+package axis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	httpprobe "github.com/ALW1EZ/camtruder/pkg/probe/http"
+)
+
+// maxBodySize limits how much of a response body is read
+const maxBodySize = 64 * 1024
+
+// defaultRTSPPort is used when the RTSP configuration cannot be read
+const defaultRTSPPort = 554
+
+// maxChannels is the number of channels asked from videostatus.cgi
+const maxChannels = 16
+
+// VAPIX endpoints
+const (
+	userGroupPath   = "/axis-cgi/usergroup.cgi"
+	videoStatusPath = "/axis-cgi/videostatus.cgi"
+	paramPath       = "/axis-cgi/param.cgi?action=list&group=Properties.API,Brand.ProdNbr,Network.RTSP.Port"
+)
+
+// videoStatusLine matches "Video 1 = video" lines of videostatus.cgi
+var videoStatusLine = regexp.MustCompile(`^Video\s+(\d+)\s*=\s*(.+)$`)
+
+// Stream is the RTSP stream of one video channel
+type Stream struct {
+	Channel int    // 1-based channel number
+	Path    string // Path and query of the stream URL
+	URL     string // Authenticated rtsp:// URL
+}
+
+// Result represents the outcome of a VAPIX login attempt
+type Result struct {
+	Success    bool
+	Groups     []string // Groups of the user, e.g. admin, operator, viewer
+	APIVersion string   // VAPIX HTTP API version, e.g. "3", empty if unknown
+	Model      string   // Product number reported by the device, may be empty
+	RTSPPort   int
+	Streams    []Stream
+}
+
+// Options configures a Prober
+type Options struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Dialer         dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLSConfig      *tls.Config          // Used for https:// URLs, nil for the defaults
+	Headers        map[string]string    // Extra headers sent with every request
+}
+
+// Prober tests credentials against the Axis VAPIX API
+type Prober struct {
+	Client  *http.Client
+	Headers map[string]string // Extra headers sent with every request
+}
+
+// NewProber creates a prober from the given options
+func NewProber(opts Options) *Prober {
+	var netDialer dialer.ContextDialer = &net.Dialer{Timeout: opts.ConnectTimeout}
+	if opts.Dialer != nil {
+		netDialer = opts.Dialer
+	}
+	return &Prober{
+		Client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:           netDialer.DialContext,
+				ResponseHeaderTimeout: opts.ReadTimeout,
+				DisableKeepAlives:     true,
+				TLSClientConfig:       opts.TLSConfig,
+			},
+			Timeout: opts.ConnectTimeout + opts.ReadTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Headers: opts.Headers,
+	}
+}
+
+// TestCredentials logs in to the camera at baseURL (e.g. http://host:80)
+// with Basic auth and, on success, returns the authenticated RTSP URL of
+// every video channel. Rejected credentials are reported without an error.
+func (p *Prober) TestCredentials(ctx context.Context, baseURL, username, password string) (Result, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid URL: %v", err)
+	}
+
+	status, body, err := p.get(ctx, baseURL+userGroupPath, username, password)
+	if err != nil {
+		return Result{}, err
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return Result{}, nil
+	default:
+		return Result{}, fmt.Errorf("not a VAPIX endpoint (HTTP %d)", status)
+	}
+
+	// usergroup.cgi answers with the user name and a comma separated list
+	// of groups on the next line
+	result := Result{Success: true, RTSPPort: defaultRTSPPort}
+	if lines := strings.Split(strings.TrimSpace(body), "\n"); len(lines) > 1 {
+		for _, group := range strings.Split(lines[1], ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				result.Groups = append(result.Groups, group)
+			}
+		}
+	}
+
+	if status, body, err := p.get(ctx, baseURL+paramPath, username, password); err == nil && status == http.StatusOK {
+		params := parseParams(body)
+		result.APIVersion = params["root.Properties.API.HTTP.Version"]
+		result.Model = params["root.Brand.ProdNbr"]
+		if port, err := strconv.Atoi(params["root.Network.RTSP.Port"]); err == nil && port > 0 {
+			result.RTSPPort = port
+		}
+	}
+
+	channels := []int{1}
+	if found := p.channels(ctx, baseURL, username, password); len(found) > 0 {
+		channels = found
+	}
+
+	host := net.JoinHostPort(u.Hostname(), strconv.Itoa(result.RTSPPort))
+	userInfo := url.UserPassword(username, password)
+	for _, channel := range channels {
+		path := streamPath(result.APIVersion, channel)
+		result.Streams = append(result.Streams, Stream{
+			Channel: channel,
+			Path:    path,
+			URL:     fmt.Sprintf("rtsp://%s@%s%s", userInfo.String(), host, path),
+		})
+	}
+
+	return result, nil
+}
+
+// streamPath returns the RTSP path of a channel. VAPIX 3 serves every
+// codec from axis-media/media.amp; VAPIX 2 firmware has a path per codec
+// and only MPEG-4 is available on all of it.
+func streamPath(apiVersion string, channel int) string {
+	if major, _, _ := strings.Cut(apiVersion, "."); major == "2" || major == "1" {
+		return fmt.Sprintf("/mpeg4/%d/media.amp", channel)
+	}
+	return fmt.Sprintf("/axis-media/media.amp?camera=%d", channel)
+}
+
+// channels lists the channels videostatus.cgi reports a video signal on
+func (p *Prober) channels(ctx context.Context, baseURL, username, password string) []int {
+	query := make([]string, maxChannels)
+	for i := range query {
+		query[i] = strconv.Itoa(i + 1)
+	}
+	status, body, err := p.get(ctx, baseURL+videoStatusPath+"?status="+strings.Join(query, ","), username, password)
+	if err != nil || status != http.StatusOK {
+		return nil
+	}
+
+	var channels []int
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		m := videoStatusLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil || !strings.EqualFold(strings.TrimSpace(m[2]), "video") {
+			continue
+		}
+		if channel, err := strconv.Atoi(m[1]); err == nil {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// parseParams parses the key=value lines of param.cgi
+func parseParams(body string) map[string]string {
+	params := make(map[string]string)
+	for _, line := range strings.Split(body, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			params[key] = value
+		}
+	}
+	return params
+}
+
+// get performs an authenticated GET and returns the status and body
+func (p *Prober) get(ctx context.Context, target, username, password string) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create request: %v", err)
+	}
+	httpprobe.SetHeaders(req, p.Headers)
+	req.SetBasicAuth(username, password)
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, string(data), nil
+}
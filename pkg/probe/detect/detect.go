@@ -0,0 +1,204 @@
+// Package detect tells which camera protocol a port speaks. An RTSP
+// OPTIONS request, an HTTP GET and an ONVIF GetSystemDateAndTime call are
+// sent at once on separate connections, and the first reply that names
+// its protocol decides.
+package detect
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+)
+
+// Protocol is a protocol a camera port is tested with
+type Protocol string
+
+// Detected protocols. ONVIF services are web servers and are tested like
+// other web interfaces.
+const (
+	RTSP  Protocol = "rtsp"
+	HTTP  Protocol = "http"
+	ONVIF Protocol = "onvif"
+)
+
+// IsWeb reports whether the port is tested over HTTP
+func (p Protocol) IsWeb() bool {
+	return p == HTTP || p == ONVIF
+}
+
+// DefaultTimeout is the time allowed for each probe
+const DefaultTimeout = 3 * time.Second
+
+// ErrUnknown is returned when no probe got a reply it recognized
+var ErrUnknown = errors.New("no known protocol answered")
+
+// maxReplySize bounds how much of a reply is read
+const maxReplySize = 8 * 1024
+
+// onvifPath is the ONVIF device service, see onvif.DevicePath
+const onvifPath = "/onvif/device_service"
+
+// getSystemDateAndTime is the one ONVIF call devices answer without
+// authentication
+const getSystemDateAndTime = `<?xml version="1.0" encoding="UTF-8"?>` +
+	`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">` +
+	`<s:Body><GetSystemDateAndTime xmlns="http://www.onvif.org/ver10/device/wsdl"/></s:Body>` +
+	`</s:Envelope>`
+
+// Options configures a Detector
+type Options struct {
+	Timeout   time.Duration        // Time allowed for each probe, DefaultTimeout if not set
+	Dialer    dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLS       bool                 // Probe over TLS, for rtsps and https ports
+	TLSConfig *tls.Config          // TLS client settings, nil for the defaults
+}
+
+// Detector probes ports for their protocol
+type Detector struct {
+	timeout   time.Duration
+	dialer    dialer.ContextDialer
+	tls       bool
+	tlsConfig *tls.Config
+}
+
+// New creates a detector from the given options
+func New(opts Options) *Detector {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	netDialer := opts.Dialer
+	if netDialer == nil {
+		netDialer = &net.Dialer{Timeout: timeout}
+	}
+	tlsConfig := opts.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &Detector{timeout: timeout, dialer: netDialer, tls: opts.TLS, tlsConfig: tlsConfig}
+}
+
+// Detect probes addr with the default options
+func Detect(ctx context.Context, addr string) (Protocol, error) {
+	return New(Options{}).Detect(ctx, addr)
+}
+
+// Detect sends every probe to the host:port addr in parallel and returns
+// the protocol of the first recognized reply
+func (d *Detector) Detect(ctx context.Context, addr string) (Protocol, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	probes := []func(context.Context, string) (Protocol, error){d.probeRTSP, d.probeHTTP, d.probeONVIF}
+	type answer struct {
+		protocol Protocol
+		err      error
+	}
+	answers := make(chan answer, len(probes))
+	for _, probe := range probes {
+		go func(probe func(context.Context, string) (Protocol, error)) {
+			protocol, err := probe(ctx, addr)
+			answers <- answer{protocol, err}
+		}(probe)
+	}
+
+	var firstErr error
+	for range probes {
+		a := <-answers
+		if a.err == nil {
+			// The other probes are canceled on return
+			return a.protocol, nil
+		}
+		if firstErr == nil && !errors.Is(a.err, ErrUnknown) {
+			firstErr = a.err
+		}
+	}
+	if ctx.Err() != nil && firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return "", fmt.Errorf("%v: %v", ErrUnknown, firstErr)
+	}
+	return "", ErrUnknown
+}
+
+func (d *Detector) probeRTSP(ctx context.Context, addr string) (Protocol, error) {
+	request := fmt.Sprintf("OPTIONS rtsp://%s/ RTSP/1.0\r\nCSeq: 1\r\nUser-Agent: camtruder\r\n\r\n", addr)
+	return d.probe(ctx, addr, request, nil)
+}
+
+func (d *Detector) probeHTTP(ctx context.Context, addr string) (Protocol, error) {
+	request := fmt.Sprintf("GET / HTTP/1.1\r\nHost: %s\r\nUser-Agent: camtruder\r\nConnection: close\r\n\r\n", addr)
+	return d.probe(ctx, addr, request, nil)
+}
+
+func (d *Detector) probeONVIF(ctx context.Context, addr string) (Protocol, error) {
+	request := fmt.Sprintf("POST %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: camtruder\r\n"+
+		"Content-Type: application/soap+xml; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		onvifPath, addr, len(getSystemDateAndTime), getSystemDateAndTime)
+	return d.probe(ctx, addr, request, func(reply string) bool {
+		return strings.Contains(reply, "GetSystemDateAndTimeResponse")
+	})
+}
+
+// probe sends request on a new connection and classifies the reply by its
+// status line. RTSP servers answering an HTTP probe are still RTSP. An HTTP
+// reply counts as ONVIF when isONVIF accepts its beginning.
+func (d *Detector) probe(ctx context.Context, addr, request string, isONVIF func(reply string) bool) (Protocol, error) {
+	conn, err := d.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if d.tls {
+		tlsConn := tls.Client(conn, d.tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return "", err
+		}
+		conn = tlsConn
+	}
+
+	deadline := time.Now().Add(d.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+	// Unblock the read as soon as another probe has answered
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := io.WriteString(conn, request); err != nil {
+		return "", err
+	}
+	reader := bufio.NewReader(io.LimitReader(conn, maxReplySize))
+	status, err := reader.ReadString('\n')
+	if err != nil && status == "" {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(status, "RTSP/"):
+		return RTSP, nil
+	case strings.HasPrefix(status, "HTTP/"):
+		if isONVIF == nil {
+			return HTTP, nil
+		}
+		rest, _ := io.ReadAll(reader)
+		if isONVIF(string(rest)) {
+			return ONVIF, nil
+		}
+		// Left to the HTTP probe so a plain web server is not reported
+		// by the ONVIF probe first
+		return "", ErrUnknown
+	default:
+		return "", ErrUnknown
+	}
+}
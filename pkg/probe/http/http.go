@@ -0,0 +1,382 @@
+// Package http probes camera web interfaces for valid HTTP credentials.
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+)
+
+// maxBodySize limits how much of a response body is kept
+const maxBodySize = 64 * 1024
+
+// Authentication schemes reported in Result
+const (
+	SchemeNone   = "none"
+	SchemeBasic  = "basic"
+	SchemeDigest = "digest"
+)
+
+// Result represents the outcome of an HTTP credential test
+type Result struct {
+	Success      bool
+	AuthRequired bool   // Server answered the anonymous request with 401
+	Scheme       string // Scheme that was accepted, or SchemeNone
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+}
+
+// Prober tests credentials against HTTP camera interfaces
+type Prober struct {
+	Client     *http.Client
+	ForceBasic bool              // Never attempt Digest authentication
+	Headers    map[string]string // Extra headers sent with every request
+
+	// Login is called before every request that carries credentials, e.g.
+	// to pace logins per host. An error aborts the test with that error.
+	Login func(ctx context.Context, rawURL string) error
+}
+
+// Options configures a Prober
+type Options struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Dialer         dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLSConfig      *tls.Config          // Used for https:// URLs, nil for the defaults
+	ForceBasic     bool
+	Headers        map[string]string // Extra headers sent with every request, e.g. X-Forwarded-For or Cookie
+	Login          func(ctx context.Context, rawURL string) error
+}
+
+// NewProber creates a prober from the given options
+func NewProber(opts Options) *Prober {
+	var netDialer dialer.ContextDialer = &net.Dialer{Timeout: opts.ConnectTimeout}
+	if opts.Dialer != nil {
+		netDialer = opts.Dialer
+	}
+	transport := &http.Transport{
+		DialContext:           netDialer.DialContext,
+		ResponseHeaderTimeout: opts.ReadTimeout,
+		DisableKeepAlives:     true,
+		TLSClientConfig:       opts.TLSConfig,
+	}
+	return &Prober{
+		Client: &http.Client{
+			Transport: transport,
+			Timeout:   opts.ConnectTimeout + opts.ReadTimeout,
+			// Camera login pages often redirect; the status of the first
+			// response is what tells us whether credentials were accepted
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		ForceBasic: opts.ForceBasic,
+		Headers:    opts.Headers,
+		Login:      opts.Login,
+	}
+}
+
+// TestCredentials requests rawURL anonymously and, if the server asks for
+// authentication, retries with Digest (when advertised) and then Basic.
+func (p *Prober) TestCredentials(ctx context.Context, rawURL, username, password string) (Result, error) {
+	return p.Request(ctx, http.MethodGet, rawURL, "", nil, username, password)
+}
+
+// Request sends a request with the given method and body the same way
+// TestCredentials does, for APIs that need more than a GET. contentType is
+// only set when body is not nil.
+func (p *Prober) Request(ctx context.Context, method, rawURL, contentType string, body []byte, username, password string) (Result, error) {
+	send := func(authorization string) (Result, error) {
+		if authorization != "" && p.Login != nil {
+			if err := p.Login(ctx, rawURL); err != nil {
+				return Result{}, err
+			}
+		}
+		return p.do(ctx, method, rawURL, contentType, body, authorization)
+	}
+
+	resp, err := send("")
+	if err != nil {
+		return Result{}, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		resp.AuthRequired = false
+		resp.Scheme = SchemeNone
+		return resp, nil
+	}
+
+	challenges := resp.Header.Values("WWW-Authenticate")
+	if !p.ForceBasic {
+		if challenge, ok := findChallenge(challenges, "digest"); ok {
+			auth, err := digestAuthorization(challenge, method, requestURI(rawURL), username, password)
+			if err == nil {
+				digestResp, err := send(auth)
+				if err != nil {
+					return Result{}, err
+				}
+				digestResp.AuthRequired = true
+				if isSuccess(digestResp.StatusCode) {
+					digestResp.Success = true
+					digestResp.Scheme = SchemeDigest
+					return digestResp, nil
+				}
+				// Servers that only speak Digest will not accept Basic
+				if _, hasBasic := findChallenge(challenges, "basic"); !hasBasic {
+					return digestResp, nil
+				}
+			}
+		}
+	}
+
+	basicAuth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	basicResp, err := send("Basic " + basicAuth)
+	if err != nil {
+		return Result{}, err
+	}
+	basicResp.AuthRequired = true
+	if isSuccess(basicResp.StatusCode) {
+		basicResp.Success = true
+		basicResp.Scheme = SchemeBasic
+	}
+	return basicResp, nil
+}
+
+// do performs a single request with an optional Authorization header
+func (p *Prober) do(ctx context.Context, method, rawURL, contentType string, body []byte, authorization string) (Result, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	if body != nil && contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	SetHeaders(req, p.Headers)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	return Result{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       respBody,
+	}, nil
+}
+
+// ParseHeaders builds extra request headers from "Name: Value" headers
+// and "name=value" cookies. The cookies are sent in one Cookie header,
+// after the value of a Cookie header given among headers.
+func ParseHeaders(headers, cookies []string) (map[string]string, error) {
+	if len(headers) == 0 && len(cookies) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]string)
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header %q, use \"Name: Value\"", header)
+		}
+		parsed[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	var jar []string
+	if existing := parsed["Cookie"]; existing != "" {
+		jar = append(jar, existing)
+	}
+	for _, cookie := range cookies {
+		name, _, ok := strings.Cut(cookie, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid cookie %q, use name=value", cookie)
+		}
+		jar = append(jar, strings.TrimSpace(cookie))
+	}
+	if len(jar) > 0 {
+		parsed["Cookie"] = strings.Join(jar, "; ")
+	}
+	return parsed, nil
+}
+
+// SetHeaders adds extra headers to req, replacing any the prober set. A
+// Host header changes the host the request is addressed to, not the one
+// it is sent to.
+func SetHeaders(req *http.Request, headers map[string]string) {
+	for name, value := range headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+}
+
+// isSuccess reports whether a status code means the credentials were accepted
+func isSuccess(code int) bool {
+	return code >= 200 && code < 400
+}
+
+// requestURI returns the path and query of a URL as sent in the request line
+func requestURI(rawURL string) string {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "/"
+	}
+	return req.URL.RequestURI()
+}
+
+// findChallenge returns the parameters of the first challenge using scheme
+func findChallenge(headers []string, scheme string) (map[string]string, bool) {
+	for _, header := range headers {
+		name, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if strings.EqualFold(name, scheme) {
+			return parseParams(rest), true
+		}
+	}
+	return nil, false
+}
+
+// parseParams parses comma separated key=value pairs with optional quoting
+func parseParams(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					b.WriteByte(s[i])
+					continue
+				}
+				if s[i] == '"' {
+					break
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// digestAuthorization computes an RFC 7616 Digest Authorization header
+func digestAuthorization(challenge map[string]string, method, uri, username, password string) (string, error) {
+	realm := challenge["realm"]
+	nonce := challenge["nonce"]
+	if nonce == "" {
+		return "", fmt.Errorf("digest challenge without nonce")
+	}
+
+	algorithm := challenge["algorithm"]
+	var newHash func() hash.Hash
+	sess := strings.HasSuffix(strings.ToUpper(algorithm), "-SESS")
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+	h := func(s string) string {
+		hasher := newHash()
+		io.WriteString(hasher, s)
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	cnonce, err := randomHex(8)
+	if err != nil {
+		return "", err
+	}
+	const nc = "00000001"
+
+	ha1 := h(username + ":" + realm + ":" + password)
+	if sess {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	qop := ""
+	for _, option := range strings.Split(challenge["qop"], ",") {
+		if strings.TrimSpace(option) == "auth" {
+			qop = "auth"
+			break
+		}
+	}
+
+	var response string
+	if qop != "" {
+		response = h(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, realm, nonce, uri, response)
+	if algorithm != "" {
+		fmt.Fprintf(&b, ", algorithm=%s", algorithm)
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		fmt.Fprintf(&b, `, opaque="%s"`, opaque)
+	}
+	if qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	return b.String(), nil
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
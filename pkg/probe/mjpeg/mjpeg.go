@@ -0,0 +1,231 @@
+// Package mjpeg finds MJPEG-over-HTTP streams on camera web interfaces and
+// reads their first JPEG frame.
+package mjpeg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	httpprobe "github.com/ALW1EZ/camtruder/pkg/probe/http"
+)
+
+// maxFrameSize limits the size of a frame and how far into a stream a
+// frame is searched for
+const maxFrameSize = 4 * 1024 * 1024
+
+// DefaultFrameTimeout is used when Options.FrameTimeout is not set
+const DefaultFrameTimeout = 10 * time.Second
+
+// JPEG start and end of image markers
+var (
+	jpegSOI = []byte{0xFF, 0xD8}
+	jpegEOI = []byte{0xFF, 0xD9}
+)
+
+// Result represents the outcome of a stream search
+type Result struct {
+	Found       bool
+	Path        string // Path the stream was found on
+	ContentType string // Content-Type of the stream, including its boundary
+	Frame       []byte // First JPEG frame, nil if it could not be read
+	AuthPath    string // First path that asked for credentials, set when no stream was found
+}
+
+// Options configures a Prober
+type Options struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	FrameTimeout   time.Duration        // Time allowed to read the first frame of a stream
+	Dialer         dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLSConfig      *tls.Config          // Used for https:// URLs, nil for the defaults
+	Headers        map[string]string    // Extra headers sent with every request
+}
+
+// Prober searches camera web interfaces for MJPEG streams
+type Prober struct {
+	Client       *http.Client
+	Headers      map[string]string // Extra headers sent with every request
+	frameTimeout time.Duration
+}
+
+// NewProber creates a prober from the given options. Streams never end, so
+// the client has no overall timeout; each request is bounded by the read
+// and frame timeouts instead.
+func NewProber(opts Options) *Prober {
+	var netDialer dialer.ContextDialer = &net.Dialer{Timeout: opts.ConnectTimeout}
+	if opts.Dialer != nil {
+		netDialer = opts.Dialer
+	}
+	frameTimeout := opts.FrameTimeout
+	if frameTimeout <= 0 {
+		frameTimeout = DefaultFrameTimeout
+	}
+	return &Prober{
+		Client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:           netDialer.DialContext,
+				ResponseHeaderTimeout: opts.ReadTimeout,
+				DisableKeepAlives:     true,
+				TLSClientConfig:       opts.TLSConfig,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Headers:      opts.Headers,
+		frameTimeout: frameTimeout,
+	}
+}
+
+// Find requests each path below baseURL (e.g. http://host:80) until one
+// serves a multipart/x-mixed-replace stream and returns its first frame.
+// Credentials are sent with Basic auth unless username is empty.
+func (p *Prober) Find(ctx context.Context, baseURL, username, password string, paths []string) (Result, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	var result Result
+	var lastErr error
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		stream, status, err := p.open(ctx, baseURL+path, username, password)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if status == http.StatusUnauthorized && result.AuthPath == "" {
+			result.AuthPath = path
+		}
+		if stream.Found {
+			stream.Path = path
+			return stream, nil
+		}
+	}
+	if result.AuthPath == "" && lastErr != nil {
+		return result, lastErr
+	}
+	return result, nil
+}
+
+// open requests one stream URL and reads its first frame if it is an
+// MJPEG stream
+func (p *Prober) open(ctx context.Context, target, username, password string) (Result, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.frameTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return Result{}, 0, fmt.Errorf("failed to create request: %v", err)
+	}
+	httpprobe.SetHeaders(req, p.Headers)
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return Result{}, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, resp.StatusCode, nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.EqualFold(mediaType, "multipart/x-mixed-replace") {
+		return Result{}, resp.StatusCode, nil
+	}
+
+	// A stream whose frame cannot be read in time is still reported
+	result := Result{Found: true, ContentType: contentType}
+	if frame, err := FirstFrame(resp.Body, params["boundary"]); err == nil {
+		result.Frame = frame
+	}
+	return result, resp.StatusCode, nil
+}
+
+// FirstFrame reads the first JPEG part of a multipart/x-mixed-replace
+// body. Cameras disagree on how many dashes precede the boundary, and some
+// send none at all, so any line starting with "--" or equal to boundary
+// starts a part. Parts without a Content-Length are cut at the JPEG end of
+// image marker. Chunked transfer encoding is removed by net/http.
+func FirstFrame(body io.Reader, boundary string) ([]byte, error) {
+	r := bufio.NewReaderSize(io.LimitReader(body, 2*maxFrameSize), 64*1024)
+
+	// Some cameras leave out the part headers and send bare frames
+	if start, err := r.Peek(len(jpegSOI)); err == nil && bytes.Equal(start, jpegSOI) {
+		return readJPEG(r)
+	}
+
+	tp := textproto.NewReader(r)
+	boundary = strings.TrimLeft(boundary, "-")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return nil, fmt.Errorf("no part boundary found: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "--") || (boundary != "" && line == boundary) {
+			break
+		}
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return nil, fmt.Errorf("failed to read part header: %v", err)
+	}
+	if n, err := strconv.Atoi(header.Get("Content-Length")); err == nil && n > 0 && n <= maxFrameSize {
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil, fmt.Errorf("failed to read frame: %v", err)
+		}
+		if bytes.HasPrefix(frame, jpegSOI) {
+			return frame, nil
+		}
+		return nil, errors.New("first part is not a JPEG image")
+	}
+	return readJPEG(r)
+}
+
+// readJPEG reads from the next start of image marker up to and including
+// the following end of image marker
+func readJPEG(r *bufio.Reader) ([]byte, error) {
+	var frame []byte
+	var prev byte
+	started := false
+	for len(frame) < maxFrameSize {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("incomplete frame: %v", err)
+		}
+		if !started {
+			if prev == jpegSOI[0] && b == jpegSOI[1] {
+				started = true
+				frame = append(frame, jpegSOI...)
+			}
+			prev = b
+			continue
+		}
+		frame = append(frame, b)
+		if prev == jpegEOI[0] && b == jpegEOI[1] {
+			return frame, nil
+		}
+		prev = b
+	}
+	return nil, fmt.Errorf("no complete frame in the first %d bytes", maxFrameSize)
+}
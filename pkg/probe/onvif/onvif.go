@@ -0,0 +1,473 @@
+// Package onvif calls ONVIF web services on cameras. Requests carry a
+// WS-Security UsernameToken and are retried with HTTP Digest or Basic
+// authentication when the device asks for it.
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	httpprobe "github.com/ALW1EZ/camtruder/pkg/probe/http"
+)
+
+// DevicePath is where the device management service is usually served
+const DevicePath = "/onvif/device_service"
+
+// Service namespaces used in request bodies
+const (
+	NamespaceDevice = "http://www.onvif.org/ver10/device/wsdl"
+	NamespaceMedia  = "http://www.onvif.org/ver10/media/wsdl"
+	NamespacePTZ    = "http://www.onvif.org/ver20/ptz/wsdl"
+	NamespaceSchema = "http://www.onvif.org/ver10/schema"
+)
+
+// Stream types of GetStreamUri
+const (
+	StreamUnicast   = "RTP-Unicast"
+	StreamMulticast = "RTP-Multicast"
+)
+
+// soapContentType is the SOAP 1.2 content type ONVIF services expect
+const soapContentType = `application/soap+xml; charset=utf-8`
+
+// ErrUnauthorized is returned when the device rejects the credentials
+var ErrUnauthorized = errors.New("credentials rejected")
+
+// Capabilities holds the service addresses a device reported
+type Capabilities struct {
+	Media string // Media service address, empty if not supported
+	PTZ   string // PTZ service address, empty if the device has no PTZ
+}
+
+// DeviceInformation identifies a device
+type DeviceInformation struct {
+	Manufacturer    string `xml:"Manufacturer"`
+	Model           string `xml:"Model"`
+	FirmwareVersion string `xml:"FirmwareVersion"`
+	SerialNumber    string `xml:"SerialNumber"`
+	HardwareID      string `xml:"HardwareId"`
+}
+
+// Profile is a media profile of a device
+type Profile struct {
+	Token string
+	Name  string
+	PTZ   bool // Profile has a PTZ configuration
+
+	// VideoSource is the token of the video source the profile encodes
+	VideoSource string
+	// Encoding, Width, Height and FrameRate describe the video encoder
+	// configuration, zero if the profile has none
+	Encoding  string
+	Width     int
+	Height    int
+	FrameRate float64
+}
+
+// VideoSource is a video input of a device, such as one camera sensor
+type VideoSource struct {
+	Token     string
+	Width     int
+	Height    int
+	FrameRate float64
+}
+
+// Stream is a stream URI of a media profile
+type Stream struct {
+	Profile       Profile
+	Type          string // StreamUnicast or StreamMulticast
+	URI           string
+	Width, Height int     // Encoded resolution, or that of the video source
+	FrameRate     float64 // Encoder frame rate limit, or that of the video source
+}
+
+// Options configures a Prober
+type Options struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Dialer         dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLSConfig      *tls.Config          // Used for https:// URLs, nil for the defaults
+	Headers        map[string]string    // Extra headers sent with every request
+}
+
+// Prober calls ONVIF services
+type Prober struct {
+	http *httpprobe.Prober
+}
+
+// NewProber creates a prober from the given options
+func NewProber(opts Options) *Prober {
+	return &Prober{
+		http: httpprobe.NewProber(httpprobe.Options{
+			ConnectTimeout: opts.ConnectTimeout,
+			ReadTimeout:    opts.ReadTimeout,
+			Dialer:         opts.Dialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+		}),
+	}
+}
+
+// Call posts a SOAP request with body as its content to the service at
+// address and returns the response envelope. No WS-Security header is sent
+// if username is empty. SOAP faults are returned as errors.
+func (p *Prober) Call(ctx context.Context, address, username, password, body string) ([]byte, error) {
+	envelope, err := buildEnvelope(username, password, body)
+	if err != nil {
+		return nil, err
+	}
+	result, err := p.http.Request(ctx, http.MethodPost, address, soapContentType, envelope, username, password)
+	if err != nil {
+		return nil, err
+	}
+	if result.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	}
+	if result.StatusCode != http.StatusOK {
+		if reason := faultReason(result.Body); reason != "" {
+			// Devices report bad WS-Security tokens as NotAuthorized faults
+			if strings.Contains(strings.ToLower(reason), "not authorized") || strings.Contains(reason, "NotAuthorized") {
+				return nil, ErrUnauthorized
+			}
+			return nil, fmt.Errorf("SOAP fault: %s", reason)
+		}
+		return nil, fmt.Errorf("unexpected status %d", result.StatusCode)
+	}
+	return result.Body, nil
+}
+
+// GetCapabilities asks the device service below baseURL (e.g.
+// http://host:80) for its service addresses. The addresses are rebased on
+// baseURL, since devices behind NAT report their internal address.
+func (p *Prober) GetCapabilities(ctx context.Context, baseURL, username, password string) (Capabilities, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	body := `<tds:GetCapabilities xmlns:tds="` + NamespaceDevice + `"><tds:Category>All</tds:Category></tds:GetCapabilities>`
+	resp, err := p.Call(ctx, baseURL+DevicePath, username, password, body)
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	var envelope struct {
+		Capabilities struct {
+			Media struct {
+				XAddr string `xml:"XAddr"`
+			} `xml:"Media"`
+			PTZ struct {
+				XAddr string `xml:"XAddr"`
+			} `xml:"PTZ"`
+		} `xml:"Body>GetCapabilitiesResponse>Capabilities"`
+	}
+	if err := xml.Unmarshal(resp, &envelope); err != nil {
+		return Capabilities{}, fmt.Errorf("invalid GetCapabilities response: %v", err)
+	}
+	return Capabilities{
+		Media: rebase(envelope.Capabilities.Media.XAddr, baseURL),
+		PTZ:   rebase(envelope.Capabilities.PTZ.XAddr, baseURL),
+	}, nil
+}
+
+// GetDeviceInformation asks the device service below baseURL (e.g.
+// http://host:80) for its manufacturer, model, firmware and serial number
+func (p *Prober) GetDeviceInformation(ctx context.Context, baseURL, username, password string) (DeviceInformation, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	body := `<tds:GetDeviceInformation xmlns:tds="` + NamespaceDevice + `"/>`
+	resp, err := p.Call(ctx, baseURL+DevicePath, username, password, body)
+	if err != nil {
+		return DeviceInformation{}, err
+	}
+
+	var envelope struct {
+		Info DeviceInformation `xml:"Body>GetDeviceInformationResponse"`
+	}
+	if err := xml.Unmarshal(resp, &envelope); err != nil {
+		return DeviceInformation{}, fmt.Errorf("invalid GetDeviceInformation response: %v", err)
+	}
+	info := envelope.Info
+	for _, field := range []*string{&info.Manufacturer, &info.Model, &info.FirmwareVersion, &info.SerialNumber, &info.HardwareID} {
+		*field = strings.TrimSpace(*field)
+	}
+	return info, nil
+}
+
+// GetProfiles lists the media profiles of the media service at address
+func (p *Prober) GetProfiles(ctx context.Context, address, username, password string) ([]Profile, error) {
+	body := `<trt:GetProfiles xmlns:trt="` + NamespaceMedia + `"/>`
+	resp, err := p.Call(ctx, address, username, password, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope struct {
+		Profiles []struct {
+			Token                    string    `xml:"token,attr"`
+			Name                     string    `xml:"Name"`
+			PTZConfiguration         *struct{} `xml:"PTZConfiguration"`
+			VideoSourceConfiguration struct {
+				SourceToken string `xml:"SourceToken"`
+			} `xml:"VideoSourceConfiguration"`
+			VideoEncoderConfiguration struct {
+				Encoding  string  `xml:"Encoding"`
+				Width     int     `xml:"Resolution>Width"`
+				Height    int     `xml:"Resolution>Height"`
+				FrameRate float64 `xml:"RateControl>FrameRateLimit"`
+			} `xml:"VideoEncoderConfiguration"`
+		} `xml:"Body>GetProfilesResponse>Profiles"`
+	}
+	if err := xml.Unmarshal(resp, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid GetProfiles response: %v", err)
+	}
+	profiles := make([]Profile, 0, len(envelope.Profiles))
+	for _, profile := range envelope.Profiles {
+		encoder := profile.VideoEncoderConfiguration
+		profiles = append(profiles, Profile{
+			Token:       profile.Token,
+			Name:        profile.Name,
+			PTZ:         profile.PTZConfiguration != nil,
+			VideoSource: strings.TrimSpace(profile.VideoSourceConfiguration.SourceToken),
+			Encoding:    strings.TrimSpace(encoder.Encoding),
+			Width:       encoder.Width,
+			Height:      encoder.Height,
+			FrameRate:   encoder.FrameRate,
+		})
+	}
+	return profiles, nil
+}
+
+// GetVideoSources lists the video inputs of the media service at address
+func (p *Prober) GetVideoSources(ctx context.Context, address, username, password string) ([]VideoSource, error) {
+	body := `<trt:GetVideoSources xmlns:trt="` + NamespaceMedia + `"/>`
+	resp, err := p.Call(ctx, address, username, password, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope struct {
+		VideoSources []struct {
+			Token     string  `xml:"token,attr"`
+			FrameRate float64 `xml:"Framerate"`
+			Width     int     `xml:"Resolution>Width"`
+			Height    int     `xml:"Resolution>Height"`
+		} `xml:"Body>GetVideoSourcesResponse>VideoSources"`
+	}
+	if err := xml.Unmarshal(resp, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid GetVideoSources response: %v", err)
+	}
+	sources := make([]VideoSource, 0, len(envelope.VideoSources))
+	for _, source := range envelope.VideoSources {
+		sources = append(sources, VideoSource{
+			Token:     source.Token,
+			Width:     source.Width,
+			Height:    source.Height,
+			FrameRate: source.FrameRate,
+		})
+	}
+	return sources, nil
+}
+
+// GetStreamUri asks the media service at address for the RTSP URI of a
+// profile. Unicast streams are requested over RTSP and multicast streams
+// over UDP, the combinations every ONVIF device supports.
+func (p *Prober) GetStreamUri(ctx context.Context, address, username, password, profileToken, streamType string) (string, error) {
+	transport := "RTSP"
+	if streamType == StreamMulticast {
+		transport = "UDP"
+	}
+	body := `<trt:GetStreamUri xmlns:trt="` + NamespaceMedia + `" xmlns:tt="` + NamespaceSchema + `">` +
+		`<trt:StreamSetup><tt:Stream>` + streamType + `</tt:Stream>` +
+		`<tt:Transport><tt:Protocol>` + transport + `</tt:Protocol></tt:Transport></trt:StreamSetup>` +
+		`<trt:ProfileToken>` + escape(profileToken) + `</trt:ProfileToken></trt:GetStreamUri>`
+	resp, err := p.Call(ctx, address, username, password, body)
+	if err != nil {
+		return "", err
+	}
+
+	var envelope struct {
+		URI string `xml:"Body>GetStreamUriResponse>MediaUri>Uri"`
+	}
+	if err := xml.Unmarshal(resp, &envelope); err != nil {
+		return "", fmt.Errorf("invalid GetStreamUri response: %v", err)
+	}
+	uri := strings.TrimSpace(envelope.URI)
+	if uri == "" {
+		return "", errors.New("empty stream URI")
+	}
+	return uri, nil
+}
+
+// Streams collects the unicast and multicast stream URIs of every media
+// profile of the device below baseURL, with the resolution and frame rate
+// of each. Stream types a profile does not offer are skipped; an error is
+// only returned if the profiles cannot be listed. The stream hosts are
+// replaced with that of baseURL, since devices behind NAT report their
+// internal address.
+func (p *Prober) Streams(ctx context.Context, baseURL, username, password string) ([]Stream, error) {
+	capabilities, err := p.GetCapabilities(ctx, baseURL, username, password)
+	if err != nil {
+		return nil, err
+	}
+	if capabilities.Media == "" {
+		return nil, errors.New("no media service")
+	}
+	profiles, err := p.GetProfiles(ctx, capabilities.Media, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Video sources only fill in what the encoder configurations lack
+	sources := make(map[string]VideoSource)
+	if list, err := p.GetVideoSources(ctx, capabilities.Media, username, password); err == nil {
+		for _, source := range list {
+			sources[source.Token] = source
+		}
+	}
+
+	var streams []Stream
+	for _, profile := range profiles {
+		for _, streamType := range []string{StreamUnicast, StreamMulticast} {
+			if ctx.Err() != nil {
+				return streams, nil
+			}
+			uri, err := p.GetStreamUri(ctx, capabilities.Media, username, password, profile.Token, streamType)
+			if err != nil {
+				continue
+			}
+			stream := Stream{
+				Profile:   profile,
+				Type:      streamType,
+				URI:       rebaseHost(uri, baseURL),
+				Width:     profile.Width,
+				Height:    profile.Height,
+				FrameRate: profile.FrameRate,
+			}
+			source := sources[profile.VideoSource]
+			if stream.Width == 0 || stream.Height == 0 {
+				stream.Width, stream.Height = source.Width, source.Height
+			}
+			if stream.FrameRate == 0 {
+				stream.FrameRate = source.FrameRate
+			}
+			streams = append(streams, stream)
+		}
+	}
+	return streams, nil
+}
+
+// buildEnvelope wraps body in a SOAP envelope, with a UsernameToken using
+// the password digest unless username is empty
+func buildEnvelope(username, password, body string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">`)
+	if username != "" {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		created := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+		hasher := sha1.New()
+		hasher.Write(nonce)
+		hasher.Write([]byte(created))
+		hasher.Write([]byte(password))
+		digest := base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+
+		b.WriteString(`<s:Header><wsse:Security s:mustUnderstand="1"` +
+			` xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"` +
+			` xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">`)
+		b.WriteString(`<wsse:UsernameToken><wsse:Username>`)
+		xml.EscapeText(&b, []byte(username))
+		b.WriteString(`</wsse:Username>`)
+		b.WriteString(`<wsse:Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">` + digest + `</wsse:Password>`)
+		b.WriteString(`<wsse:Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">` +
+			base64.StdEncoding.EncodeToString(nonce) + `</wsse:Nonce>`)
+		b.WriteString(`<wsu:Created>` + created + `</wsu:Created>`)
+		b.WriteString(`</wsse:UsernameToken></wsse:Security></s:Header>`)
+	}
+	b.WriteString(`<s:Body>` + body + `</s:Body></s:Envelope>`)
+	return b.Bytes(), nil
+}
+
+// faultReason extracts the reason of a SOAP 1.2 or 1.1 fault, or the
+// subcode when the reason is missing
+func faultReason(body []byte) string {
+	var envelope struct {
+		Fault struct {
+			Reason      string `xml:"Reason>Text"`
+			Subcode     string `xml:"Code>Subcode>Value"`
+			FaultString string `xml:"faultstring"`
+		} `xml:"Body>Fault"`
+	}
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return ""
+	}
+	fault := envelope.Fault
+	switch {
+	case fault.Reason != "":
+		return strings.TrimSpace(fault.Reason)
+	case fault.FaultString != "":
+		return strings.TrimSpace(fault.FaultString)
+	default:
+		return strings.TrimSpace(fault.Subcode)
+	}
+}
+
+// escape escapes text for use in an XML element
+func escape(text string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// rebaseHost replaces the host name of a stream URI with that of baseURL,
+// keeping its scheme and port
+func rebaseHost(uri, baseURL string) string {
+	stream, err := url.Parse(uri)
+	if err != nil || stream.Host == "" {
+		return uri
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return uri
+	}
+	if port := stream.Port(); port != "" {
+		stream.Host = net.JoinHostPort(base.Hostname(), port)
+	} else {
+		stream.Host = base.Hostname()
+		if strings.Contains(stream.Host, ":") {
+			stream.Host = "[" + stream.Host + "]"
+		}
+	}
+	return stream.String()
+}
+
+// rebase replaces the scheme and host of a service address with those of
+// baseURL, keeping its path
+func rebase(address, baseURL string) string {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return ""
+	}
+	service, err := url.Parse(address)
+	if err != nil {
+		return ""
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return address
+	}
+	service.Scheme = base.Scheme
+	service.Host = base.Host
+	return service.String()
+}
@@ -0,0 +1,372 @@
+// Package pelco finds Pelco-D and Pelco-P PTZ cameras behind serial device
+// servers. Legacy CCTV cameras hang on an RS-485 bus whose converter
+// exposes it as a TCP socket; every address of the bus is sent a harmless
+// stop command, and the addresses that answer with a valid frame are
+// reported. The cameras have no credentials, so finding the bus is the
+// whole result.
+package pelco
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+)
+
+// DefaultPort is the TCP port serial device servers expose their first
+// serial port on
+const DefaultPort = 4001
+
+// DefaultTimeout is the time allowed to connect and, after the last
+// command, for late replies
+const DefaultTimeout = 2 * time.Second
+
+// Default RS-485 address range probed. Pelco-D addresses run from 1 to
+// 255; small installations number their cameras from 1.
+const (
+	DefaultStartAddr = 1
+	DefaultEndAddr   = 32
+)
+
+// Protocols reported in Device
+const (
+	ProtocolD = "pelco-d"
+	ProtocolP = "pelco-p"
+)
+
+// frameGap is the pause after every command, long enough for a camera to
+// answer at 2400 baud before the next command is put on the bus
+const frameGap = 50 * time.Millisecond
+
+// Frame delimiters
+const (
+	syncD = 0xFF // Pelco-D synchronization byte
+	stxP  = 0xA0 // Pelco-P start and end of text
+	etxP  = 0xAF
+)
+
+// Frame lengths
+const (
+	frameLenD       = 7 // Pelco-D commands and extended responses
+	frameLenGeneral = 4 // Pelco-D general responses
+	frameLenP       = 8
+)
+
+// Options configures a Prober
+type Options struct {
+	Port      int                  // TCP port of the serial device server, DefaultPort if not set
+	StartAddr int                  // First RS-485 address probed
+	EndAddr   int                  // Last RS-485 address probed
+	Timeout   time.Duration        // DefaultTimeout if not set
+	Dialer    dialer.ContextDialer // Used for every connection, nil to dial directly
+}
+
+// Device is a camera that answered on the bus
+type Device struct {
+	Protocol string // ProtocolD or ProtocolP
+	Address  int    // RS-485 address, 1-based for both protocols
+}
+
+// Result lists the cameras found on one bus
+type Result struct {
+	Devices []Device // Sorted by protocol and address
+}
+
+// Found reports whether any camera answered
+func (r Result) Found() bool {
+	return len(r.Devices) > 0
+}
+
+// Addresses returns the addresses that answered in protocol, as ranges
+// such as "1-4,7", or "" if none did
+func (r Result) Addresses(protocol string) string {
+	var addrs []int
+	for _, device := range r.Devices {
+		if device.Protocol == protocol {
+			addrs = append(addrs, device.Address)
+		}
+	}
+	var ranges []string
+	for i := 0; i < len(addrs); {
+		j := i
+		for j+1 < len(addrs) && addrs[j+1] == addrs[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(addrs[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", addrs[i], addrs[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// ParseAddresses parses address ranges in the form Addresses returns them
+// and lists the addresses in order
+func ParseAddresses(s string) ([]int, error) {
+	var addrs []int
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Pelco address %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil {
+				return nil, fmt.Errorf("invalid Pelco address %q", part)
+			}
+		}
+		if err := ValidateRange(start, end); err != nil {
+			return nil, err
+		}
+		for addr := start; addr <= end; addr++ {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Ints(addrs)
+	return addrs, nil
+}
+
+// Protocols returns the protocols that answered, ProtocolD first
+func (r Result) Protocols() []string {
+	var protocols []string
+	for _, protocol := range []string{ProtocolD, ProtocolP} {
+		if r.Addresses(protocol) != "" {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols
+}
+
+// Prober probes serial device servers for Pelco buses
+type Prober struct {
+	port               int
+	startAddr, endAddr int
+	timeout            time.Duration
+	dialer             dialer.ContextDialer
+}
+
+// NewProber creates a prober from the given options
+func NewProber(opts Options) *Prober {
+	port := opts.Port
+	if port <= 0 {
+		port = DefaultPort
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	netDialer := opts.Dialer
+	if netDialer == nil {
+		netDialer = &net.Dialer{Timeout: timeout}
+	}
+	return &Prober{
+		port:      port,
+		startAddr: opts.StartAddr,
+		endAddr:   opts.EndAddr,
+		timeout:   timeout,
+		dialer:    netDialer,
+	}
+}
+
+// Port returns the TCP port the prober connects to
+func (p *Prober) Port() int {
+	return p.port
+}
+
+// ValidateRange checks an RS-485 address range
+func ValidateRange(start, end int) error {
+	if start < 1 || end > 255 || start > end {
+		return fmt.Errorf("invalid Pelco address range %d-%d, addresses run from 1 to 255", start, end)
+	}
+	return nil
+}
+
+// Probe sends the Pelco-D and then the Pelco-P stop command to every
+// address of the range on host's serial device server, one at a time,
+// and collects the replies. A stop command at most halts a camera that is
+// being steered, so probing does not turn any camera away.
+func (p *Prober) Probe(ctx context.Context, host string) (Result, error) {
+	conn, err := p.dialer.DialContext(ctx, "tcp", utils.FormatTarget(host, p.port))
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// Replies are read while the commands go out, since a camera answers
+	// as soon as it sees its address
+	var mu sync.Mutex
+	found := make(map[Device]bool)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readReplies(conn, func(device Device) {
+			mu.Lock()
+			found[device] = true
+			mu.Unlock()
+		})
+	}()
+
+	var writeErr error
+	for _, frame := range p.commands() {
+		if _, writeErr = conn.Write(frame); writeErr != nil {
+			break
+		}
+		select {
+		case <-time.After(frameGap):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if writeErr == nil && ctx.Err() == nil {
+		conn.SetReadDeadline(time.Now().Add(p.timeout))
+	} else {
+		conn.SetReadDeadline(time.Now())
+	}
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	var result Result
+	for device := range found {
+		if device.Address >= p.startAddr && device.Address <= p.endAddr {
+			result.Devices = append(result.Devices, device)
+		}
+	}
+	sort.Slice(result.Devices, func(i, j int) bool {
+		a, b := result.Devices[i], result.Devices[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.Address < b.Address
+	})
+	if !result.Found() && writeErr != nil {
+		return result, writeErr
+	}
+	return result, ctx.Err()
+}
+
+// commands returns the stop commands of the address range, Pelco-D first
+func (p *Prober) commands() [][]byte {
+	var frames [][]byte
+	for addr := p.startAddr; addr <= p.endAddr; addr++ {
+		frames = append(frames, frameD(addr))
+	}
+	for addr := p.startAddr; addr <= p.endAddr; addr++ {
+		frames = append(frames, frameP(addr))
+	}
+	return frames
+}
+
+// frameD builds a Pelco-D command 0x00 0x00 (stop) for addr. The checksum
+// is the sum of the address, command and data bytes modulo 256.
+func frameD(addr int) []byte {
+	frame := []byte{syncD, byte(addr), 0x00, 0x00, 0x00, 0x00, 0}
+	frame[6] = checksumD(frame)
+	return frame
+}
+
+// frameP builds a Pelco-P stop command for addr. Pelco-P addresses are
+// zero-based on the wire; the checksum is the XOR of all bytes before it.
+func frameP(addr int) []byte {
+	frame := []byte{stxP, byte(addr - 1), 0x00, 0x00, 0x00, 0x00, etxP, 0}
+	frame[7] = checksumP(frame)
+	return frame
+}
+
+func checksumD(frame []byte) byte {
+	var sum byte
+	for _, b := range frame[1:6] {
+		sum += b
+	}
+	return sum
+}
+
+func checksumP(frame []byte) byte {
+	var sum byte
+	for _, b := range frame[:7] {
+		sum ^= b
+	}
+	return sum
+}
+
+// readReplies reads reply frames until the connection fails or its
+// deadline passes, and calls onDevice for every valid one
+func readReplies(conn net.Conn, onDevice func(Device)) {
+	var buf []byte
+	chunk := make([]byte, 256)
+	for {
+		n, err := conn.Read(chunk)
+		buf = parseFrames(append(buf, chunk[:n]...), err != nil, onDevice)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// parseFrames reports the valid frames in buf and returns the bytes left
+// over for the next read. Pelco-D receivers answer with a 4-byte general
+// response (sync, address, alarms, checksum) or a 7-byte extended one;
+// short frames are only taken once final says no more bytes follow, or
+// when a full extended frame does not fit. Bytes that do not start a valid
+// frame are skipped, so line noise and the commands echoed by two-wire
+// converters do not count.
+func parseFrames(buf []byte, final bool, onDevice func(Device)) []byte {
+	for len(buf) > 0 {
+		switch buf[0] {
+		case syncD:
+			if len(buf) >= frameLenD && checksumD(buf[:frameLenD]) == buf[6] && buf[1] != 0 {
+				if !isCommand(buf[2:6]) {
+					onDevice(Device{Protocol: ProtocolD, Address: int(buf[1])})
+				}
+				buf = buf[frameLenD:]
+				continue
+			}
+			if len(buf) < frameLenD && !final {
+				return buf
+			}
+			if len(buf) >= frameLenGeneral && buf[1] != 0 && buf[1]+buf[2] == buf[3] {
+				onDevice(Device{Protocol: ProtocolD, Address: int(buf[1])})
+				buf = buf[frameLenGeneral:]
+				continue
+			}
+		case stxP:
+			if len(buf) < frameLenP && !final {
+				return buf
+			}
+			if len(buf) >= frameLenP && buf[6] == etxP && checksumP(buf[:frameLenP]) == buf[7] {
+				if !isCommand(buf[2:6]) {
+					onDevice(Device{Protocol: ProtocolP, Address: int(buf[1]) + 1})
+				}
+				buf = buf[frameLenP:]
+				continue
+			}
+		}
+		buf = buf[1:]
+	}
+	return buf
+}
+
+// isCommand reports whether the command and data bytes of a frame are
+// those of the stop command the prober sends, echoed back by the bus
+func isCommand(payload []byte) bool {
+	for _, b := range payload {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,331 @@
+// Package ptz detects pan-tilt-zoom control on cameras through ONVIF and
+// the Hikvision ISAPI. Detection only reads the configuration; an optional
+// test move confirms the camera can actually be steered.
+package ptz
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	httpprobe "github.com/ALW1EZ/camtruder/pkg/probe/http"
+	"github.com/ALW1EZ/camtruder/pkg/probe/onvif"
+)
+
+// Protocols reported in Result
+const (
+	ProtocolONVIF = "onvif"
+	ProtocolISAPI = "isapi"
+)
+
+// moveDuration is how long a test move lasts before the camera is stopped
+// and sent home
+const moveDuration = 500 * time.Millisecond
+
+// moveTimeout is the ONVIF timeout of a continuous test move, after which
+// the camera stops on its own should the Stop request be lost
+const moveTimeout = "PT1S"
+
+// cleanupTimeout bounds the stop and return home requests that follow an
+// accepted test move. They are sent even when the scan is canceled.
+const cleanupTimeout = 5 * time.Second
+
+// isapiChannelsPath lists the PTZ channels of a Hikvision device
+const isapiChannelsPath = "/ISAPI/PTZCtrl/channels"
+
+// Result represents the outcome of a PTZ check
+type Result struct {
+	Supported bool
+	Protocol  string // ProtocolONVIF or ProtocolISAPI
+	Presets   int    // Presets configured on the first PTZ profile or channel
+	Moved     bool   // A test move was accepted and the camera sent to its home position
+	MoveError string // Why the test move failed, empty if none was attempted or it worked
+}
+
+// Options configures a Prober
+type Options struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Dialer         dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLSConfig      *tls.Config          // Used for https:// URLs, nil for the defaults
+	Headers        map[string]string    // Extra headers sent with every request
+	Move           bool                 // Confirm control with a small move and a return home
+}
+
+// Prober checks camera web interfaces for PTZ control
+type Prober struct {
+	http  *httpprobe.Prober
+	onvif *onvif.Prober
+	move  bool
+}
+
+// NewProber creates a prober from the given options
+func NewProber(opts Options) *Prober {
+	return &Prober{
+		http: httpprobe.NewProber(httpprobe.Options{
+			ConnectTimeout: opts.ConnectTimeout,
+			ReadTimeout:    opts.ReadTimeout,
+			Dialer:         opts.Dialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+		}),
+		onvif: onvif.NewProber(onvif.Options{
+			ConnectTimeout: opts.ConnectTimeout,
+			ReadTimeout:    opts.ReadTimeout,
+			Dialer:         opts.Dialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+		}),
+		move: opts.Move,
+	}
+}
+
+// Check looks for PTZ control on the web interface at baseURL (e.g.
+// http://host:80) with the given credentials, first through ONVIF and then
+// through the Hikvision ISAPI. It returns the error of the last protocol
+// tried if neither answered.
+func (p *Prober) Check(ctx context.Context, baseURL, username, password string) (Result, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	result, onvifErr := p.checkONVIF(ctx, baseURL, username, password)
+	if result.Supported {
+		return result, nil
+	}
+	result, isapiErr := p.checkISAPI(ctx, baseURL, username, password)
+	if result.Supported || (onvifErr == nil && isapiErr == nil) {
+		return result, nil
+	}
+	if isapiErr != nil {
+		return Result{}, isapiErr
+	}
+	return Result{}, onvifErr
+}
+
+// checkONVIF finds the first profile with a PTZ configuration
+func (p *Prober) checkONVIF(ctx context.Context, baseURL, username, password string) (Result, error) {
+	capabilities, err := p.onvif.GetCapabilities(ctx, baseURL, username, password)
+	if err != nil {
+		return Result{}, fmt.Errorf("ONVIF: %v", err)
+	}
+	if capabilities.PTZ == "" || capabilities.Media == "" {
+		return Result{}, nil
+	}
+	profiles, err := p.onvif.GetProfiles(ctx, capabilities.Media, username, password)
+	if err != nil {
+		return Result{}, fmt.Errorf("ONVIF: %v", err)
+	}
+
+	for _, profile := range profiles {
+		if !profile.PTZ {
+			continue
+		}
+		result := Result{Supported: true, Protocol: ProtocolONVIF}
+		if presets, err := p.onvifPresets(ctx, capabilities.PTZ, profile.Token, username, password); err == nil {
+			result.Presets = presets
+		}
+		if p.move {
+			if err := p.onvifMove(ctx, capabilities.PTZ, profile.Token, username, password); err != nil {
+				result.MoveError = err.Error()
+			} else {
+				result.Moved = true
+			}
+		}
+		return result, nil
+	}
+	return Result{}, nil
+}
+
+// onvifPresets counts the presets of a profile
+func (p *Prober) onvifPresets(ctx context.Context, address, token, username, password string) (int, error) {
+	body := `<tptz:GetPresets xmlns:tptz="` + onvif.NamespacePTZ + `"><tptz:ProfileToken>` + escape(token) + `</tptz:ProfileToken></tptz:GetPresets>`
+	resp, err := p.onvif.Call(ctx, address, username, password, body)
+	if err != nil {
+		return 0, err
+	}
+	var envelope struct {
+		Presets []struct{} `xml:"Body>GetPresetsResponse>Preset"`
+	}
+	if err := xml.Unmarshal(resp, &envelope); err != nil {
+		return 0, err
+	}
+	return len(envelope.Presets), nil
+}
+
+// onvifMove pans the camera slightly and sends it to its home position.
+// Cameras without relative moves are moved with a short continuous move.
+// Once a move is accepted the camera is stopped and sent home, even if ctx
+// ends while it moves.
+func (p *Prober) onvifMove(ctx context.Context, address, token, username, password string) error {
+	profile := `<tptz:ProfileToken>` + escape(token) + `</tptz:ProfileToken>`
+	ns := ` xmlns:tptz="` + onvif.NamespacePTZ + `" xmlns:tt="` + onvif.NamespaceSchema + `"`
+
+	continuous := false
+	relative := `<tptz:RelativeMove` + ns + `>` + profile +
+		`<tptz:Translation><tt:PanTilt x="0.05" y="0"/></tptz:Translation></tptz:RelativeMove>`
+	if _, err := p.onvif.Call(ctx, address, username, password, relative); err != nil {
+		if errors.Is(err, onvif.ErrUnauthorized) {
+			return err
+		}
+		move := `<tptz:ContinuousMove` + ns + `>` + profile +
+			`<tptz:Velocity><tt:PanTilt x="0.1" y="0"/></tptz:Velocity>` +
+			`<tptz:Timeout>` + moveTimeout + `</tptz:Timeout></tptz:ContinuousMove>`
+		if _, err := p.onvif.Call(ctx, address, username, password, move); err != nil {
+			return fmt.Errorf("move rejected: %v", err)
+		}
+		continuous = true
+	}
+	sleep(ctx, moveDuration)
+
+	cleanupCtx, cancel := cleanupContext(ctx)
+	defer cancel()
+	// Sending the camera home also ends the move, so a rejected stop is
+	// only reported once that has been tried
+	var stopErr error
+	if continuous {
+		stop := `<tptz:Stop` + ns + `>` + profile + `<tptz:PanTilt>true</tptz:PanTilt><tptz:Zoom>true</tptz:Zoom></tptz:Stop>`
+		_, stopErr = p.onvif.Call(cleanupCtx, address, username, password, stop)
+	}
+	home := `<tptz:GotoHomePosition` + ns + `>` + profile + `</tptz:GotoHomePosition>`
+	_, homeErr := p.onvif.Call(cleanupCtx, address, username, password, home)
+	if stopErr != nil {
+		return fmt.Errorf("stop rejected: %v", stopErr)
+	}
+	if homeErr != nil {
+		return fmt.Errorf("moved, but return to home position failed: %v", homeErr)
+	}
+	return nil
+}
+
+// checkISAPI finds the first PTZ channel of a Hikvision device
+func (p *Prober) checkISAPI(ctx context.Context, baseURL, username, password string) (Result, error) {
+	resp, err := p.http.TestCredentials(ctx, baseURL+isapiChannelsPath, username, password)
+	if err != nil {
+		return Result{}, fmt.Errorf("ISAPI: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, nil
+	}
+	var channels struct {
+		Channels []struct {
+			ID      string `xml:"id"`
+			Enabled string `xml:"enabled"`
+		} `xml:"PTZChannel"`
+	}
+	if err := xml.Unmarshal(resp.Body, &channels); err != nil {
+		return Result{}, nil
+	}
+
+	for _, channel := range channels.Channels {
+		if channel.ID == "" || channel.Enabled == "false" {
+			continue
+		}
+		channelURL := baseURL + isapiChannelsPath + "/" + channel.ID
+		result := Result{Supported: true, Protocol: ProtocolISAPI}
+		if presets, err := p.isapiPresets(ctx, channelURL, username, password); err == nil {
+			result.Presets = presets
+		}
+		if p.move {
+			if err := p.isapiMove(ctx, channelURL, username, password); err != nil {
+				result.MoveError = err.Error()
+			} else {
+				result.Moved = true
+			}
+		}
+		return result, nil
+	}
+	return Result{}, nil
+}
+
+// isapiPresets counts the enabled presets of a channel
+func (p *Prober) isapiPresets(ctx context.Context, channelURL, username, password string) (int, error) {
+	resp, err := p.http.TestCredentials(ctx, channelURL+"/presets", username, password)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var list struct {
+		Presets []struct {
+			Enabled string `xml:"enabled"`
+		} `xml:"PTZPreset"`
+	}
+	if err := xml.Unmarshal(resp.Body, &list); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, preset := range list.Presets {
+		if preset.Enabled != "false" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// isapiMove pans the camera for a moment and sends it to its home position
+func (p *Prober) isapiMove(ctx context.Context, channelURL, username, password string) error {
+	move := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><PTZData><pan>10</pan><tilt>0</tilt><zoom>0</zoom><Momentary><duration>%d</duration></Momentary></PTZData>`,
+		moveDuration.Milliseconds())
+	if err := p.isapiPut(ctx, channelURL+"/momentary", move, username, password); err != nil {
+		return fmt.Errorf("move rejected: %v", err)
+	}
+	sleep(ctx, moveDuration)
+
+	// The momentary move ends by itself, the camera is sent home even if
+	// ctx ended meanwhile
+	cleanupCtx, cancel := cleanupContext(ctx)
+	defer cancel()
+	if err := p.isapiPut(cleanupCtx, channelURL+"/homeposition/goto", "", username, password); err != nil {
+		return fmt.Errorf("moved, but return to home position failed: %v", err)
+	}
+	return nil
+}
+
+// isapiPut sends an ISAPI command and checks its ResponseStatus
+func (p *Prober) isapiPut(ctx context.Context, rawURL, body, username, password string) error {
+	resp, err := p.http.Request(ctx, http.MethodPut, rawURL, "application/xml", []byte(body), username, password)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var status struct {
+			Status string `xml:"statusString"`
+		}
+		if xml.Unmarshal(resp.Body, &status) == nil && status.Status != "" {
+			return fmt.Errorf("status %d: %s", resp.StatusCode, status.Status)
+		}
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// escape returns s with XML special characters escaped
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// cleanupContext returns a context for the requests that end a test move,
+// which outlives ctx by at most cleanupTimeout
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,332 @@
+// Package snmp identifies cameras through their SNMP agent. It tries v3
+// with the given user and v2c and v1 with a list of community strings,
+// and reads the system description and the ENTITY-MIB model, firmware and
+// serial number.
+package snmp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// DefaultPort is the standard SNMP agent port
+const DefaultPort = 161
+
+// DefaultCommunities are the community strings tried on every agent
+var DefaultCommunities = []string{"public", "private", "admin"}
+
+// maxInFlight bounds the attempts, and so the sockets, one probe has open.
+// It covers v3 with both hashes and v2c and v1 with the default
+// communities, so only extra communities cost another timeout.
+const maxInFlight = 8
+
+// System group OIDs, present on every agent
+const (
+	oidSysDescr    = "1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = "1.3.6.1.2.1.1.2.0"
+	oidSysName     = "1.3.6.1.2.1.1.5.0"
+)
+
+// ENTITY-MIB entPhysicalTable columns of the first entity, usually the
+// chassis of a camera
+const (
+	oidEntFirmwareRev = "1.3.6.1.2.1.47.1.1.1.1.9.1"
+	oidEntSoftwareRev = "1.3.6.1.2.1.47.1.1.1.1.10.1"
+	oidEntSerialNum   = "1.3.6.1.2.1.47.1.1.1.1.11.1"
+	oidEntModelName   = "1.3.6.1.2.1.47.1.1.1.1.13.1"
+)
+
+// enterprisePrefix is the start of a sysObjectID below the private
+// enterprise numbers
+const enterprisePrefix = "1.3.6.1.4.1."
+
+// enterprises maps private enterprise numbers to camera vendors
+var enterprises = map[string]string{
+	"122":     "Sony",
+	"368":     "Axis",
+	"3967":    "Bosch",
+	"36849":   "Hanwha",
+	"39165":   "Hikvision",
+	"1004849": "Dahua",
+}
+
+// axisDescr extracts the model and firmware from an Axis sysDescr such as
+// "AXIS M1065-L Network Camera 9.80.1"
+var axisDescr = regexp.MustCompile(`(?i)^AXIS\s+(\S+)\s+.*?(\d+(?:\.\d+)+)?\s*$`)
+
+// descrVendors are vendor names looked for in a sysDescr when the
+// sysObjectID is not a known enterprise
+var descrVendors = []string{"Axis", "Hikvision", "Dahua", "Bosch", "Sony", "Hanwha", "Samsung", "Panasonic", "Vivotek"}
+
+// Info is what an agent revealed about a device
+type Info struct {
+	Version     string // v1, v2c or v3
+	Community   string // Community string accepted, or the v3 user name
+	SysDescr    string
+	SysObjectID string
+	SysName     string
+	Vendor      string // Empty if the agent does not identify a camera vendor
+	Model       string
+	Firmware    string
+	Serial      string
+}
+
+// Options configures a Prober
+type Options struct {
+	Port        int
+	Timeout     time.Duration
+	Communities []string // Community strings tried with v2c and v1, DefaultCommunities if nil
+	V3User      string   // v3 user name, empty to skip v3
+	V3AuthKey   string   // v3 authentication passphrase, tried with SHA and MD5
+	LocalIP     net.IP   // Source address of the requests, nil for the default route
+}
+
+// Prober queries SNMP agents
+type Prober struct {
+	opts Options
+}
+
+// NewProber creates a prober from the given options
+func NewProber(opts Options) *Prober {
+	if opts.Port <= 0 {
+		opts.Port = DefaultPort
+	}
+	if opts.Communities == nil {
+		opts.Communities = DefaultCommunities
+	}
+	return &Prober{opts: opts}
+}
+
+// LoadCommunities returns DefaultCommunities followed by the community
+// strings in path, one per line, without duplicates. Empty lines and
+// lines starting with # are ignored.
+func LoadCommunities(path string) ([]string, error) {
+	communities := append([]string(nil), DefaultCommunities...)
+	if path == "" {
+		return communities, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open communities file: %v", err)
+	}
+	defer file.Close()
+
+	seen := make(map[string]bool)
+	for _, community := range communities {
+		seen[community] = true
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+		seen[line] = true
+		communities = append(communities, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read communities file: %v", err)
+	}
+	return communities, nil
+}
+
+// attempt is one way of talking to an agent
+type attempt struct {
+	version   gosnmp.SnmpVersion
+	community string
+	auth      gosnmp.SnmpV3AuthProtocol
+}
+
+// name describes the version of an attempt
+func (a attempt) name() string {
+	switch a.version {
+	case gosnmp.Version1:
+		return "v1"
+	case gosnmp.Version3:
+		return "v3"
+	default:
+		return "v2c"
+	}
+}
+
+// Probe queries the agent on host. Agents silently drop requests with a
+// wrong community string, so up to maxInFlight attempts are sent at once
+// and the default list takes one timeout; v3 is preferred over v2c, which
+// is preferred over v1, and communities keep their order. It returns
+// false if no attempt was answered.
+func (p *Prober) Probe(ctx context.Context, host string) (Info, bool) {
+	var attempts []attempt
+	if p.opts.V3User != "" {
+		attempts = append(attempts, attempt{version: gosnmp.Version3, community: p.opts.V3User, auth: gosnmp.SHA})
+		if p.opts.V3AuthKey != "" {
+			attempts = append(attempts, attempt{version: gosnmp.Version3, community: p.opts.V3User, auth: gosnmp.MD5})
+		}
+	}
+	for _, version := range []gosnmp.SnmpVersion{gosnmp.Version2c, gosnmp.Version1} {
+		for _, community := range p.opts.Communities {
+			attempts = append(attempts, attempt{version: version, community: community})
+		}
+	}
+
+	type answer struct {
+		info Info
+		ok   bool
+	}
+	answers := make([]answer, len(attempts))
+	sem := make(chan struct{}, maxInFlight)
+	var wg sync.WaitGroup
+	for i, a := range attempts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, a attempt) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			info, err := p.query(ctx, host, a)
+			answers[i] = answer{info: info, ok: err == nil}
+		}(i, a)
+	}
+	wg.Wait()
+
+	for _, answer := range answers {
+		if answer.ok {
+			return answer.info, true
+		}
+	}
+	return Info{}, false
+}
+
+// query reads the system group and, if available, the entity details
+func (p *Prober) query(ctx context.Context, host string, a attempt) (Info, error) {
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      uint16(p.opts.Port),
+		Version:   a.version,
+		Community: a.community,
+		Context:   ctx,
+		Timeout:   p.opts.Timeout,
+		Retries:   0,
+	}
+	if p.opts.LocalIP != nil {
+		client.LocalAddr = net.JoinHostPort(p.opts.LocalIP.String(), "0")
+	}
+	if a.version == gosnmp.Version3 {
+		client.Community = ""
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.MsgFlags = gosnmp.AuthNoPriv
+		client.SecurityParameters = &gosnmp.UsmSecurityParameters{
+			UserName:                 a.community,
+			AuthenticationProtocol:   a.auth,
+			AuthenticationPassphrase: p.opts.V3AuthKey,
+		}
+		if p.opts.V3AuthKey == "" {
+			client.MsgFlags = gosnmp.NoAuthNoPriv
+			client.SecurityParameters = &gosnmp.UsmSecurityParameters{
+				UserName:               a.community,
+				AuthenticationProtocol: gosnmp.NoAuth,
+			}
+		}
+	}
+	if err := client.Connect(); err != nil {
+		return Info{}, err
+	}
+	defer client.Conn.Close()
+
+	system, err := get(client, oidSysDescr, oidSysObjectID, oidSysName)
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{
+		Version:     a.name(),
+		Community:   a.community,
+		SysDescr:    system[oidSysDescr],
+		SysObjectID: strings.TrimPrefix(system[oidSysObjectID], "."),
+		SysName:     system[oidSysName],
+	}
+
+	// v1 agents fail the whole request if one OID is missing, so the
+	// optional entity columns are asked for separately
+	if entity, err := get(client, oidEntModelName, oidEntFirmwareRev, oidEntSoftwareRev, oidEntSerialNum); err == nil {
+		info.Model = entity[oidEntModelName]
+		info.Firmware = entity[oidEntSoftwareRev]
+		if info.Firmware == "" {
+			info.Firmware = entity[oidEntFirmwareRev]
+		}
+		info.Serial = entity[oidEntSerialNum]
+	}
+	identify(&info)
+	return info, nil
+}
+
+// identify derives the vendor, and the model and firmware if the entity
+// table did not have them, from the system group
+func identify(info *Info) {
+	if rest, ok := strings.CutPrefix(info.SysObjectID, enterprisePrefix); ok {
+		number, _, _ := strings.Cut(rest, ".")
+		info.Vendor = enterprises[number]
+	}
+
+	descr := strings.TrimSpace(info.SysDescr)
+	if m := axisDescr.FindStringSubmatch(descr); m != nil {
+		info.Vendor = "Axis"
+		if info.Model == "" {
+			info.Model = m[1]
+		}
+		if info.Firmware == "" {
+			info.Firmware = m[2]
+		}
+		return
+	}
+	if info.Vendor == "" {
+		lower := strings.ToLower(descr)
+		for _, vendor := range descrVendors {
+			if strings.Contains(lower, strings.ToLower(vendor)) {
+				info.Vendor = vendor
+				return
+			}
+		}
+	}
+}
+
+// get requests oids and returns the values that exist as strings
+func get(client *gosnmp.GoSNMP, oids ...string) (map[string]string, error) {
+	packet, err := client.Get(oids)
+	if err != nil {
+		return nil, err
+	}
+	if packet.Error != gosnmp.NoError {
+		return nil, errors.New("agent returned error " + strconv.Itoa(int(packet.Error)))
+	}
+
+	values := make(map[string]string, len(packet.Variables))
+	for _, v := range packet.Variables {
+		name := strings.TrimPrefix(v.Name, ".")
+		switch v.Type {
+		case gosnmp.OctetString:
+			if b, ok := v.Value.([]byte); ok {
+				values[name] = strings.TrimSpace(string(b))
+			}
+		case gosnmp.ObjectIdentifier:
+			if s, ok := v.Value.(string); ok {
+				values[name] = s
+			}
+		}
+	}
+	return values, nil
+}
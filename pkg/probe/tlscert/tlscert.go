@@ -0,0 +1,151 @@
+// Package tlscert reads the certificates cameras present on their HTTPS
+// and RTSPS ports. Only a TLS handshake is made, so certificates are read
+// whether or not any credentials are known.
+package tlscert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+)
+
+// FindingExpired is the finding reported for an expired certificate
+const FindingExpired = "EXPIRED-TLS-CERTIFICATE"
+
+// macPattern finds a MAC address in a certificate name, with or without
+// separators, as vendors put it in the CN of their factory certificates
+var macPattern = regexp.MustCompile(`(?i)\b(?:[0-9a-f]{2}[:-]){5}[0-9a-f]{2}\b|\b[0-9a-f]{12}\b`)
+
+// Certificate describes the leaf certificate of a TLS service
+type Certificate struct {
+	Subject    string
+	Issuer     string
+	SANs       []string // DNS names, IP addresses, e-mail addresses and URIs
+	Serial     string   // Hexadecimal serial number
+	NotBefore  time.Time
+	NotAfter   time.Time
+	SelfSigned bool
+	MAC        string // MAC address found in the subject, empty if none
+}
+
+// Expired reports whether the certificate is no longer valid at now
+func (c Certificate) Expired(now time.Time) bool {
+	return now.After(c.NotAfter)
+}
+
+// Options configures a Prober
+type Options struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Dialer         dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLSConfig      *tls.Config          // Client certificates to offer, nil for none
+}
+
+// Prober reads certificates from TLS services
+type Prober struct {
+	dialer         dialer.ContextDialer
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	tlsConfig      *tls.Config
+}
+
+// NewProber creates a prober from the given options
+func NewProber(opts Options) *Prober {
+	var netDialer dialer.ContextDialer = &net.Dialer{Timeout: opts.ConnectTimeout}
+	if opts.Dialer != nil {
+		netDialer = opts.Dialer
+	}
+	// Certificates are read, not trusted, so they are never verified
+	config := &tls.Config{}
+	if opts.TLSConfig != nil {
+		config = opts.TLSConfig.Clone()
+	}
+	config.InsecureSkipVerify = true
+	return &Prober{
+		dialer:         netDialer,
+		connectTimeout: opts.ConnectTimeout,
+		readTimeout:    opts.ReadTimeout,
+		tlsConfig:      config,
+	}
+}
+
+// Inspect makes a TLS handshake with the ip:port target and returns its
+// leaf certificate
+func (p *Prober) Inspect(ctx context.Context, target string) (Certificate, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, p.connectTimeout)
+	conn, err := p.dialer.DialContext(dialCtx, "tcp", target)
+	cancel()
+	if err != nil {
+		return Certificate{}, err
+	}
+	defer conn.Close()
+
+	client := tls.Client(conn, p.tlsConfig)
+	handshakeCtx, cancel := context.WithTimeout(ctx, p.readTimeout)
+	defer cancel()
+	if err := client.HandshakeContext(handshakeCtx); err != nil {
+		return Certificate{}, fmt.Errorf("TLS handshake failed: %v", err)
+	}
+
+	chain := client.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return Certificate{}, errors.New("no certificate presented")
+	}
+	return describe(chain[0]), nil
+}
+
+// describe extracts the fields of a certificate
+func describe(cert *x509.Certificate) Certificate {
+	result := Certificate{
+		Subject:    cert.Subject.String(),
+		Issuer:     cert.Issuer.String(),
+		Serial:     fmt.Sprintf("%x", cert.SerialNumber),
+		NotBefore:  cert.NotBefore,
+		NotAfter:   cert.NotAfter,
+		SelfSigned: selfSigned(cert),
+		MAC:        findMAC(cert.Subject.CommonName),
+	}
+	result.SANs = append(result.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		result.SANs = append(result.SANs, ip.String())
+	}
+	result.SANs = append(result.SANs, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		result.SANs = append(result.SANs, uri.String())
+	}
+	return result
+}
+
+// selfSigned reports whether cert is signed with its own key. Camera
+// certificates rarely carry the CA flag, so the signature is checked
+// directly instead of with CheckSignatureFrom.
+func selfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// findMAC returns the MAC address in name as colon separated lower case
+// octets, or an empty string
+func findMAC(name string) string {
+	match := macPattern.FindString(name)
+	if match == "" {
+		return ""
+	}
+	digits := strings.NewReplacer(":", "", "-", "").Replace(strings.ToLower(match))
+	octets := make([]string, 0, 6)
+	for i := 0; i+2 <= len(digits); i += 2 {
+		octets = append(octets, digits[i:i+2])
+	}
+	return strings.Join(octets, ":")
+}
@@ -0,0 +1,313 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/projectdiscovery/gologger/levels"
+	"github.com/projectdiscovery/gologger/writer"
+)
+
+// Default time between progress updates
+const DefaultInterval = time.Second
+
+// Width of the bar drawn on terminals
+const barWidth = 30
+
+// Stats is a point-in-time view of a scan's progress
+type Stats struct {
+	Total     int64 // Checks queued so far, 0 if unknown
+	Completed int64 // Checks finished, including those skipped on resume
+	Hits      int64 // Cameras found
+	Errors    int64 // Probes that failed to connect or timed out
+	Elapsed   time.Duration
+	Rate      float64       // Checks finished per second in this run
+	ETA       time.Duration // Estimated time to completion, 0 if unknown
+}
+
+// Tracker counts the checks of a scan and renders a progress line. On a
+// terminal the line is redrawn in place; otherwise a plain line is written
+// at every interval. A nil Tracker is valid and does nothing.
+type Tracker struct {
+	total     int64
+	completed int64
+	skipped   int64 // Completed in an earlier run, left out of the rate
+	hits      int64
+	errors    int64
+
+	out      io.Writer
+	tty      bool
+	interval time.Duration
+	start    time.Time
+
+	mu      sync.Mutex // Serializes the progress line with other console output
+	running bool       // Between Start and Stop
+	drawn   bool       // The progress line is on screen and must be cleared
+	stop    chan struct{}
+	done    chan struct{}
+	updates chan Stats // Receives the stats instead of the line, see Watch
+}
+
+// New creates a tracker rendering to out every interval
+func New(out io.Writer, interval time.Duration) *Tracker {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Tracker{
+		out:      out,
+		tty:      isTerminal(out),
+		interval: interval,
+	}
+}
+
+// isTerminal reports whether w is a character device
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Watch returns a channel that receives the stats every interval in place
+// of the progress line, for dashboards that draw the progress themselves.
+// Updates are dropped while the receiver is busy. The channel is closed by
+// Stop. It must be called before Start.
+func (t *Tracker) Watch() <-chan Stats {
+	t.updates = make(chan Stats, 1)
+	return t.updates
+}
+
+// Start begins rendering in the background
+func (t *Tracker) Start() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.start = time.Now()
+	t.running = true
+	t.mu.Unlock()
+
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.render()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops rendering and leaves the final progress line on screen
+func (t *Tracker) Stop() {
+	if t == nil || t.stop == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = false
+	if t.updates != nil {
+		t.send()
+		close(t.updates)
+		return
+	}
+	t.clearLocked()
+	fmt.Fprintln(t.out, t.line(t.Stats()))
+}
+
+// AddTotal adds n queued checks
+func (t *Tracker) AddTotal(n int64) {
+	if t != nil {
+		atomic.AddInt64(&t.total, n)
+	}
+}
+
+// Skip marks n checks as completed by an earlier run
+func (t *Tracker) Skip(n int64) {
+	if t != nil {
+		atomic.AddInt64(&t.completed, n)
+		atomic.AddInt64(&t.skipped, n)
+	}
+}
+
+// Done marks one check as completed
+func (t *Tracker) Done() {
+	if t != nil {
+		atomic.AddInt64(&t.completed, 1)
+	}
+}
+
+// Hit counts a camera found
+func (t *Tracker) Hit() {
+	if t != nil {
+		atomic.AddInt64(&t.hits, 1)
+	}
+}
+
+// Error counts a probe that failed to connect or timed out
+func (t *Tracker) Error() {
+	if t != nil {
+		atomic.AddInt64(&t.errors, 1)
+	}
+}
+
+// Stats returns the current counters with throughput and ETA
+func (t *Tracker) Stats() Stats {
+	stats := Stats{
+		Total:     atomic.LoadInt64(&t.total),
+		Completed: atomic.LoadInt64(&t.completed),
+		Hits:      atomic.LoadInt64(&t.hits),
+		Errors:    atomic.LoadInt64(&t.errors),
+		Elapsed:   time.Since(t.start),
+	}
+	if seconds := stats.Elapsed.Seconds(); seconds > 0 {
+		stats.Rate = float64(stats.Completed-atomic.LoadInt64(&t.skipped)) / seconds
+	}
+	if remaining := stats.Total - stats.Completed; remaining > 0 && stats.Rate > 0 {
+		stats.ETA = time.Duration(float64(remaining) / stats.Rate * float64(time.Second))
+	}
+	return stats
+}
+
+// render writes the current progress line
+func (t *Tracker) render() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.updates != nil {
+		t.send()
+		return
+	}
+	if t.tty {
+		t.drawLocked()
+		return
+	}
+	fmt.Fprintln(t.out, t.line(t.Stats()))
+}
+
+// send hands the current stats to the watcher, replacing an update it has
+// not received yet
+func (t *Tracker) send() {
+	stats := t.Stats()
+	select {
+	case <-t.updates:
+	default:
+	}
+	select {
+	case t.updates <- stats:
+	default:
+	}
+}
+
+// drawLocked redraws the progress line in place on a terminal
+func (t *Tracker) drawLocked() {
+	if !t.tty || !t.running {
+		return
+	}
+	fmt.Fprintf(t.out, "\r\033[K%s", t.line(t.Stats()))
+	t.drawn = true
+}
+
+// clearLocked erases the progress line so other output starts on a clean line
+func (t *Tracker) clearLocked() {
+	if t.drawn {
+		fmt.Fprint(t.out, "\r\033[K")
+		t.drawn = false
+	}
+}
+
+// line formats the progress line, with a bar on terminals
+func (t *Tracker) line(stats Stats) string {
+	var b strings.Builder
+	if !t.tty {
+		b.WriteString("[PROGRESS] ")
+	}
+	if stats.Total > 0 {
+		fraction := float64(stats.Completed) / float64(stats.Total)
+		if fraction > 1 {
+			fraction = 1
+		}
+		if t.tty {
+			filled := int(fraction * barWidth)
+			b.WriteString("[" + strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled) + "] ")
+		}
+		fmt.Fprintf(&b, "%.1f%% %d/%d checks", fraction*100, stats.Completed, stats.Total)
+	} else {
+		fmt.Fprintf(&b, "%d checks", stats.Completed)
+	}
+	fmt.Fprintf(&b, " | %.1f/s | hits %d | errors %d | elapsed %s",
+		stats.Rate, stats.Hits, stats.Errors, stats.Elapsed.Round(time.Second))
+	if stats.ETA > 0 {
+		fmt.Fprintf(&b, " | ETA %s", stats.ETA.Round(time.Second))
+	}
+	return b.String()
+}
+
+// Logs wraps a gologger writer so log lines are not drawn over the
+// progress line
+func (t *Tracker) Logs(next writer.Writer) writer.Writer {
+	if t == nil {
+		return next
+	}
+	return &logWriter{t: t, next: next}
+}
+
+type logWriter struct {
+	t    *Tracker
+	next writer.Writer
+}
+
+func (w *logWriter) Write(data []byte, level levels.Level) {
+	w.t.mu.Lock()
+	defer w.t.mu.Unlock()
+	w.t.clearLocked()
+	w.next.Write(data, level)
+	w.t.drawLocked()
+}
+
+// Results wraps a result writer so results are counted as hits and not
+// drawn over the progress line
+func (t *Tracker) Results(next output.ResultWriter) output.ResultWriter {
+	if t == nil {
+		return next
+	}
+	return &resultWriter{t: t, next: next}
+}
+
+type resultWriter struct {
+	t    *Tracker
+	next output.ResultWriter
+}
+
+func (w *resultWriter) Write(r output.Result) error {
+	// Vulnerability findings describe a device, not a working login
+	if r.Vulnerability == "" {
+		w.t.Hit()
+	}
+	w.t.mu.Lock()
+	defer w.t.mu.Unlock()
+	w.t.clearLocked()
+	err := w.next.Write(r)
+	w.t.drawLocked()
+	return err
+}
+
+func (w *resultWriter) Close() error {
+	return w.next.Close()
+}
@@ -1,11 +1,16 @@
 package rtsp
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"log/slog"
+	"net"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
 	"github.com/bluenviron/gortsplib/v4"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
@@ -20,11 +25,92 @@ type TestResult struct {
 	Error    error
 }
 
-// TestCredentials tests RTSP credentials against a URL
-func TestCredentials(rtspURL string, timeout time.Duration, verbose bool) (bool, string) {
-	client := &gortsplib.Client{
-		ReadTimeout:  timeout,
-		WriteTimeout: timeout,
+// Timeouts holds the per-stage timeouts of a probe
+type Timeouts struct {
+	Connect time.Duration // TCP connection establishment
+	Read    time.Duration // Each request/response exchange
+}
+
+// RTP transports selectable with Config.Transport
+const (
+	TransportTCP  = "tcp"  // RTP interleaved in the RTSP connection
+	TransportUDP  = "udp"  // RTP over separate UDP ports
+	TransportAuto = "auto" // UDP first, TCP if no media arrives
+)
+
+// Config configures RTSP probes
+type Config struct {
+	Timeouts  Timeouts
+	Dialer    dialer.ContextDialer // Used for every connection, nil to dial directly
+	Verbose   bool
+	Transport string      // TransportTCP (default), TransportUDP or TransportAuto
+	TLSConfig *tls.Config // Used for rtsps:// URLs, nil for the defaults
+}
+
+// ParseTransport validates a transport name
+func ParseTransport(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "", TransportTCP:
+		return TransportTCP, nil
+	case TransportUDP:
+		return TransportUDP, nil
+	case TransportAuto:
+		return TransportAuto, nil
+	default:
+		return "", fmt.Errorf("unknown RTSP transport: %s (use tcp, udp or auto)", name)
+	}
+}
+
+// TestCredentials tests RTSP credentials against a URL. With
+// TransportAuto the stream is first set up over UDP and retried over TCP
+// when the UDP media never arrives, as happens behind NAT, firewalls and
+// VPNs that drop UDP.
+func TestCredentials(ctx context.Context, rtspURL string, cfg Config) (bool, string) {
+	// RTSPS streams are interleaved in the TLS connection
+	if strings.HasPrefix(rtspURL, "rtsps://") {
+		return testTransport(ctx, rtspURL, cfg, gortsplib.TransportTCP)
+	}
+
+	switch cfg.Transport {
+	case TransportUDP:
+		return testTransport(ctx, rtspURL, cfg, gortsplib.TransportUDP)
+	case TransportAuto:
+		success, response := testTransport(ctx, rtspURL, cfg, gortsplib.TransportUDP)
+		if success || !mediaFailure(response) || ctx.Err() != nil {
+			return success, response
+		}
+		slog.Debug("retrying RTSP over TCP", "reason", response, "from", TransportUDP, "to", TransportTCP)
+		return testTransport(ctx, rtspURL, cfg, gortsplib.TransportTCP)
+	default:
+		return testTransport(ctx, rtspURL, cfg, gortsplib.TransportTCP)
+	}
+}
+
+// mediaFailure reports whether a probe failed after DESCRIBE succeeded,
+// i.e. at a stage where the RTP transport makes a difference
+func mediaFailure(response string) bool {
+	return strings.HasPrefix(response, "Setup error") ||
+		strings.HasPrefix(response, "Play error") ||
+		response == "No packets received"
+}
+
+// newClient creates a client that dials through the configured dialer and
+// bounds every read and write by the read timeout
+func newClient(cfg Config, transport gortsplib.Transport) *gortsplib.Client {
+	timeouts := cfg.Timeouts
+	verbose := cfg.Verbose
+	var netDialer dialer.ContextDialer = &net.Dialer{}
+	if cfg.Dialer != nil {
+		netDialer = cfg.Dialer
+	}
+	return &gortsplib.Client{
+		ReadTimeout:  timeouts.Read,
+		WriteTimeout: timeouts.Read,
+		DialContext: func(dialCtx context.Context, network, address string) (net.Conn, error) {
+			connectCtx, cancel := context.WithTimeout(dialCtx, timeouts.Connect)
+			defer cancel()
+			return netDialer.DialContext(connectCtx, network, address)
+		},
 		// Ignore SSRC validation errors
 		OnDecodeError: func(err error) {
 			if !strings.Contains(err.Error(), "SSRC") {
@@ -33,11 +119,18 @@ func TestCredentials(rtspURL string, timeout time.Duration, verbose bool) (bool,
 				}
 			}
 		},
-		Transport: func() *gortsplib.Transport {
-			t := gortsplib.TransportTCP
-			return &t
-		}(),
+		Transport: &transport,
+		TLSConfig: cfg.TLSConfig,
 	}
+}
+
+// testTransport tests RTSP credentials using the given RTP transport. In
+// TCP mode gortsplib reads the interleaved "$<channel><length><data>"
+// frames from the RTSP connection itself; every read is bounded by the
+// read timeout so malformed frames cannot stall the probe.
+func testTransport(ctx context.Context, rtspURL string, cfg Config, transport gortsplib.Transport) (bool, string) {
+	timeouts := cfg.Timeouts
+	client := newClient(cfg, transport)
 
 	u, err := base.ParseURL(rtspURL)
 	if err != nil {
@@ -57,6 +150,9 @@ func TestCredentials(rtspURL string, timeout time.Duration, verbose bool) (bool,
 		err  error
 	}, 1)
 
+	describeCtx, cancelDescribe := context.WithTimeout(ctx, timeouts.Connect+timeouts.Read)
+	defer cancelDescribe()
+
 	go func() {
 		desc, resp, err := client.Describe(u)
 		descChan <- struct {
@@ -112,35 +208,46 @@ func TestCredentials(rtspURL string, timeout time.Duration, verbose bool) (bool,
 		})
 
 		// Wait briefly for a packet
+		packetCtx, cancelPacket := context.WithTimeout(ctx, timeouts.Read)
+		defer cancelPacket()
+
 		select {
 		case <-packetReceived:
 			return true, fmt.Sprintf("Response: %v", result.resp)
-		case <-time.After(timeout):
+		case <-packetCtx.Done():
 			return false, "No packets received"
 		}
-	case <-time.After(timeout):
+	case <-describeCtx.Done():
 		return false, "Describe timeout"
 	}
 }
 
-// GetFingerprint analyzes the response and URL to determine camera characteristics
-func GetFingerprint(response string, url string) string {
-	var features []string
-
-	// Vendor detection
+// DetectVendor returns the camera vendor named in an RTSP response, if any
+func DetectVendor(response string) string {
 	switch {
 	case strings.Contains(response, "H264DVR"):
-		features = append(features, "H264DVR")
+		return "H264DVR"
 	case strings.Contains(response, "Dahua"):
-		features = append(features, "Dahua")
+		return "Dahua"
 	case strings.Contains(response, "Hikvision"):
-		features = append(features, "Hikvision")
+		return "Hikvision"
 	case strings.Contains(response, "Sony"):
-		features = append(features, "Sony")
+		return "Sony"
 	case strings.Contains(response, "Axis"):
-		features = append(features, "Axis")
+		return "Axis"
 	case strings.Contains(response, "Bosch"):
-		features = append(features, "Bosch")
+		return "Bosch"
+	}
+	return ""
+}
+
+// GetFingerprint analyzes the response and URL to determine camera characteristics
+func GetFingerprint(response string, url string) string {
+	var features []string
+
+	// Vendor detection
+	if vendor := DetectVendor(response); vendor != "" {
+		features = append(features, vendor)
 	}
 
 	// Media type detection
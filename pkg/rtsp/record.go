@@ -0,0 +1,176 @@
+package rtsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+// ErrNoH264 is returned by RecordH264 for streams without H.264 video
+var ErrNoH264 = errors.New("stream has no H.264 video")
+
+// H.264 NAL unit types the recorder looks at
+const (
+	naluIDR = 5
+	naluSPS = 7
+)
+
+// annexBStartCode precedes every NAL unit of an Annex B stream
+var annexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// RecordH264 writes duration of the H.264 video of an RTSP stream to w as
+// an Annex B elementary stream, which players and ffmpeg read as a raw
+// .h264 file. Writing starts at the first keyframe behind the SPS and PPS
+// of the SDP so the file decodes from its first byte. RTP is read over TCP
+// unless the transport is UDP.
+func RecordH264(ctx context.Context, rtspURL string, w io.Writer, duration time.Duration, cfg Config) error {
+	transport := gortsplib.TransportTCP
+	if cfg.Transport == TransportUDP {
+		transport = gortsplib.TransportUDP
+	}
+	client := newClient(cfg, transport)
+
+	u, err := base.ParseURL(rtspURL)
+	if err != nil {
+		return fmt.Errorf("invalid RTSP URL: %v", err)
+	}
+	if err := client.Start(u.Scheme, u.Host); err != nil {
+		return fmt.Errorf("connection error: %v", err)
+	}
+	// Closed before reading the result so no callback writes afterwards
+	closeClient := sync.OnceFunc(client.Close)
+	defer closeClient()
+
+	desc, _, err := client.Describe(u)
+	if err != nil {
+		return fmt.Errorf("describe error: %v", err)
+	}
+	var forma *format.H264
+	medi := desc.FindFormat(&forma)
+	if medi == nil {
+		return ErrNoH264
+	}
+	if _, err := client.Setup(desc.BaseURL, medi, 0, 0); err != nil {
+		return fmt.Errorf("setup error: %v", err)
+	}
+	decoder, err := forma.CreateDecoder()
+	if err != nil {
+		return fmt.Errorf("unsupported H.264 packetization: %v", err)
+	}
+
+	writer := &annexBWriter{w: w}
+	writer.sps, writer.pps = forma.SafeParams()
+	client.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+		au, err := decoder.Decode(pkt)
+		if err != nil {
+			// Fragments are collected until the access unit is complete
+			return
+		}
+		writer.write(au)
+	})
+
+	if _, err := client.Play(nil); err != nil {
+		return fmt.Errorf("play error: %v", err)
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	clientErr := make(chan error, 1)
+	go func() { clientErr <- client.Wait() }()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	case err := <-clientErr:
+		if writer.frames() == 0 {
+			return fmt.Errorf("stream closed: %v", err)
+		}
+	}
+	closeClient()
+
+	if err := writer.error(); err != nil {
+		return err
+	}
+	if writer.frames() == 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errors.New("no H.264 keyframe received")
+	}
+	return nil
+}
+
+// annexBWriter writes access units as Annex B, from the first keyframe on
+type annexBWriter struct {
+	w        io.Writer
+	sps, pps []byte // Parameter sets of the SDP, written before the first keyframe
+
+	mu      sync.Mutex
+	started bool
+	count   int
+	err     error
+}
+
+// write writes one access unit, or drops it while no keyframe has arrived
+func (a *annexBWriter) write(au [][]byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return
+	}
+
+	if !a.started {
+		hasIDR, hasSPS := false, false
+		for _, nalu := range au {
+			if len(nalu) == 0 {
+				continue
+			}
+			switch nalu[0] & 0x1f {
+			case naluIDR:
+				hasIDR = true
+			case naluSPS:
+				hasSPS = true
+			}
+		}
+		if !hasIDR {
+			return
+		}
+		// Cameras that only announce the parameter sets in the SDP
+		if !hasSPS && a.sps != nil && a.pps != nil {
+			au = append([][]byte{a.sps, a.pps}, au...)
+		}
+		a.started = true
+	}
+
+	for _, nalu := range au {
+		if _, err := a.w.Write(annexBStartCode); err != nil {
+			a.err = err
+			return
+		}
+		if _, err := a.w.Write(nalu); err != nil {
+			a.err = err
+			return
+		}
+	}
+	a.count++
+}
+
+func (a *annexBWriter) frames() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.count
+}
+
+func (a *annexBWriter) error() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
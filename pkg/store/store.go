@@ -0,0 +1,178 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	_ "modernc.org/sqlite" // Pure Go SQLite driver registered as "sqlite"
+)
+
+// migrations upgrade the schema one version at a time. migrations[i]
+// moves a database from version i to i+1; append new steps, never edit
+// released ones.
+var migrations = []string{
+	`CREATE TABLE results (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		scan_time     TEXT NOT NULL,
+		ip            TEXT NOT NULL,
+		port          INTEGER NOT NULL,
+		protocol      TEXT NOT NULL,
+		username      TEXT NOT NULL,
+		password      TEXT NOT NULL,
+		path          TEXT NOT NULL,
+		url           TEXT NOT NULL,
+		vendor        TEXT NOT NULL DEFAULT '',
+		model         TEXT NOT NULL DEFAULT '',
+		firmware      TEXT NOT NULL DEFAULT '',
+		snapshot_path TEXT NOT NULL DEFAULT '',
+		vulnerability TEXT NOT NULL DEFAULT '',
+		raw_response  TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX results_ip ON results (ip, port);`,
+	`ALTER TABLE results ADD COLUMN country TEXT NOT NULL DEFAULT '';
+	ALTER TABLE results ADD COLUMN city    TEXT NOT NULL DEFAULT '';
+	ALTER TABLE results ADD COLUMN asn     TEXT NOT NULL DEFAULT '';
+	ALTER TABLE results ADD COLUMN org     TEXT NOT NULL DEFAULT '';`,
+}
+
+// SchemaVersion is the schema version written by this build
+var SchemaVersion = len(migrations)
+
+// Columns shown by Query, in table order
+var Columns = []string{"id", "scan_time", "ip", "port", "protocol", "username", "password", "vendor", "model", "firmware", "snapshot_path", "vulnerability", "country"}
+
+// Store is a SQLite database of scan results. It implements
+// output.ResultWriter so it can be combined with the other writers.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens or creates the database at path and migrates it to the
+// current schema
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	// SQLite allows a single writer; serialize instead of failing with
+	// "database is locked" when workers report at the same time
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database %s: %v", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// migrate applies the migrations the database has not seen yet
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	var version int
+	err := db.QueryRow(`SELECT version FROM schema_version`).Scan(&version)
+	if err == sql.ErrNoRows {
+		if _, err := db.Exec(`INSERT INTO schema_version (version) VALUES (0)`); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("schema version %d is newer than this build supports (%d)", version, SchemaVersion)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration to version %d: %v", version+1, err)
+		}
+		if _, err := tx.Exec(`UPDATE schema_version SET version = ?`, version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write inserts a result
+func (s *Store) Write(r output.Result) error {
+	scanTime := r.Timestamp
+	if scanTime.IsZero() {
+		scanTime = time.Now()
+	}
+	_, err := s.db.Exec(`INSERT INTO results
+		(scan_time, ip, port, protocol, username, password, path, url, vendor, model, firmware, snapshot_path, vulnerability, raw_response, country, city, asn, org)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		scanTime.UTC().Format(time.RFC3339), r.IP, r.Port, r.Protocol, r.Username, r.Password,
+		r.Path, r.URL, r.Vendor, r.Model, r.Firmware, r.Snapshot, r.Vulnerability, r.Response,
+		r.Country, r.City, r.ASN, r.Org)
+	if err != nil {
+		return fmt.Errorf("failed to store result: %v", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Query returns the results matching a SQL WHERE clause, oldest first. An
+// empty clause matches every row. The clause is inserted as is; it is
+// meant for the owner of the database, not for untrusted input.
+func (s *Store) Query(where string) ([][]string, error) {
+	query := "SELECT " + strings.Join(Columns, ", ") + " FROM results"
+	if strings.TrimSpace(where) != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var table [][]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(Columns))
+		dest := make([]any, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = value.String
+		}
+		table = append(table, row)
+	}
+	return table, rows.Err()
+}
+
+// WriteTable prints rows returned by Query as an aligned table
+func WriteTable(w io.Writer, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(Columns, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
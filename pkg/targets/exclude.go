@@ -0,0 +1,154 @@
+package targets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Exclusions is a set of addresses that must never be probed. Single
+// addresses are kept in a set, ranges as their bounds and CIDR blocks as
+// networks, so wide exclusions cost no memory and are never cut short. A
+// nil Exclusions excludes nothing.
+type Exclusions struct {
+	ipv4   map[uint32]struct{}
+	ipv6   map[string]struct{}
+	ranges []ipRange
+	nets   []*net.IPNet
+}
+
+// ipRange is an inclusive a-b range, both bounds of the same length
+type ipRange struct {
+	start, end net.IP
+}
+
+// LoadExclusions builds the exclusions of a file with one expression per
+// line and of a comma separated expression, either of which may be empty.
+// It returns nil if both are empty.
+func LoadExclusions(path, expr string) (*Exclusions, error) {
+	if path == "" && expr == "" {
+		return nil, nil
+	}
+	e := &Exclusions{
+		ipv4: make(map[uint32]struct{}),
+		ipv6: make(map[string]struct{}),
+	}
+
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open exclude file: %v", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		lineNum := 0
+		for scanner.Scan() {
+			lineNum++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if err := e.add(line); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read exclude file: %v", err)
+		}
+	}
+
+	if err := e.add(expr); err != nil {
+		return nil, fmt.Errorf("invalid exclusion: %v", err)
+	}
+	return e, nil
+}
+
+// add adds every part of a comma separated expression
+func (e *Exclusions) add(expr string) error {
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if strings.Contains(part, "/") {
+			_, ipnet, err := net.ParseCIDR(part)
+			if err != nil {
+				return fmt.Errorf("invalid CIDR range: %q", part)
+			}
+			e.nets = append(e.nets, ipnet)
+			continue
+		}
+
+		if start, end, ok := strings.Cut(part, "-"); ok {
+			startIP := parseIP(strings.TrimSpace(start))
+			endIP := parseIP(strings.TrimSpace(end))
+			if startIP == nil || endIP == nil {
+				return fmt.Errorf("invalid IP range: %s", part)
+			}
+			if len(startIP) != len(endIP) {
+				return fmt.Errorf("IP range mixes address families: %s", part)
+			}
+			if bytes.Compare(startIP, endIP) > 0 {
+				return fmt.Errorf("IP range start is after end: %s", part)
+			}
+			e.ranges = append(e.ranges, ipRange{start: startIP, end: endIP})
+			continue
+		}
+
+		ip := parseIP(part)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address: %q", part)
+		}
+		if len(ip) == net.IPv4len {
+			e.ipv4[binary.BigEndian.Uint32(ip)] = struct{}{}
+		} else {
+			e.ipv6[ip.String()] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Contains reports whether ip is excluded
+func (e *Exclusions) Contains(ip net.IP) bool {
+	if e == nil || ip == nil {
+		return false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		if _, ok := e.ipv4[binary.BigEndian.Uint32(v4)]; ok {
+			return true
+		}
+	} else if _, ok := e.ipv6[ip.String()]; ok {
+		return true
+	}
+	ip = normalize(ip)
+	for _, r := range e.ranges {
+		if len(ip) == len(r.start) && bytes.Compare(ip, r.start) >= 0 && bytes.Compare(ip, r.end) <= 0 {
+			return true
+		}
+	}
+	for _, ipnet := range e.nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsHost reports whether the host of an ip:port target, or a bare
+// address, is excluded
+func (e *Exclusions) ContainsHost(target string) bool {
+	if e == nil {
+		return false
+	}
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+	return e.Contains(net.ParseIP(host))
+}
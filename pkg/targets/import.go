@@ -0,0 +1,198 @@
+package targets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+)
+
+// Formats of the port scanner results Import reads
+const (
+	FormatNmap    = "nmap"
+	FormatMasscan = "masscan"
+)
+
+// masscanHeader starts a masscan -oB file; the header record is padded
+// to masscanHeaderSize bytes
+const (
+	masscanHeader     = "masscan/1."
+	masscanHeaderSize = 99
+)
+
+// masscan record types holding an open IPv4 port: the original layout and
+// the one with the IP protocol
+const (
+	masscanOpen         = 1
+	masscanOpenProtocol = 6
+)
+
+// ipProtoTCP is the IP protocol number of TCP
+const ipProtoTCP = 6
+
+// Import reads the open TCP ports of a port scanner result in the given
+// format and returns them as ip:port targets, in the order they appear and
+// without duplicates
+func Import(r io.Reader, format string) ([]string, error) {
+	switch format {
+	case FormatNmap:
+		return ReadNmap(r)
+	case FormatMasscan:
+		return ReadMasscan(r)
+	default:
+		return nil, fmt.Errorf("unknown input format: %s (use %s or %s)", format, FormatNmap, FormatMasscan)
+	}
+}
+
+// ReadNmap reads the open TCP ports of an nmap -oX report
+func ReadNmap(r io.Reader) ([]string, error) {
+	var report struct {
+		Hosts []struct {
+			Addresses []struct {
+				Addr     string `xml:"addr,attr"`
+				AddrType string `xml:"addrtype,attr"`
+			} `xml:"address"`
+			Ports []struct {
+				Protocol string `xml:"protocol,attr"`
+				PortID   int    `xml:"portid,attr"`
+				State    struct {
+					State string `xml:"state,attr"`
+				} `xml:"state"`
+			} `xml:"ports>port"`
+		} `xml:"host"`
+	}
+	if err := xml.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("invalid nmap XML: %v", err)
+	}
+
+	var services serviceList
+	for _, host := range report.Hosts {
+		ip := ""
+		for _, address := range host.Addresses {
+			if address.AddrType == "ipv4" || address.AddrType == "ipv6" {
+				ip = address.Addr
+				break
+			}
+		}
+		if net.ParseIP(ip) == nil {
+			continue
+		}
+		for _, port := range host.Ports {
+			if port.Protocol == "tcp" && port.State.State == "open" {
+				services.add(ip, port.PortID)
+			}
+		}
+	}
+	return services.targets, nil
+}
+
+// ReadMasscan reads the open TCP ports of a masscan -oB file. Input that
+// does not start with the masscan header is read as plain 6-byte records
+// of a big-endian IPv4 address and port.
+func ReadMasscan(r io.Reader) ([]string, error) {
+	reader := bufio.NewReader(r)
+	head, err := reader.Peek(len(masscanHeader))
+	if err == nil && bytes.Equal(head, []byte(masscanHeader)) {
+		return readMasscanRecords(reader)
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var services serviceList
+	record := make([]byte, 6)
+	for {
+		if _, err := io.ReadFull(reader, record); err != nil {
+			if err == io.EOF {
+				return services.targets, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return nil, errors.New("masscan input is not a whole number of 6-byte records")
+			}
+			return nil, err
+		}
+		services.add(net.IP(record[:4]).String(), int(binary.BigEndian.Uint16(record[4:])))
+	}
+}
+
+// readMasscanRecords reads the type-length-value records after the header
+// of a masscan binary file, keeping open IPv4 TCP ports
+func readMasscanRecords(reader *bufio.Reader) ([]string, error) {
+	if _, err := io.ReadFull(reader, make([]byte, masscanHeaderSize)); err != nil {
+		return nil, errors.New("truncated masscan header")
+	}
+
+	var services serviceList
+	for {
+		recordType, err := readVarint(reader)
+		if err == io.EOF {
+			return services.targets, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		length, err := readVarint(reader)
+		if err != nil {
+			return nil, errors.New("truncated masscan record")
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, errors.New("truncated masscan record")
+		}
+
+		// Both layouts start with a timestamp and the address; the newer
+		// one has the IP protocol before the port
+		switch {
+		case recordType == masscanOpen && len(data) >= 10:
+			services.add(net.IP(data[4:8]).String(), int(binary.BigEndian.Uint16(data[8:10])))
+		case recordType == masscanOpenProtocol && len(data) >= 11 && data[8] == ipProtoTCP:
+			services.add(net.IP(data[4:8]).String(), int(binary.BigEndian.Uint16(data[9:11])))
+		}
+	}
+}
+
+// readVarint reads a masscan variable length number: 7 bits per byte,
+// most significant first, with the high bit set on all but the last byte
+func readVarint(reader *bufio.Reader) (uint64, error) {
+	var value uint64
+	for i := 0; i < 4; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			if i > 0 && err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		value = value<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, errors.New("invalid masscan record length")
+}
+
+// serviceList collects ip:port targets without duplicates
+type serviceList struct {
+	targets []string
+	seen    map[string]bool
+}
+
+func (l *serviceList) add(ip string, port int) {
+	if port < 1 || port > 65535 {
+		return
+	}
+	if l.seen == nil {
+		l.seen = make(map[string]bool)
+	}
+	target := utils.FormatTarget(ip, port)
+	if !l.seen[target] {
+		l.seen[target] = true
+		l.targets = append(l.targets, target)
+	}
+}
@@ -0,0 +1,241 @@
+package targets
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+)
+
+// DefaultIPv6MaxHosts caps how many addresses a single IPv6 range expands to
+const DefaultIPv6MaxHosts = 65536
+
+// Options controls target expansion
+type Options struct {
+	// IPv6MaxHosts caps the addresses taken from one IPv6 CIDR or range.
+	// Larger ranges are truncated to their first IPv6MaxHosts addresses.
+	IPv6MaxHosts int
+	// Warnf is called when a range gets truncated, may be nil
+	Warnf func(format string, args ...interface{})
+}
+
+// Expand parses a target expression and returns every address it covers.
+// Supported forms are single IPv4 or IPv6 addresses, CIDR ranges, start-end
+// ranges and comma-separated combinations of those. IPv6 ranges are capped
+// at DefaultIPv6MaxHosts.
+func Expand(expr string) ([]net.IP, error) {
+	return ExpandWithOptions(expr, Options{})
+}
+
+// ExpandWithOptions is Expand with the IPv6 cap and truncation warnings
+// taken from opts
+func ExpandWithOptions(expr string, opts Options) ([]net.IP, error) {
+	var ips []net.IP
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		expanded, err := expandOne(part, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range expanded {
+			key := ip.String()
+			if !seen[key] {
+				seen[key] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no targets in expression: %q", expr)
+	}
+	return ips, nil
+}
+
+// ReadFile expands every expression in a file, one per line.
+// Empty lines and lines starting with # are ignored.
+func ReadFile(path string, opts Options) ([]net.IP, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open targets file: %v", err)
+	}
+	defer file.Close()
+
+	var ips []net.IP
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		expanded, err := ExpandWithOptions(line, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+		}
+		for _, ip := range expanded {
+			key := ip.String()
+			if !seen[key] {
+				seen[key] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %v", err)
+	}
+	return ips, nil
+}
+
+// expandOne expands a single IP, CIDR or range expression
+func expandOne(expr string, opts Options) ([]net.IP, error) {
+	switch {
+	case strings.Contains(expr, "/"):
+		return expandCIDR(expr, opts)
+	case strings.Contains(expr, "-"):
+		parts := strings.SplitN(expr, "-", 2)
+		return expandRange(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), opts)
+	default:
+		ip := parseIP(expr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %q", expr)
+		}
+		return []net.IP{ip}, nil
+	}
+}
+
+// expandCIDR enumerates a CIDR block. For IPv4 the network and broadcast
+// addresses are skipped, except for /31 and /32 which have no such
+// addresses. IPv6 blocks are capped at opts.IPv6MaxHosts.
+func expandCIDR(cidr string, opts Options) ([]net.IP, error) {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR range: %q", cidr)
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	limit := -1
+	if bits == 8*net.IPv6len {
+		size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+		limit = ipv6Limit(cidr, size, opts)
+	}
+
+	var ips []net.IP
+	for cur := normalize(ip.Mask(ipnet.Mask)); ipnet.Contains(cur); cur = next(cur) {
+		if limit >= 0 && len(ips) >= limit {
+			break
+		}
+		ips = append(ips, cur)
+		if isLast(cur) {
+			break
+		}
+	}
+
+	if bits == 8*net.IPv4len && bits-ones > 1 && len(ips) > 2 {
+		ips = ips[1 : len(ips)-1]
+	}
+	return ips, nil
+}
+
+// expandRange enumerates every address from start to end inclusive
+func expandRange(start, end string, opts Options) ([]net.IP, error) {
+	startIP := parseIP(start)
+	endIP := parseIP(end)
+	if startIP == nil || endIP == nil {
+		return nil, fmt.Errorf("invalid IP range: %s-%s", start, end)
+	}
+	if len(startIP) != len(endIP) {
+		return nil, fmt.Errorf("IP range mixes address families: %s-%s", start, end)
+	}
+	if bytes.Compare(startIP, endIP) > 0 {
+		return nil, fmt.Errorf("IP range start is after end: %s-%s", start, end)
+	}
+
+	limit := -1
+	if len(startIP) == net.IPv6len {
+		size := new(big.Int).Sub(new(big.Int).SetBytes(endIP), new(big.Int).SetBytes(startIP))
+		size.Add(size, big.NewInt(1))
+		limit = ipv6Limit(start+"-"+end, size, opts)
+	}
+
+	var ips []net.IP
+	for cur := startIP; bytes.Compare(cur, endIP) <= 0; cur = next(cur) {
+		if limit >= 0 && len(ips) >= limit {
+			break
+		}
+		ips = append(ips, cur)
+		if isLast(cur) {
+			break
+		}
+	}
+	return ips, nil
+}
+
+// ipv6Limit returns how many addresses of an IPv6 range of the given size
+// may be enumerated, warning when the range has to be truncated
+func ipv6Limit(expr string, size *big.Int, opts Options) int {
+	max := opts.IPv6MaxHosts
+	if max <= 0 {
+		max = DefaultIPv6MaxHosts
+	}
+	if size.Cmp(big.NewInt(int64(max))) <= 0 {
+		return max
+	}
+	if opts.Warnf != nil {
+		opts.Warnf("IPv6 range %s holds %s addresses, only the first %d will be scanned (raise with --ipv6-max-hosts)", expr, size.String(), max)
+	}
+	return max
+}
+
+// parseIP parses an address and stores IPv4 in its 4-byte form
+func parseIP(s string) net.IP {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	return normalize(ip)
+}
+
+// normalize returns IPv4 addresses in their 4-byte form
+func normalize(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// next returns a copy of ip incremented by one
+func next(ip net.IP) net.IP {
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+	for j := len(out) - 1; j >= 0; j-- {
+		out[j]++
+		if out[j] > 0 {
+			break
+		}
+	}
+	return out
+}
+
+// isLast reports whether ip is the highest address of its family
+func isLast(ip net.IP) bool {
+	for _, b := range ip {
+		if b != 0xFF {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,283 @@
+// Package throttle caps the outbound bandwidth of a scan. Writes wait for
+// tokens from a bucket shared by every connection and, optionally, from a
+// bucket per target host, so a saturated link slows the scan down instead
+// of dropping packets.
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+	"golang.org/x/time/rate"
+)
+
+// maxBurst bounds the bytes a bucket hands out at once; larger writes are
+// split so they spread over time at low rates
+const maxBurst = 32 * 1024
+
+// units are the accepted rate suffixes and their size in bits, longest
+// first so "bytes" is not read as "s"
+var units = []struct {
+	suffix string
+	bits   float64
+}{
+	{"bytes", 8},
+	{"byte", 8},
+	{"bits", 1},
+	{"bit", 1},
+	{"Bps", 8},
+	{"bps", 1},
+	{"B", 8},
+	{"b", 1},
+}
+
+// prefixes are the accepted decimal multipliers
+var prefixes = map[byte]float64{
+	'k': 1e3, 'K': 1e3,
+	'M': 1e6,
+	'G': 1e9,
+}
+
+// ParseRate parses a bandwidth such as "10Mbit", "500kB" or "1G" and
+// returns it in bytes per second. A number without a unit is in bits, "B"
+// and "byte" are bytes, and k, M and G are powers of 1000.
+func ParseRate(s string) (int64, error) {
+	value := strings.TrimSuffix(strings.TrimSpace(s), "/s")
+
+	bits := 1.0
+	for _, unit := range units {
+		if rest, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, bits = rest, unit.bits
+			break
+		}
+	}
+	if n := len(value); n > 0 {
+		if multiplier, ok := prefixes[value[n-1]]; ok {
+			value, bits = value[:n-1], bits*multiplier
+		}
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q (e.g. 10Mbit, 500kB)", s)
+	}
+	bytes := int64(number * bits / 8)
+	if bytes < 1 {
+		return 0, fmt.Errorf("bandwidth %q is below one byte per second", s)
+	}
+	return bytes, nil
+}
+
+// Options configures a Throttle
+type Options struct {
+	Rate        int64 // Bytes per second across all connections, 0 for no limit
+	PerHostRate int64 // Bytes per second to one host, 0 for no limit
+}
+
+// hostBucket is the bucket of one host, kept while it has open connections
+type hostBucket struct {
+	limiter *rate.Limiter
+	conns   int
+}
+
+// Throttle hands out write tokens. It is safe for concurrent use; a nil
+// Throttle does not limit anything.
+type Throttle struct {
+	global  *rate.Limiter
+	perHost int64
+
+	mu    sync.Mutex
+	hosts map[string]*hostBucket
+}
+
+// New creates a throttle, or returns nil if neither rate is set
+func New(opts Options) *Throttle {
+	if opts.Rate <= 0 && opts.PerHostRate <= 0 {
+		return nil
+	}
+	t := &Throttle{
+		perHost: opts.PerHostRate,
+		hosts:   make(map[string]*hostBucket),
+	}
+	if opts.Rate > 0 {
+		t.global = newLimiter(opts.Rate)
+	}
+	return t
+}
+
+// newLimiter creates a token bucket refilled with bytes per second
+func newLimiter(bytes int64) *rate.Limiter {
+	burst := bytes
+	if burst > maxBurst {
+		burst = maxBurst
+	}
+	return rate.NewLimiter(rate.Limit(bytes), int(burst))
+}
+
+// Dialer wraps next so the connections it opens are throttled. Hosts are
+// taken from the dialed address, so connections through a proxy still
+// count against their target.
+func (t *Throttle) Dialer(next dialer.ContextDialer) dialer.ContextDialer {
+	if t == nil {
+		return next
+	}
+	return throttledDialer{t: t, next: next}
+}
+
+type throttledDialer struct {
+	t    *Throttle
+	next dialer.ContextDialer
+}
+
+func (d throttledDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.next.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := utils.SplitHostPort(address)
+	return d.t.Conn(conn, host), nil
+}
+
+// Conn wraps conn so its writes to host are throttled. Closing the
+// returned connection releases writes still waiting for tokens.
+func (t *Throttle) Conn(conn net.Conn, host string) net.Conn {
+	if t == nil {
+		return conn
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &throttledConn{
+		Conn:    conn,
+		t:       t,
+		host:    host,
+		limiter: t.acquire(host),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Writer wraps w so writes to host are throttled
+func (t *Throttle) Writer(w io.Writer, host string) io.Writer {
+	if t == nil {
+		return w
+	}
+	return &throttledWriter{w: w, t: t, host: host}
+}
+
+// acquire returns the bucket of host and counts a connection to it, or nil
+// without a per-host rate
+func (t *Throttle) acquire(host string) *rate.Limiter {
+	if t.perHost <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bucket, ok := t.hosts[host]
+	if !ok {
+		bucket = &hostBucket{limiter: newLimiter(t.perHost)}
+		t.hosts[host] = bucket
+	}
+	bucket.conns++
+	return bucket.limiter
+}
+
+// release drops a connection to host and forgets its bucket once the last
+// one is closed, so long scans do not keep a bucket per address
+func (t *Throttle) release(host string) {
+	if t.perHost <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if bucket, ok := t.hosts[host]; ok {
+		bucket.conns--
+		if bucket.conns <= 0 {
+			delete(t.hosts, host)
+		}
+	}
+}
+
+// wait blocks until n bytes may be written under both buckets
+func (t *Throttle) wait(ctx context.Context, host *rate.Limiter, n int) error {
+	if t.global != nil {
+		if err := t.global.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	if host != nil {
+		return host.WaitN(ctx, n)
+	}
+	return nil
+}
+
+// chunk returns how many of n bytes may be written in one step
+func (t *Throttle) chunk(host *rate.Limiter, n int) int {
+	if t.global != nil && n > t.global.Burst() {
+		n = t.global.Burst()
+	}
+	if host != nil && n > host.Burst() {
+		n = host.Burst()
+	}
+	return n
+}
+
+// write writes p to w in steps the buckets allow
+func (t *Throttle) write(ctx context.Context, host *rate.Limiter, w io.Writer, p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := t.chunk(host, len(p)-written)
+		if err := t.wait(ctx, host, n); err != nil {
+			return written, err
+		}
+		m, err := w.Write(p[written : written+n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+type throttledConn struct {
+	net.Conn
+	t       *Throttle
+	host    string
+	limiter *rate.Limiter
+	ctx     context.Context
+	cancel  context.CancelFunc
+	once    sync.Once
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	n, err := c.t.write(c.ctx, c.limiter, c.Conn, p)
+	if err != nil && c.ctx.Err() != nil {
+		return n, net.ErrClosed
+	}
+	return n, err
+}
+
+func (c *throttledConn) Close() error {
+	c.once.Do(func() {
+		c.cancel()
+		c.t.release(c.host)
+	})
+	return c.Conn.Close()
+}
+
+type throttledWriter struct {
+	w    io.Writer
+	t    *Throttle
+	host string
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	limiter := w.t.acquire(w.host)
+	defer w.t.release(w.host)
+	return w.t.write(context.Background(), limiter, w.w, p)
+}
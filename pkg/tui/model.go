@@ -0,0 +1,323 @@
+package tui
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/config"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/ALW1EZ/camtruder/pkg/progress"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Width of the progress bar
+const barWidth = 40
+
+// Warnings kept for the log pane
+const logLines = 5
+
+// Lines used by everything but the table rows
+const chromeLines = 9 + logLines
+
+// statsMsg delivers a progress update to the model
+type statsMsg progress.Stats
+
+// model is the bubbletea model of the dashboard
+type model struct {
+	title       string
+	checksPerIP int
+	cancel      context.CancelFunc
+	statsCh     <-chan progress.Stats
+	updates     <-chan tea.Msg
+
+	stats    progress.Stats
+	hits     []output.Result
+	logs     []string
+	selected int
+	offset   int // First table row on screen
+	width    int
+	height   int
+
+	finished    bool
+	confirmQuit bool
+	status      string
+}
+
+func newModel(opts Options, statsCh <-chan progress.Stats, updates <-chan tea.Msg) *model {
+	checksPerIP := opts.ChecksPerIP
+	if checksPerIP < 1 {
+		checksPerIP = 1
+	}
+	return &model{
+		title:       opts.Title,
+		checksPerIP: checksPerIP,
+		cancel:      opts.Cancel,
+		statsCh:     statsCh,
+		updates:     updates,
+		width:       100,
+		height:      30,
+	}
+}
+
+// waitStats receives the next progress update
+func (m *model) waitStats() tea.Cmd {
+	return func() tea.Msg {
+		stats, ok := <-m.statsCh
+		if !ok {
+			return nil
+		}
+		return statsMsg(stats)
+	}
+}
+
+// waitUpdate receives the next result, warning or end of scan
+func (m *model) waitUpdate() tea.Cmd {
+	return func() tea.Msg {
+		return <-m.updates
+	}
+}
+
+func (m *model) Init() tea.Cmd {
+	return tea.Batch(m.waitStats(), m.waitUpdate())
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case statsMsg:
+		m.stats = progress.Stats(msg)
+		return m, m.waitStats()
+	case resultMsg:
+		m.hits = append(m.hits, output.Result(msg))
+		return m, m.waitUpdate()
+	case logMsg:
+		m.logs = append(m.logs, string(msg))
+		if len(m.logs) > logLines {
+			m.logs = m.logs[len(m.logs)-logLines:]
+		}
+		return m, m.waitUpdate()
+	case finishedMsg:
+		m.finished = true
+		m.confirmQuit = false
+		m.status = "Scan finished, press q to exit"
+		return m, m.waitUpdate()
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scroll()
+		return m, nil
+	case tea.KeyMsg:
+		return m.key(msg.String())
+	}
+	return m, nil
+}
+
+// key handles a key press
+func (m *model) key(key string) (tea.Model, tea.Cmd) {
+	if m.confirmQuit {
+		m.confirmQuit = false
+		if key == "y" || key == "Y" {
+			return m, m.quit()
+		}
+		m.status = ""
+		return m, nil
+	}
+
+	switch key {
+	case "ctrl+c":
+		return m, m.quit()
+	case "q":
+		if m.finished {
+			return m, m.quit()
+		}
+		m.confirmQuit = true
+		m.status = "Stop the scan and quit? (y/n)"
+	case "up", "k":
+		m.selected--
+	case "down", "j":
+		m.selected++
+	case "pgup":
+		m.selected -= m.rows()
+	case "pgdown":
+		m.selected += m.rows()
+	case "home", "g":
+		m.selected = 0
+	case "end", "G":
+		m.selected = len(m.hits) - 1
+	case "s":
+		path, err := saveResults(m.hits)
+		if err != nil {
+			m.status = fmt.Sprintf("Failed to save results: %v", err)
+		} else {
+			m.status = fmt.Sprintf("Saved %d result(s) to %s", len(m.hits), path)
+		}
+	case "c":
+		if len(m.hits) == 0 {
+			m.status = "No camera selected"
+			break
+		}
+		hit := m.hits[m.selected]
+		m.status = fmt.Sprintf("Copied %s", hit.URL)
+		return m, copyToClipboard(hit.URL)
+	}
+	m.scroll()
+	return m, nil
+}
+
+// quit stops the scan and closes the dashboard
+func (m *model) quit() tea.Cmd {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	return tea.Quit
+}
+
+// rows is the number of table rows that fit on screen
+func (m *model) rows() int {
+	if rows := m.height - chromeLines; rows > 3 {
+		return rows
+	}
+	return 3
+}
+
+// scroll keeps the selection in range and on screen
+func (m *model) scroll() {
+	if m.selected >= len(m.hits) {
+		m.selected = len(m.hits) - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+	rows := m.rows()
+	if m.selected < m.offset {
+		m.offset = m.selected
+	}
+	if m.selected >= m.offset+rows {
+		m.offset = m.selected - rows + 1
+	}
+}
+
+func (m *model) View() string {
+	var b strings.Builder
+	stats := m.stats
+
+	state := "scanning"
+	if m.finished {
+		state = "finished"
+	}
+	fmt.Fprintf(&b, "%s camtruder %s %s | %s\n", config.ColorBold, config.ColorReset, m.title, state)
+
+	// Progress bar
+	fraction := 0.0
+	if stats.Total > 0 {
+		fraction = float64(stats.Completed) / float64(stats.Total)
+		if fraction > 1 {
+			fraction = 1
+		}
+	}
+	filled := int(fraction * barWidth)
+	fmt.Fprintf(&b, " %s%s%s%s %5.1f%%  %d/%d checks",
+		config.ColorGreen, strings.Repeat("█", filled), config.ColorReset, strings.Repeat("░", barWidth-filled),
+		fraction*100, stats.Completed, stats.Total)
+	if stats.ETA > 0 && !m.finished {
+		fmt.Fprintf(&b, "  ETA %s", stats.ETA.Round(time.Second))
+	}
+	b.WriteString("\n")
+
+	// Statistics
+	fmt.Fprintf(&b, " Hosts/s %s%.1f%s | Checks/s %.1f | Found %s%d%s | Errors %s%d%s | Elapsed %s\n\n",
+		config.ColorBold, stats.Rate/float64(m.checksPerIP), config.ColorReset, stats.Rate,
+		config.ColorGreen, stats.Hits, config.ColorReset,
+		config.ColorRed, stats.Errors, config.ColorReset,
+		stats.Elapsed.Round(time.Second))
+
+	// Hits
+	fmt.Fprintf(&b, "%s   %-24s %-6s %-24s %s%s\n", config.ColorBold, "IP", "PORT", "CREDENTIALS", "VENDOR", config.ColorReset)
+	rows := m.rows()
+	for i := m.offset; i < m.offset+rows; i++ {
+		if i >= len(m.hits) {
+			b.WriteString("\n")
+			continue
+		}
+		hit := m.hits[i]
+		creds := hit.Username + ":" + hit.Password
+		if hit.Vulnerability != "" {
+			creds = hit.Vulnerability
+		}
+		line := fmt.Sprintf("%-24s %-6s %-24s %s",
+			clip(hit.IP, 24), strconv.Itoa(hit.Port), clip(creds, 24), strings.TrimSpace(hit.Vendor+" "+hit.Model))
+		if i == m.selected {
+			fmt.Fprintf(&b, "%s > %s%s\n", config.ColorCyan, clip(line, m.width-4), config.ColorReset)
+		} else {
+			fmt.Fprintf(&b, "   %s\n", clip(line, m.width-4))
+		}
+	}
+	b.WriteString("\n")
+
+	// Warnings
+	fmt.Fprintf(&b, "%s Warnings%s\n", config.ColorBold, config.ColorReset)
+	for i := 0; i < logLines; i++ {
+		if i < len(m.logs) {
+			fmt.Fprintf(&b, " %s%s%s", config.ColorYellow, clip(m.logs[i], m.width-2), config.ColorReset)
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, " %s↑/↓ select  c copy URL  s save  q quit%s\n", config.ColorBold, config.ColorReset)
+	b.WriteString(" " + clip(m.status, m.width-2))
+	return b.String()
+}
+
+// clip shortens s to at most width characters
+func clip(s string, width int) string {
+	if width < 1 {
+		return ""
+	}
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	if width == 1 {
+		return "…"
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// saveResults writes results as JSON lines to a new file in the working
+// directory and returns its name
+func saveResults(results []output.Result) (string, error) {
+	name := fmt.Sprintf("camtruder_%s.json", time.Now().Format("20060102_150405"))
+	f, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	w, err := output.NewWriter(output.FormatJSON, f)
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+	for _, r := range results {
+		if err := w.Write(r); err != nil {
+			f.Close()
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return "", err
+	}
+	return name, f.Close()
+}
+
+// copyToClipboard sets the terminal clipboard with an OSC 52 sequence,
+// which also works over SSH. Stdout is owned by the renderer, so the
+// sequence goes to stderr.
+func copyToClipboard(text string) tea.Cmd {
+	return func() tea.Msg {
+		fmt.Fprintf(os.Stderr, "\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+		return nil
+	}
+}
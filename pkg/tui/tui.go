@@ -0,0 +1,139 @@
+// Package tui is the interactive terminal dashboard of --tui. It shows the
+// progress, the cameras found, scan statistics and warnings while a scan
+// runs, and lets the operator save results and copy stream URLs.
+package tui
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/ALW1EZ/camtruder/pkg/progress"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/projectdiscovery/gologger/levels"
+	"github.com/projectdiscovery/gologger/writer"
+)
+
+// Supported reports whether the terminal can show the dashboard. It needs
+// $TERM and a terminal on stdout.
+func Supported() bool {
+	term := os.Getenv("TERM")
+	if term == "" || term == "dumb" {
+		return false
+	}
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Options configures a UI
+type Options struct {
+	Title       string             // Shown in the header, e.g. the targets
+	Tracker     *progress.Tracker  // Source of the progress and statistics
+	ChecksPerIP int                // Credential pairs tested per target, for hosts/s
+	Cancel      context.CancelFunc // Stops the scan when the operator quits
+}
+
+// UI runs the dashboard. Scan workers feed it through the writers returned
+// by Results and Logs; progress comes from the tracker's Watch channel.
+type UI struct {
+	program *tea.Program
+	updates chan tea.Msg
+	done    chan struct{}
+
+	mu   sync.Mutex
+	hits []output.Result // Every result received, for the exit summary
+}
+
+// resultMsg delivers a result to the model
+type resultMsg output.Result
+
+// logMsg delivers a warning to the model
+type logMsg string
+
+// finishedMsg tells the model the scan has ended
+type finishedMsg struct{}
+
+// New creates a UI. Watch is called on opts.Tracker, so New must run
+// before the tracker is started.
+func New(opts Options) *UI {
+	u := &UI{
+		updates: make(chan tea.Msg, 256),
+		done:    make(chan struct{}),
+	}
+	m := newModel(opts, opts.Tracker.Watch(), u.updates)
+	u.program = tea.NewProgram(m, tea.WithAltScreen())
+	return u
+}
+
+// Start shows the dashboard in the background
+func (u *UI) Start() {
+	go func() {
+		defer close(u.done)
+		u.program.Run()
+	}()
+}
+
+// Finish tells the dashboard the scan has ended and waits until the
+// operator closes it
+func (u *UI) Finish() {
+	u.send(finishedMsg{})
+	<-u.done
+}
+
+// Hits returns the results received so far
+func (u *UI) Hits() []output.Result {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]output.Result(nil), u.hits...)
+}
+
+// Results wraps a result writer so results also appear in the dashboard
+func (u *UI) Results(next output.ResultWriter) output.ResultWriter {
+	return &resultWriter{u: u, next: next}
+}
+
+type resultWriter struct {
+	u    *UI
+	next output.ResultWriter
+}
+
+func (w *resultWriter) Write(r output.Result) error {
+	w.u.mu.Lock()
+	w.u.hits = append(w.u.hits, r)
+	w.u.mu.Unlock()
+	w.u.send(resultMsg(r))
+	return w.next.Write(r)
+}
+
+func (w *resultWriter) Close() error {
+	return w.next.Close()
+}
+
+// Logs returns a gologger writer that shows warnings and errors in the log
+// pane. Other levels are dropped: hits are in the table and the rest would
+// scroll warnings out of view.
+func (u *UI) Logs() writer.Writer {
+	return logWriter{u: u}
+}
+
+type logWriter struct {
+	u *UI
+}
+
+func (w logWriter) Write(data []byte, level levels.Level) {
+	switch level {
+	case levels.LevelWarning, levels.LevelError, levels.LevelFatal:
+		w.u.send(logMsg(strings.TrimSpace(string(data))))
+	}
+}
+
+// send queues a message for the model, dropping it if the dashboard has
+// already been closed
+func (u *UI) send(msg tea.Msg) {
+	select {
+	case u.updates <- msg:
+	case <-u.done:
+	}
+}
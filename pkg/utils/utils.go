@@ -1,73 +1,20 @@
 package utils
 
 import (
+	"context"
 	"crypto/rand"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net"
-	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"bytes"
 	"github.com/ALW1EZ/camtruder/pkg/config"
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
 	"github.com/common-nighthawk/go-figure"
-	"bytes"
 )
 
-type GeoIPResponse struct {
-	City      string  `json:"city"`
-	Country   string  `json:"country"`
-	IP        string  `json:"ip"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
-	State     string  `json:"state"`
-}
-
-// GetGeoLocation returns the geolocation information for an IP address
-func GetGeoLocation(ip string) string {
-	// Remove port if present
-	if strings.Contains(ip, ":") {
-		ip = strings.Split(ip, ":")[0]
-	}
-
-	url := fmt.Sprintf("https://api.hackertarget.com/geoip/?q=%s&output=json", ip)
-	resp, err := http.Get(url)
-	if err != nil {
-		return "Unknown Location"
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "Unknown Location"
-	}
-
-	var geoIP GeoIPResponse
-	if err := json.Unmarshal(body, &geoIP); err != nil {
-		return "Unknown Location"
-	}
-
-	// Build location string
-	var location []string
-	if geoIP.Country != "" {
-		location = append(location, geoIP.Country)
-	}
-	if geoIP.State != "" {
-		location = append(location, geoIP.State)
-	}
-	if geoIP.City != "" {
-		location = append(location, geoIP.City)
-	}
-
-	if len(location) == 0 {
-		return "Unknown Location"
-	}
-
-	return strings.Join(location, "/")
-}
-
 // DisplayBanner displays the main application banner
 func DisplayBanner() {
 	fmt.Print(figure.NewFigure("     camtruder", "cybermedium", true))
@@ -78,18 +25,18 @@ func DisplayBanner() {
 }
 
 // DisplayTargetBanner displays the banner with target information
-func DisplayTargetBanner(targets, users, passwords, threads int, output string) {
+func DisplayTargetBanner(targets, credentials, threads int, output string) {
 	DisplayBanner()
-	fmt.Printf("%s Targets: %d | Users: %d | Passwords: %d | Threads: %d%s%s\n",
-		config.ColorBold, targets, users, passwords, threads, getOutputStr(output), config.ColorReset)
+	fmt.Printf("%s Targets: %d | Credentials: %d | Threads: %d%s%s\n",
+		config.ColorBold, targets, credentials, threads, getOutputStr(output), config.ColorReset)
 	println()
 }
 
 // DisplayInternetScanBanner displays the banner for internet scanning
-func DisplayInternetScanBanner(limit, users, passwords, threads int, output string) {
+func DisplayInternetScanBanner(limit, credentials, threads int, output string) {
 	DisplayBanner()
-	fmt.Printf("%s Internet Scan | Limit: %d | Users: %d | Passwords: %d | Threads: %d%s%s\n",
-		config.ColorBold, limit, users, passwords, threads, getOutputStr(output), config.ColorReset)
+	fmt.Printf("%s Internet Scan | Limit: %d | Credentials: %d | Threads: %d%s%s\n",
+		config.ColorBold, limit, credentials, threads, getOutputStr(output), config.ColorReset)
 	println()
 }
 
@@ -102,10 +49,18 @@ func getOutputStr(output string) string {
 
 // FormatIP formats an IP address with port
 func FormatIP(ip string) string {
-	if strings.Contains(ip, ":") {
+	if _, _, err := net.SplitHostPort(ip); err == nil {
 		return ip
 	}
-	return fmt.Sprintf("%s:%d", ip, config.DefaultPort)
+	return FormatTarget(strings.Trim(ip, "[]"), config.DefaultPort)
+}
+
+// FormatTarget joins an IP address and port into a dialable target
+func FormatTarget(ip string, port int) string {
+	if port == 0 {
+		port = config.DefaultPort
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
 }
 
 // FormatIPBytes formats IP bytes with port
@@ -171,9 +126,11 @@ func GenerateRandomIP() string {
 	}
 }
 
-// ScanPort checks if a port is open on a given IP
-func ScanPort(ip string, timeout time.Duration) bool {
-	conn, err := net.DialTimeout("tcp", ip, timeout)
+// ScanPort checks if a port is open on a given IP using the given dialer
+func ScanPort(ctx context.Context, d dialer.ContextDialer, ip string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := d.DialContext(ctx, "tcp", ip)
 	if err != nil {
 		return false
 	}
@@ -181,11 +138,17 @@ func ScanPort(ip string, timeout time.Duration) bool {
 	return true
 }
 
-// WriteResult writes a result to a file if the file is not nil
-func WriteResult(result string, outFile *os.File) {
-	if outFile != nil {
-		fmt.Fprintln(outFile, result)
+// SplitHostPort splits an "ip:port" target into its host and numeric port
+func SplitHostPort(target string) (string, int) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return target, config.DefaultPort
 	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return host, config.DefaultPort
+	}
+	return host, port
 }
 
 // ExpandIPRange expands an IP range from start to end into individual IPs
@@ -224,7 +187,7 @@ func RangeToCIDR(start, end string) string {
 		mask := uint32(0xFFFFFFFF) << (32 - prefix)
 		networkStart := startInt & mask
 		networkEnd := networkStart | (^mask)
-		
+
 		if networkStart == startInt && networkEnd == endInt {
 			return fmt.Sprintf("%s/%d", start, prefix)
 		}
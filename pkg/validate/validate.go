@@ -0,0 +1,177 @@
+// Package validate re-tests the hits of an earlier scan. Every result is
+// checked against its recorded URL and credentials only, without port
+// checks or fingerprinting, and marked with whether it still works.
+package validate
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/dialer"
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	httpprobe "github.com/ALW1EZ/camtruder/pkg/probe/http"
+	"github.com/ALW1EZ/camtruder/pkg/probe/pelco"
+	"github.com/ALW1EZ/camtruder/pkg/probe/tlscert"
+	"github.com/ALW1EZ/camtruder/pkg/rtsp"
+	"github.com/ALW1EZ/camtruder/pkg/utils"
+)
+
+// Options configures a Validator
+type Options struct {
+	Timeouts  rtsp.Timeouts
+	Dialer    dialer.ContextDialer // Used for every connection, nil to dial directly
+	TLSConfig *tls.Config          // TLS client settings, nil for the defaults
+	Transport string               // RTP transport, rtsp.TransportTCP by default
+	Workers   int                  // Results checked at once
+	Headers   map[string]string    // Extra headers sent with every HTTP request
+
+	// OnChecked is called after each result is checked, may be nil
+	OnChecked func(result output.Result)
+}
+
+// Validator re-tests scan results
+type Validator struct {
+	opts Options
+	http *httpprobe.Prober
+	cert *tlscert.Prober
+}
+
+// New creates a validator from the given options
+func New(opts Options) *Validator {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	return &Validator{
+		opts: opts,
+		http: httpprobe.NewProber(httpprobe.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			Dialer:         opts.Dialer,
+			TLSConfig:      opts.TLSConfig,
+			Headers:        opts.Headers,
+		}),
+		cert: tlscert.NewProber(tlscert.Options{
+			ConnectTimeout: opts.Timeouts.Connect,
+			ReadTimeout:    opts.Timeouts.Read,
+			Dialer:         opts.Dialer,
+			TLSConfig:      opts.TLSConfig,
+		}),
+	}
+}
+
+// Validate checks every result, Workers at a time, and returns them in
+// their original order with StillValid and LastChecked set. Results that
+// no longer work are kept so the output stays a complete audit trail. If
+// ctx is canceled, the results not checked yet are returned unmarked.
+func (v *Validator) Validate(ctx context.Context, results []output.Result) []output.Result {
+	validated := make([]output.Result, len(results))
+	copy(validated, results)
+
+	sem := make(chan struct{}, v.opts.Workers)
+	var wg sync.WaitGroup
+	for i := range validated {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return validated
+		}
+		wg.Add(1)
+		go func(result *output.Result) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			valid := v.check(ctx, *result)
+			if ctx.Err() != nil {
+				return
+			}
+			checked := time.Now().UTC()
+			result.StillValid = &valid
+			result.LastChecked = &checked
+			if v.opts.OnChecked != nil {
+				v.opts.OnChecked(*result)
+			}
+		}(&validated[i])
+	}
+	wg.Wait()
+	return validated
+}
+
+// check reports whether a result still works: a credential hit still
+// authenticates, a finding is still present, and a Pelco bus still has
+// cameras answering
+func (v *Validator) check(ctx context.Context, result output.Result) bool {
+	target := utils.FormatTarget(result.IP, result.Port)
+	if result.Vulnerability == tlscert.FindingExpired {
+		cert, err := v.cert.Inspect(ctx, target)
+		return err == nil && cert.Expired(time.Now())
+	}
+
+	rawURL := result.URL
+	if rawURL == "" {
+		rawURL = fmt.Sprintf("%s://%s%s", result.Protocol, target, result.Path)
+	}
+	switch strings.ToLower(result.Protocol) {
+	case "rtsp", "rtsps":
+		success, _ := rtsp.TestCredentials(ctx, rawURL, rtsp.Config{
+			Timeouts:  v.opts.Timeouts,
+			Dialer:    v.opts.Dialer,
+			Transport: v.opts.Transport,
+			TLSConfig: v.opts.TLSConfig,
+		})
+		return success
+	case pelco.ProtocolD, pelco.ProtocolP:
+		return v.checkPelco(ctx, result)
+	case "http", "https":
+		// The credentials are sent by the prober, not from the URL
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return false
+		}
+		u.User = nil
+		resp, err := v.http.TestCredentials(ctx, u.String(), result.Username, result.Password)
+		if err != nil {
+			return false
+		}
+		// Open interfaces and streams no longer asking for the old pair
+		// still give access
+		return resp.Success || (!resp.AuthRequired && resp.StatusCode >= 200 && resp.StatusCode < 400)
+	default:
+		return false
+	}
+}
+
+// checkPelco probes a Pelco bus again over the recorded address range. The
+// bus still works if any address that answered before answers again in
+// the same protocol.
+func (v *Validator) checkPelco(ctx context.Context, result output.Result) bool {
+	addrs, err := pelco.ParseAddresses(result.PelcoAddresses)
+	if err != nil {
+		return false
+	}
+	prober := pelco.NewProber(pelco.Options{
+		Port:      result.Port,
+		StartAddr: addrs[0],
+		EndAddr:   addrs[len(addrs)-1],
+		Dialer:    v.opts.Dialer,
+	})
+	found, err := prober.Probe(ctx, result.IP)
+	if err != nil && !found.Found() {
+		return false
+	}
+	for _, device := range found.Devices {
+		if device.Protocol != result.Protocol {
+			continue
+		}
+		for _, addr := range addrs {
+			if device.Address == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
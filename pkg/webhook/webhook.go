@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ALW1EZ/camtruder/pkg/output"
+	"github.com/projectdiscovery/gologger"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the body when a secret is set
+const SignatureHeader = "X-Camtruder-Signature"
+
+// Delivery defaults
+const (
+	DefaultTimeout = 10 * time.Second
+	MaxRetries     = 3
+	QueueSize      = 256
+	initialBackoff = time.Second
+)
+
+// Options configures a Sender
+type Options struct {
+	URL     string
+	Secret  string        // Signs every body with HMAC-SHA256 if set
+	Timeout time.Duration // Per-attempt timeout, DefaultTimeout if zero
+	SSE     bool          // Send each result as a text/event-stream event instead of plain JSON
+}
+
+// Sender POSTs credential hits to a webhook, one request per hit with a
+// JSON body or, with Options.SSE, a single server-sent event. It implements
+// output.ResultWriter; Write only queues the result so a slow receiver
+// never holds up the scan, and Close waits for the queue to drain.
+type Sender struct {
+	url     string
+	secret  []byte
+	client  *http.Client
+	backoff time.Duration
+	sse     bool
+	events  int // Events sent so far, the id of the next SSE event
+	queue   chan output.Result
+	done    chan struct{}
+	once    sync.Once
+}
+
+// New starts a sender for opts.URL
+func New(opts Options) (*Sender, error) {
+	if u, err := url.Parse(opts.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q (use http:// or https://)", opts.URL)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	s := &Sender{
+		url:     opts.URL,
+		client:  &http.Client{Timeout: timeout},
+		backoff: initialBackoff,
+		sse:     opts.SSE,
+		queue:   make(chan output.Result, QueueSize),
+		done:    make(chan struct{}),
+	}
+	if opts.Secret != "" {
+		s.secret = []byte(opts.Secret)
+	}
+	go s.run()
+	return s, nil
+}
+
+// Write queues a credential hit for delivery. Vulnerability findings and
+// Pelco buses, which have no credentials, are not sent. If the queue is
+// full the result is dropped with a warning.
+func (s *Sender) Write(r output.Result) error {
+	if r.Vulnerability != "" || r.PelcoAddresses != "" {
+		return nil
+	}
+	select {
+	case s.queue <- r:
+		return nil
+	default:
+		return fmt.Errorf("webhook queue full, dropping result for %s", r.URL)
+	}
+}
+
+// Close delivers the queued results and stops the sender
+func (s *Sender) Close() error {
+	s.once.Do(func() { close(s.queue) })
+	<-s.done
+	return nil
+}
+
+// run delivers queued results one at a time
+func (s *Sender) run() {
+	defer close(s.done)
+	for r := range s.queue {
+		if err := s.deliver(r); err != nil {
+			kind := "Webhook"
+			if s.sse {
+				kind = "Live result"
+			}
+			gologger.Warning().Msgf("%s delivery failed for %s:%d: %v", kind, r.IP, r.Port, err)
+		}
+	}
+}
+
+// deliver POSTs a result, retrying with exponential backoff on errors
+func (s *Sender) deliver(r output.Result) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	contentType := "application/json"
+	if s.sse {
+		s.events++
+		body = []byte(fmt.Sprintf("id: %d\nevent: result\ndata: %s\n\n", s.events, body))
+		contentType = "text/event-stream"
+	}
+
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(body, contentType)
+		if err == nil || attempt == MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a single attempt; any non-2xx status is an error
+func (s *Sender) post(body []byte, contentType string) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "camtruder")
+	if s.secret != nil {
+		req.Header.Set(SignatureHeader, Sign(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value for body, "sha256=" followed by
+// the hex HMAC-SHA256 of the body keyed with secret
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}